@@ -40,6 +40,7 @@ type String struct {
 	Token        token.Token
 	Value        string
 	Interpolated map[string]Expression
+	Starts       []int
 }
 
 type Integer struct {
@@ -60,6 +61,7 @@ type Array struct {
 type Dictionary struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	Keys  []Expression
 }
 
 type Symbol struct {
@@ -72,15 +74,17 @@ type Nil struct {
 }
 
 type Val struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Expression
+	Value   Expression
 }
 
 type Var struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Expression
+	Value   Expression
 }
 
 type Is struct {
@@ -105,6 +109,7 @@ type If struct {
 type Repeat struct {
 	Token      token.Token
 	Arguments  *IdentifierList
+	Pattern    Expression
 	Enumerable Expression
 	Body       *BlockStatement
 }
@@ -119,7 +124,27 @@ type Match struct {
 type MatchWhen struct {
 	Token  token.Token
 	Values *ExpressionList
+	Guard  Expression
+	Body   *BlockStatement
+}
+
+type TypePattern struct {
+	Token token.Token
+	Name  Expression
+	Type  *Identifier
+}
+
+type RestPattern struct {
+	Token token.Token
+	Name  Expression
+}
+
+type Try struct {
+	Token  token.Token
 	Body   *BlockStatement
+	Error  *Identifier
+	Rescue *BlockStatement
+	Ensure *BlockStatement
 }
 
 type Break struct {
@@ -135,6 +160,35 @@ type Return struct {
 	Value Expression
 }
 
+type Spawn struct {
+	Token    token.Token
+	Function Expression
+}
+
+type Await struct {
+	Token token.Token
+	Task  Expression
+}
+
+type Select struct {
+	Token token.Token
+	Cases []*SelectCase
+	Else  *BlockStatement
+}
+
+type SelectCase struct {
+	Token   token.Token
+	Name    *Identifier
+	Channel Expression
+	Value   Expression
+	Body    *BlockStatement
+}
+
+type Yield struct {
+	Token token.Token
+	Value Expression
+}
+
 type Pipe struct {
 	Token token.Token
 	Left  Expression
@@ -145,12 +199,17 @@ type PlaceHolder struct {
 	Token token.Token
 }
 
+type BadExpression struct {
+	Token token.Token
+}
+
 type Function struct {
 	Token      token.Token
 	Parameters []*FunctionParameter
 	Body       *BlockStatement
 	ReturnType *Identifier
 	Variadic   bool
+	Generator  bool
 }
 
 type FunctionParameter struct {
@@ -164,6 +223,7 @@ type FunctionCall struct {
 	Token     token.Token
 	Function  Expression
 	Arguments *ExpressionList
+	Tail      bool
 }
 
 type Module struct {
@@ -172,6 +232,36 @@ type Module struct {
 	Body  *BlockStatement
 }
 
+type Struct struct {
+	Token  token.Token
+	Name   *Identifier
+	Fields []*StructField
+}
+
+type StructField struct {
+	Token token.Token
+	Name  *Identifier
+	Type  *Identifier
+}
+
+type Enum struct {
+	Token    token.Token
+	Name     *Identifier
+	Variants []*EnumVariant
+}
+
+type EnumVariant struct {
+	Token  token.Token
+	Name   *Identifier
+	Fields []*StructField
+}
+
+type FieldAccess struct {
+	Token  token.Token
+	Object Expression
+	Field  *Identifier
+}
+
 type ModuleAccess struct {
 	Token     token.Token
 	Object    *Identifier
@@ -212,8 +302,11 @@ type ExpressionList struct {
 }
 
 type Identifier struct {
-	Token token.Token
-	Value string
+	Token    token.Token
+	Value    string
+	Resolved bool
+	Depth    int
+	Slot     int
 }
 
 type IdentifierList struct {
@@ -348,8 +441,8 @@ func (a *Dictionary) TokenPosition() token.Position {
 func (a *Dictionary) Check() string {
 	var out bytes.Buffer
 	var pairs []string
-	for key, value := range a.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s => %s", key.Check(), value.Check()))
+	for _, key := range a.Keys {
+		pairs = append(pairs, fmt.Sprintf("%s => %s", key.Check(), a.Pairs[key].Check()))
 	}
 	out.WriteString(token.LeftBracket)
 	out.WriteString(strings.Join(pairs,", "))
@@ -404,7 +497,11 @@ func (a *Val) Check() string {
 	var out bytes.Buffer
 	out.WriteString(token.Val)
 	out.WriteString(token.Space)
-	out.WriteString(a.Name.Check())
+	if a.Pattern != nil {
+		out.WriteString(a.Pattern.Check())
+	} else {
+		out.WriteString(a.Name.Check())
+	}
 	out.WriteString(token.Space)
 	out.WriteString(token.Assign)
 	out.WriteString(token.Space)
@@ -429,7 +526,11 @@ func (a *Var) Check() string {
 	var out bytes.Buffer
 	out.WriteString(token.Var)
 	out.WriteString(token.Space)
-	out.WriteString(a.Name.Check())
+	if a.Pattern != nil {
+		out.WriteString(a.Pattern.Check())
+	} else {
+		out.WriteString(a.Name.Check())
+	}
 	out.WriteString(token.Space)
 	out.WriteString(token.Assign)
 	out.WriteString(token.Space)
@@ -533,6 +634,13 @@ func (a *Repeat) Check() string {
 		out.WriteString(token.LeftParenthesis)
 		if a.Arguments != nil {
 			out.WriteString(a.Arguments.Check())
+			if a.Pattern != nil {
+				if len(a.Arguments.Elements) > 0 {
+					out.WriteString(token.Comma)
+					out.WriteString(token.Space)
+				}
+				out.WriteString(a.Pattern.Check())
+			}
 			out.WriteString(token.Space)
 			out.WriteString(token.In)
 			out.WriteString(token.Space)
@@ -547,6 +655,41 @@ func (a *Repeat) Check() string {
 	return out.String()
 }
 
+func (a *Try) Expression() {
+}
+
+func (a *Try) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *Try) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *Try) Check() string {
+	var out bytes.Buffer
+	out.WriteString(token.Try)
+	out.WriteString(token.Space)
+	out.WriteString(a.Body.Check())
+	if a.Rescue != nil {
+		out.WriteString(token.Space)
+		out.WriteString(token.Rescue)
+		if a.Error != nil {
+			out.WriteString(token.Space)
+			out.WriteString(a.Error.Check())
+		}
+		out.WriteString(token.Space)
+		out.WriteString(a.Rescue.Check())
+	}
+	if a.Ensure != nil {
+		out.WriteString(token.Space)
+		out.WriteString(token.Ensure)
+		out.WriteString(token.Space)
+		out.WriteString(a.Ensure.Check())
+	}
+	return out.String()
+}
+
 func (a *Match) Expression() {
 }
 
@@ -600,6 +743,12 @@ func (a *MatchWhen) Check() string {
 	out.WriteString(token.Space)
 	out.WriteString(a.Values.Check())
 	out.WriteString(token.Space)
+	if a.Guard != nil {
+		out.WriteString(token.If)
+		out.WriteString(token.Space)
+		out.WriteString(a.Guard.Check())
+		out.WriteString(token.Space)
+	}
 	out.WriteString(token.Then)
 	out.WriteString(token.Space)
 	out.WriteString(a.Body.Check())
@@ -657,6 +806,125 @@ func (a *Return) Check() string {
 	return out.String()
 }
 
+func (a *Spawn) Expression() {
+}
+
+func (a *Spawn) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *Spawn) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *Spawn) Check() string {
+	return a.Token.Literal + token.Space + a.Function.Check()
+}
+
+func (a *Await) Expression() {
+}
+
+func (a *Await) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *Await) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *Await) Check() string {
+	return a.Token.Literal + token.Space + a.Task.Check()
+}
+
+func (a *Select) Expression() {
+}
+
+func (a *Select) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *Select) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *Select) Check() string {
+	var out bytes.Buffer
+	out.WriteString(a.Token.Literal)
+	for _, c := range a.Cases {
+		out.WriteString(token.Space)
+		out.WriteString(c.Check())
+	}
+	if a.Else != nil {
+		out.WriteString(token.Space)
+		out.WriteString(token.Else)
+		out.WriteString(token.Space)
+		out.WriteString(token.Then)
+		out.WriteString(token.Space)
+		out.WriteString(a.Else.Check())
+	}
+	return out.String()
+}
+
+func (a *SelectCase) Expression() {
+}
+
+func (a *SelectCase) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *SelectCase) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *SelectCase) Check() string {
+	var out bytes.Buffer
+	out.WriteString(token.When)
+	out.WriteString(token.Space)
+	if a.Name != nil {
+		out.WriteString(a.Name.Check())
+		out.WriteString(token.Space)
+		out.WriteString(token.Assign)
+		out.WriteString(token.Space)
+	}
+	out.WriteString(a.Channel.Check())
+	out.WriteString(token.Dot)
+	if a.Value != nil {
+		out.WriteString("send")
+		out.WriteString(token.LeftParenthesis)
+		out.WriteString(a.Value.Check())
+	} else {
+		out.WriteString("receive")
+		out.WriteString(token.LeftParenthesis)
+	}
+	out.WriteString(token.RightParenthesis)
+	out.WriteString(token.Space)
+	out.WriteString(token.Then)
+	out.WriteString(token.Space)
+	out.WriteString(a.Body.Check())
+	return out.String()
+}
+
+func (a *Yield) Expression() {
+}
+
+func (a *Yield) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *Yield) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *Yield) Check() string {
+	var out bytes.Buffer
+	out.WriteString(a.Token.Literal)
+	if a.Value != nil {
+		out.WriteString(token.Space)
+		out.WriteString(a.Value.Check())
+	}
+	return out.String()
+}
+
 func (a *Pipe) Expression() {
 }
 
@@ -678,6 +946,39 @@ func (a *Pipe) Check() string {
 	return out.String()
 }
 
+func (a *TypePattern) Expression() {
+}
+
+func (a *TypePattern) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *TypePattern) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *TypePattern) Check() string {
+	return a.Name.Check() + token.Colon + token.Space + a.Type.Check()
+}
+
+func (a *RestPattern) Expression() {
+}
+
+func (a *RestPattern) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *RestPattern) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *RestPattern) Check() string {
+	if a.Name == nil {
+		return token.Ellipsis
+	}
+	return token.Ellipsis + a.Name.Check()
+}
+
 func (a *PlaceHolder) Expression() {
 }
 
@@ -693,6 +994,21 @@ func (a *PlaceHolder) Check() string {
 	return ""
 }
 
+func (a *BadExpression) Expression() {
+}
+
+func (a *BadExpression) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *BadExpression) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *BadExpression) Check() string {
+	return "<bad expression>"
+}
+
 func (a *Function) Expression() {
 }
 
@@ -804,6 +1120,109 @@ func (a *Module) Check() string {
 	return out.String()
 }
 
+func (a *Struct) Expression() {
+}
+
+func (a *Struct) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *Struct) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *Struct) Check() string {
+	var out bytes.Buffer
+	var fields []string
+	for _, field := range a.Fields {
+		fields = append(fields, field.Check())
+	}
+	out.WriteString(token.Struct)
+	out.WriteString(token.Space)
+	out.WriteString(a.Name.Check())
+	out.WriteString(token.Space)
+	out.WriteString(strings.Join(fields, token.Comma+token.Space))
+	out.WriteString(token.Space)
+	out.WriteString(token.End)
+	return out.String()
+}
+
+func (a *StructField) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *StructField) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *StructField) Check() string {
+	if a.Type == nil {
+		return a.Name.Check()
+	}
+	return a.Name.Check() + token.Colon + token.Space + a.Type.Check()
+}
+
+func (a *Enum) Expression() {
+}
+
+func (a *Enum) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *Enum) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *Enum) Check() string {
+	var out bytes.Buffer
+	var variants []string
+	for _, variant := range a.Variants {
+		variants = append(variants, variant.Check())
+	}
+	out.WriteString(token.Enum)
+	out.WriteString(token.Space)
+	out.WriteString(a.Name.Check())
+	out.WriteString(token.Space)
+	out.WriteString(strings.Join(variants, token.Comma+token.Space))
+	out.WriteString(token.Space)
+	out.WriteString(token.End)
+	return out.String()
+}
+
+func (a *EnumVariant) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *EnumVariant) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *EnumVariant) Check() string {
+	if len(a.Fields) == 0 {
+		return a.Name.Check()
+	}
+	var fields []string
+	for _, field := range a.Fields {
+		fields = append(fields, field.Check())
+	}
+	return a.Name.Check() + token.LeftParenthesis + strings.Join(fields, token.Comma+token.Space) + token.RightParenthesis
+}
+
+func (a *FieldAccess) Expression() {
+}
+
+func (a *FieldAccess) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *FieldAccess) TokenPosition() token.Position {
+	return a.Token.Position
+}
+
+func (a *FieldAccess) Check() string {
+	return a.Object.Check() + token.Dot + a.Field.Check()
+}
+
 func (a *ModuleAccess) Expression() {
 }
 
@@ -30,7 +30,7 @@ build() {
         binary="$binary.exe"
     fi
 
-    env GOOS=${os} GOARCH=${arch} go build -v -o ${binary} ../oro.go
+    env GOOS=${os} GOARCH=${arch} go build -v -o ${binary} ../cmd/oro
 
     if [ ${os} = linux ]; then
         tar czf "$release.tar.gz" "$binary"
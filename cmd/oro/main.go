@@ -0,0 +1,155 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package main implements functions to main application.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/luiscm/oro/interpreter"
+	"github.com/luiscm/oro/lexer"
+	"github.com/luiscm/oro/parser"
+	"github.com/luiscm/oro/rerror"
+	"github.com/luiscm/oro/runtime"
+	"github.com/luiscm/oro/runtime/stdlib"
+	"github.com/luiscm/oro/util"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func main() {
+	app := cli.NewApp()
+	app.Name = util.Name()
+	app.Usage = ""
+	app.Authors = []cli.Author{{
+		Name:  util.AuthorName(),
+		Email: util.AuthorEmail(),
+	}}
+	app.Version = util.Version()
+	app.Compiled = time.Now()
+	app.Copyright = fmt.Sprintf(util.Copyright(), time.Now().Year())
+	app.Commands = []cli.Command{
+		{
+			Name:  util.CliCommandNameRun(),
+			Usage: util.CliCommandUsageRun(),
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  util.CliFlagErrorFormat(),
+					Value: util.ErrorFormatText(),
+					Usage: util.CliFlagUsageErrorFormat(),
+				},
+				cli.StringFlag{
+					Name:  util.CliFlagEngine(),
+					Value: util.EngineTree(),
+					Usage: util.CliFlagUsageEngine(),
+				},
+			},
+			Action: func(c *cli.Context) error {
+				format := c.String(util.CliFlagErrorFormat())
+				if format != util.ErrorFormatText() && format != util.ErrorFormatJSON() {
+					color.Red(util.CliFlagInvalidErrorFormat(), format)
+					return nil
+				}
+				engine, err := interpreter.ParseEngine(c.String(util.CliFlagEngine()))
+				if err != nil {
+					color.Red(util.CliFlagInvalidEngine(), c.String(util.CliFlagEngine()))
+					return nil
+				}
+				if len(c.Args()) != 1 {
+					color.Red(util.CliCommandActionRunSourceFile())
+					return nil
+				}
+				file := c.Args()[0]
+				ext := filepath.Ext(file)
+				if ext == "" || ext != util.FileExtension() {
+					color.Red(util.CliCommandActionRunExistFile(), file)
+					return nil
+				}
+				source, err := ioutil.ReadFile(file)
+				if err != nil {
+					color.Red(util.CliCommandActionRunReadFile(), file)
+					return nil
+				}
+				lex := lexer.New(file, source)
+				parse := parser.New(lex)
+				program := parse.Parse()
+				if diagnostics := parse.Diagnostics(); diagnostics.HasErrors() {
+					printErrors(format, diagnostics.Errors(), sourceLoader(file, source))
+					return nil
+				}
+				runner := interpreter.New()
+				runner.SetEngine(engine)
+				runner.Interpreter(program, runtime.NewScope())
+				if diagnostics := runner.Diagnostics(); diagnostics.HasErrors() {
+					printErrors(format, diagnostics.Errors(), sourceLoader(file, source))
+					return nil
+				}
+				return nil
+			},
+		},
+		{
+			Name:  util.CliCommandNameRepl(),
+			Usage: util.CliCommandUsageRepl(),
+			Action: func(c *cli.Context) error {
+				input := bufio.NewReader(os.Stdin)
+				color.HiGreen(util.NameVersionEnvironment())
+				color.HiBlue(util.CommandExit())
+				sc := runtime.NewScope()
+				runner := interpreter.New()
+				for {
+					color.Set(color.FgHiWhite)
+					fmt.Print(util.ReplSignal())
+					color.Unset()
+					source, _ := input.ReadBytes('\n')
+					lex := lexer.New(util.ReplFile(), source)
+					parse := parser.New(lex)
+					program := parse.Parse()
+					if diagnostics := parse.Diagnostics(); diagnostics.HasErrors() {
+						rerror.PrintErrors(diagnostics.Errors(), sourceLoader(util.ReplFile(), source))
+						continue
+					}
+					object := runner.Interpreter(program, sc)
+					if diagnostics := runner.Diagnostics(); diagnostics.HasErrors() {
+						rerror.PrintErrors(diagnostics.Errors(), sourceLoader(util.ReplFile(), source))
+						diagnostics.Clear()
+						continue
+					}
+					if object != nil {
+						fmt.Println(object.Check())
+					}
+				}
+			},
+		},
+	}
+	app.CommandNotFound = func(ctx *cli.Context, command string) {
+		color.Set(color.FgHiRed)
+		fmt.Fprintf(ctx.App.Writer, util.CommandNotFound(), command)
+		color.Unset()
+	}
+	app.Run(os.Args)
+}
+
+func printErrors(format string, diagnostics []rerror.Diagnostic, source rerror.SourceLoader) {
+	if format == util.ErrorFormatJSON() {
+		rerror.JSONRenderer{}.Render(os.Stdout, diagnostics)
+		return
+	}
+	rerror.PrintErrors(diagnostics, source)
+}
+
+func sourceLoader(name string, source []byte) rerror.SourceLoader {
+	return func(file string) ([]byte, bool) {
+		if file == name {
+			return source, true
+		}
+		if module, ok := stdlib.Source(file); ok {
+			return module, true
+		}
+		return rerror.FileLoader(file)
+	}
+}
@@ -0,0 +1,575 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package interpreter implements functions to bytecode.
+package interpreter
+
+import (
+	"fmt"
+	"github.com/luiscm/oro/ast"
+	"github.com/luiscm/oro/runtime"
+	"github.com/luiscm/oro/token"
+	"strings"
+)
+
+type opcode byte
+
+const maxOperand = 1<<16 - 1
+
+const (
+	opConstant     opcode = iota // constant
+	opNil                        //
+	opPop                        //
+	opGetLocal                   // slot
+	opDefine                     // slot, name constant
+	opAssignLocal                // slot, node
+	opGetFree                    // node, scopes
+	opAssignable                 // node, scopes
+	opAssignFree                 // node, scopes
+	opAdd                        // node
+	opSubtract                   // node
+	opMultiply                   // node
+	opLess                       // node
+	opLessEqual                  // node
+	opGreater                    // node
+	opGreaterEqual               // node
+	opEqual                      // node
+	opNotEqual                   // node
+	opInfix                      // node
+	opPrefix                     // node
+	opAnd                        // address
+	opOr                         // address
+	opJump                       // address
+	opJumpIfFalse                // address
+	opLoop                       // address, node
+	opArray                      // count, node
+	opInterpolate                // count, node
+	opSubscript                  // node
+	opCall                       // arguments, node
+	opRuntimeCall                // arguments, node
+	opIterate                    // node
+	opNext                       // address, value slot, index slot + 1
+	opEndIterate                 //
+	opDeclare                    // name node, node, immutable
+	opTree                       // node
+	opReturn                     //
+)
+
+var arithmetic = map[string]opcode{
+	token.Plus:         opAdd,
+	token.Minus:        opSubtract,
+	token.Multiply:     opMultiply,
+	token.Less:         opLess,
+	token.LessEqual:    opLessEqual,
+	token.Greater:      opGreater,
+	token.GreaterEqual: opGreaterEqual,
+	token.Equal:        opEqual,
+	token.NotEqual:     opNotEqual,
+}
+
+type chunk struct {
+	code       []byte
+	constants  []runtime.Data
+	nodes      []ast.Node
+	locals     int
+	statements []int
+}
+
+type local struct {
+	slot      int
+	immutable bool
+}
+
+type loop struct {
+	breaks    []int
+	continues []int
+}
+
+// compiler compiles the body of a function or a program. It gives up on the
+// nodes it doesn't know, naming their kind as the reason, and the function is
+// then run from the tree. In a program, the nodes outside of blocks are run
+// from the tree on their own, and the other statements it gives up on as a
+// whole.
+type compiler struct {
+	interpreter *Interpreter
+	chunk       *chunk
+	blocks      []map[string]local
+	loops       []*loop
+	program     bool
+	reason      string
+	fallbacks   []string
+}
+
+func (i *Interpreter) bytecode(function *runtime.TFunction) *chunk {
+	if i.engine != EngineVM {
+		return nil
+	}
+	if code, ok := i.chunks[function.Body]; ok {
+		return code
+	}
+	code := i.compile(function)
+	i.chunks[function.Body] = code
+	return code
+}
+
+func (i *Interpreter) compile(function *runtime.TFunction) *chunk {
+	c := &compiler{interpreter: i, chunk: &chunk{}, blocks: []map[string]local{{}}}
+	if !c.function(function) || !c.fits() {
+		i.fallbacks[c.reason]++
+		return nil
+	}
+	return c.chunk
+}
+
+func (i *Interpreter) compileProgram(np *ast.Program) *chunk {
+	c := &compiler{interpreter: i, chunk: &chunk{}, program: true}
+	for idx, statement := range np.Statements {
+		c.topLevel(statement, idx == len(np.Statements)-1)
+	}
+	if !c.fits() {
+		i.fallbacks[c.reason]++
+		return nil
+	}
+	for _, reason := range c.fallbacks {
+		i.fallbacks[reason]++
+	}
+	return c.chunk
+}
+
+func (c *compiler) function(function *runtime.TFunction) bool {
+	switch {
+	case function.Generator:
+		c.reason = "Generator"
+		return false
+	case function.Variadic:
+		c.reason = "Variadic"
+		return false
+	}
+	for _, param := range function.Parameters {
+		if _, ok := c.blocks[0][param.Name.Value]; ok || param.Default != nil {
+			return c.unsupported(param)
+		}
+		c.declare(param.Name.Value, false)
+	}
+	if !c.statements(function.Body, true) {
+		return false
+	}
+	c.emit(opReturn)
+	return true
+}
+
+func (c *compiler) topLevel(n ast.Node, last bool) {
+	code, constants, nodes := len(c.chunk.code), len(c.chunk.constants), len(c.chunk.nodes)
+	fallbacks := len(c.fallbacks)
+	c.chunk.statements = append(c.chunk.statements, code)
+	if c.statement(n, last) {
+		if !last {
+			c.emit(opNil)
+		}
+		c.emit(opReturn)
+		return
+	}
+	c.chunk.code = c.chunk.code[:code]
+	c.chunk.constants = c.chunk.constants[:constants]
+	c.chunk.nodes = c.chunk.nodes[:nodes]
+	c.fallbacks = append(c.fallbacks[:fallbacks], c.reason)
+	c.emit(opTree, c.node(n))
+	if !last {
+		c.emit(opPop)
+		c.emit(opNil)
+	}
+	c.emit(opReturn)
+}
+
+func (c *compiler) fits() bool {
+	if len(c.chunk.code) > maxOperand || len(c.chunk.constants) > maxOperand || len(c.chunk.nodes) > maxOperand {
+		c.reason = "Size"
+		return false
+	}
+	return true
+}
+
+func kind(n ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")
+}
+
+func (c *compiler) unsupported(n ast.Node) bool {
+	c.reason = kind(n)
+	return false
+}
+
+func (c *compiler) tree(n ast.Node) bool {
+	if !c.program || len(c.blocks) > 0 {
+		return c.unsupported(n)
+	}
+	c.emit(opTree, c.node(n))
+	c.fallbacks = append(c.fallbacks, kind(n))
+	return true
+}
+
+func (c *compiler) emit(op opcode, operands ...int) int {
+	position := len(c.chunk.code)
+	c.chunk.code = append(c.chunk.code, byte(op))
+	for _, operand := range operands {
+		c.chunk.code = append(c.chunk.code, byte(operand>>8), byte(operand))
+	}
+	return position
+}
+
+func (c *compiler) patch(position, address int) {
+	c.chunk.code[position+1], c.chunk.code[position+2] = byte(address>>8), byte(address)
+}
+
+func (c *compiler) constant(value runtime.Data) int {
+	c.chunk.constants = append(c.chunk.constants, value)
+	return len(c.chunk.constants) - 1
+}
+
+func (c *compiler) node(n ast.Node) int {
+	c.chunk.nodes = append(c.chunk.nodes, n)
+	return len(c.chunk.nodes) - 1
+}
+
+func (c *compiler) declare(name string, immutable bool) int {
+	slot := c.chunk.locals
+	c.chunk.locals++
+	c.blocks[len(c.blocks)-1][name] = local{slot: slot, immutable: immutable}
+	return slot
+}
+
+func (c *compiler) resolve(name string) (local, bool) {
+	for idx := len(c.blocks) - 1; idx >= 0; idx-- {
+		if found, ok := c.blocks[idx][name]; ok {
+			return found, true
+		}
+	}
+	return local{}, false
+}
+
+func (c *compiler) openBlock() {
+	c.blocks = append(c.blocks, map[string]local{})
+}
+
+func (c *compiler) closeBlock() {
+	c.blocks = c.blocks[:len(c.blocks)-1]
+}
+
+func (c *compiler) statements(nb *ast.BlockStatement, used bool) bool {
+	if nb == nil || len(nb.Statements) == 0 {
+		return c.unsupported(nb)
+	}
+	for idx, statement := range nb.Statements {
+		if !c.statement(statement, used && idx == len(nb.Statements)-1) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *compiler) statement(n ast.Node, used bool) bool {
+	switch n := n.(type) {
+	case *ast.ExpressionStatement:
+		return c.statement(n.Expression, used)
+	case *ast.Val:
+		return c.declaration(n, n.Name, n.Pattern, n.Value, true, used)
+	case *ast.Var:
+		return c.declaration(n, n.Name, n.Pattern, n.Value, false, used)
+	case *ast.Return:
+		if n.Value == nil || c.program {
+			return c.unsupported(n)
+		}
+		if !c.expression(n.Value) {
+			return false
+		}
+		c.emit(opReturn)
+		return true
+	case *ast.Break:
+		return c.jump(n, false, used)
+	case *ast.Continue:
+		return c.jump(n, true, used)
+	case *ast.If:
+		return c.ifExpression(n, used)
+	case *ast.Repeat:
+		if used {
+			return c.unsupported(n)
+		}
+		return c.repeat(n)
+	}
+	if !c.expression(n) {
+		return false
+	}
+	if !used {
+		c.emit(opPop)
+	}
+	return true
+}
+
+func (c *compiler) expression(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.Integer:
+		c.emit(opConstant, c.constant(&runtime.TInteger{Value: n.Value}))
+	case *ast.Float:
+		c.emit(opConstant, c.constant(&runtime.TFloat{Value: n.Value}))
+	case *ast.Boolean:
+		c.emit(opConstant, c.constant(c.interpreter.nativeToBoolean(n.Value)))
+	case *ast.Symbol:
+		c.emit(opConstant, c.constant(&runtime.TSymbol{Value: n.Value}))
+	case *ast.Nil:
+		c.emit(opNil)
+	case *ast.String:
+		return c.str(n)
+	case *ast.Identifier:
+		if found, ok := c.resolve(n.Value); ok {
+			c.emit(opGetLocal, found.slot)
+		} else {
+			c.emit(opGetFree, c.node(n), len(c.blocks))
+		}
+	case *ast.Array:
+		for _, element := range n.List.Elements {
+			if !c.expression(element) {
+				return false
+			}
+		}
+		c.emit(opArray, len(n.List.Elements), c.node(n))
+	case *ast.Assign:
+		return c.assign(n)
+	case *ast.PrefixExpression:
+		if !c.expression(n.Right) {
+			return false
+		}
+		c.emit(opPrefix, c.node(n))
+	case *ast.InfixExpression:
+		return c.infix(n)
+	case *ast.Subscript:
+		if !c.expression(n.Left) || !c.expression(n.Index) {
+			return false
+		}
+		c.emit(opSubscript, c.node(n))
+	case *ast.FunctionCall:
+		return c.call(n)
+	case *ast.If:
+		return c.ifExpression(n, true)
+	default:
+		return c.tree(n)
+	}
+	return true
+}
+
+func (c *compiler) str(ns *ast.String) bool {
+	if len(ns.Interpolated) == 0 {
+		c.emit(opConstant, c.constant(&runtime.TString{Value: ns.Value}))
+		return true
+	}
+	count, start := 0, 0
+	for idx := 0; idx < len(ns.Value); {
+		text, expression := c.interpreter.interpolationAt(ns, idx)
+		if expression == nil {
+			idx++
+			continue
+		}
+		if idx > start {
+			c.emit(opConstant, c.constant(&runtime.TString{Value: ns.Value[start:idx]}))
+			count++
+		}
+		if !c.expression(expression) {
+			return false
+		}
+		count++
+		idx += len(text)
+		start = idx
+	}
+	if start < len(ns.Value) {
+		c.emit(opConstant, c.constant(&runtime.TString{Value: ns.Value[start:]}))
+		count++
+	}
+	c.emit(opInterpolate, count, c.node(ns))
+	return true
+}
+
+func (c *compiler) declaration(n ast.Node, name *ast.Identifier, pattern, value ast.Expression, immutable, used bool) bool {
+	if pattern != nil {
+		return c.unsupported(n)
+	}
+	if !c.expression(value) {
+		return false
+	}
+	if c.program && len(c.blocks) == 0 {
+		flag := 0
+		if immutable {
+			flag = 1
+		}
+		c.emit(opDeclare, c.node(name), c.node(n), flag)
+	} else if _, ok := c.blocks[len(c.blocks)-1][name.Value]; ok {
+		return c.unsupported(n)
+	} else {
+		c.emit(opDefine, c.declare(name.Value, immutable), c.constant(&runtime.TString{Value: name.Value}))
+	}
+	if !used {
+		c.emit(opPop)
+	}
+	return true
+}
+
+func (c *compiler) assign(na *ast.Assign) bool {
+	name, ok := na.Name.(*ast.Identifier)
+	if !ok {
+		return c.unsupported(na)
+	}
+	found, isLocal := c.resolve(name.Value)
+	if isLocal && found.immutable {
+		return c.unsupported(na)
+	}
+	if !isLocal {
+		c.emit(opAssignable, c.node(na), len(c.blocks))
+	}
+	if !c.expression(na.Right) {
+		return false
+	}
+	if isLocal {
+		c.emit(opAssignLocal, found.slot, c.node(na))
+	} else {
+		c.emit(opAssignFree, c.node(na), len(c.blocks))
+	}
+	return true
+}
+
+func (c *compiler) infix(ni *ast.InfixExpression) bool {
+	if !c.expression(ni.Left) {
+		return false
+	}
+	shortCircuit := -1
+	switch ni.Operator {
+	case token.LogicalAnd:
+		shortCircuit = c.emit(opAnd, 0)
+	case token.LogicalOr:
+		shortCircuit = c.emit(opOr, 0)
+	}
+	if !c.expression(ni.Right) {
+		return false
+	}
+	if op, ok := arithmetic[ni.Operator]; ok {
+		c.emit(op, c.node(ni))
+	} else {
+		c.emit(opInfix, c.node(ni))
+	}
+	if shortCircuit >= 0 {
+		c.patch(shortCircuit, len(c.chunk.code))
+	}
+	return true
+}
+
+func (c *compiler) call(nf *ast.FunctionCall) bool {
+	callee, builtin := nf.Function.(*ast.Identifier)
+	if builtin {
+		if _, builtin = runtime.FnRuntime[callee.Value]; builtin {
+			if _, ok := c.resolve(callee.Value); ok {
+				return c.unsupported(nf)
+			}
+		}
+	}
+	if !builtin && !c.expression(nf.Function) {
+		return false
+	}
+	for _, argument := range nf.Arguments.Elements {
+		if !c.expression(argument) {
+			return false
+		}
+	}
+	if builtin {
+		c.emit(opRuntimeCall, len(nf.Arguments.Elements), c.node(nf))
+	} else {
+		c.emit(opCall, len(nf.Arguments.Elements), c.node(nf))
+	}
+	return true
+}
+
+func (c *compiler) ifExpression(ni *ast.If, used bool) bool {
+	if !c.expression(ni.Condition) {
+		return false
+	}
+	otherwise := c.emit(opJumpIfFalse, 0)
+	c.openBlock()
+	ok := c.statements(ni.Then, used)
+	c.closeBlock()
+	if !ok {
+		return false
+	}
+	end := c.emit(opJump, 0)
+	c.patch(otherwise, len(c.chunk.code))
+	if ni.Else != nil {
+		c.openBlock()
+		ok = c.statements(ni.Else, used)
+		c.closeBlock()
+		if !ok {
+			return false
+		}
+	} else if used {
+		c.emit(opNil)
+	}
+	c.patch(end, len(c.chunk.code))
+	return true
+}
+
+func (c *compiler) repeat(nr *ast.Repeat) bool {
+	arguments := nr.Arguments.Elements
+	if nr.Pattern != nil || len(arguments) > 2 || (nr.Enumerable != nil && len(arguments) == 0) {
+		return c.unsupported(nr)
+	}
+	c.openBlock()
+	defer c.closeBlock()
+	current := &loop{}
+	c.loops = append(c.loops, current)
+	defer func() {
+		c.loops = c.loops[:len(c.loops)-1]
+	}()
+	node := c.node(nr)
+	start := len(c.chunk.code)
+	next := -1
+	if nr.Enumerable != nil {
+		if !c.expression(nr.Enumerable) {
+			return false
+		}
+		c.emit(opIterate, node)
+		index := 0
+		if len(arguments) == 2 {
+			if arguments[0].Value == arguments[1].Value {
+				return c.unsupported(nr)
+			}
+			index = c.declare(arguments[0].Value, false) + 1
+		}
+		value := c.declare(arguments[len(arguments)-1].Value, false)
+		start = len(c.chunk.code)
+		next = c.emit(opNext, 0, value, index)
+	}
+	if !c.statements(nr.Body, false) {
+		return false
+	}
+	for _, jump := range current.continues {
+		c.patch(jump, len(c.chunk.code))
+	}
+	c.emit(opLoop, start, node)
+	if next >= 0 {
+		c.patch(next, len(c.chunk.code))
+	}
+	for _, jump := range current.breaks {
+		c.patch(jump, len(c.chunk.code))
+	}
+	if next >= 0 {
+		c.emit(opEndIterate)
+	}
+	return true
+}
+
+func (c *compiler) jump(n ast.Node, continues, used bool) bool {
+	if used || len(c.loops) == 0 {
+		return c.unsupported(n)
+	}
+	current := c.loops[len(c.loops)-1]
+	position := c.emit(opJump, 0)
+	if continues {
+		current.continues = append(current.continues, position)
+	} else {
+		current.breaks = append(current.breaks, position)
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package interpreter implements functions to enum types.
+package interpreter
+
+import (
+	"fmt"
+	"github.com/luiscm/oro/ast"
+	"github.com/luiscm/oro/rerror"
+	"github.com/luiscm/oro/runtime"
+	"github.com/luiscm/oro/token"
+)
+
+func (i *Interpreter) Enum(ne *ast.Enum, sc *runtime.Scope) runtime.Data {
+	name := ne.Name.Value
+	if !i.declareType(ne, "Enum", ne.Name, sc) {
+		return nil
+	}
+	definition := &runtime.TEnumType{Name: name}
+	for _, variant := range ne.Variants {
+		variantType := &runtime.TVariantType{Enum: definition, Name: variant.Name.Value}
+		for _, field := range variant.Fields {
+			variantType.Fields = append(variantType.Fields, field.Name.Value)
+			if field.Type != nil {
+				variantType.Types = append(variantType.Types, field.Type.Value)
+			} else {
+				variantType.Types = append(variantType.Types, "")
+			}
+		}
+		definition.Variants = append(definition.Variants, variantType)
+	}
+	i.bindType(ne, ne.Name, definition, sc)
+	return definition
+}
+
+func (i *Interpreter) variant(n ast.Node, definition *runtime.TEnumType, name string) runtime.Data {
+	variant := definition.Variant(name)
+	if variant == nil {
+		var variants []string
+		for _, v := range definition.Variants {
+			variants = append(variants, v.Name)
+		}
+		i.interpreterErrorHint(n, fmt.Sprintf("Variant '%s' not found in enum '%s'", name, definition.Name), rerror.Suggest(name, variants))
+		return nil
+	}
+	if len(variant.Fields) == 0 {
+		return &runtime.TVariant{Variant: variant}
+	}
+	return variant
+}
+
+func (i *Interpreter) ConstructVariant(n ast.Node, variant *runtime.TVariantType, arguments []runtime.Data) runtime.Data {
+	if len(arguments) != len(variant.Fields) {
+		i.interpreterError(n, fmt.Sprintf("Variant '%s' expects %d fields but got %d", variant.Enum.Name+token.Dot+variant.Name, len(variant.Fields), len(arguments)))
+		return nil
+	}
+	owner := "variant '" + variant.Enum.Name + token.Dot + variant.Name + "'"
+	for idx, value := range arguments {
+		if err := i.checkFieldType(owner, variant.Fields[idx], variant.Types[idx], value); err != nil {
+			i.fail(n, err)
+			return nil
+		}
+	}
+	values := make([]runtime.Data, len(arguments))
+	copy(values, arguments)
+	return &runtime.TVariant{Variant: variant, Values: values}
+}
+
+// missingVariants returns the variants of an enum that no when covers for
+// every payload. A when without guard covers a variant when all of its fields
+// are bound or ignored.
+func (i *Interpreter) missingVariants(whens []*ast.MatchWhen, definition *runtime.TEnumType, sc *runtime.Scope) []string {
+	covered := map[*runtime.TVariantType]bool{}
+	for _, ws := range whens {
+		if ws.Guard != nil {
+			continue
+		}
+		for _, element := range ws.Values.Elements {
+			arguments, variant, ok := i.variantPattern(element, sc)
+			if !ok || variant.Enum != definition {
+				continue
+			}
+			irrefutable := true
+			for _, argument := range arguments {
+				switch argument.(type) {
+				case *ast.Identifier, *ast.PlaceHolder:
+				default:
+					irrefutable = false
+				}
+			}
+			if irrefutable {
+				covered[variant] = true
+			}
+		}
+	}
+	var missing []string
+	for _, variant := range definition.Variants {
+		if !covered[variant] {
+			missing = append(missing, definition.Name+token.Dot+variant.Name)
+		}
+	}
+	return missing
+}
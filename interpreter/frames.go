@@ -0,0 +1,123 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package interpreter implements functions to call stack.
+package interpreter
+
+import (
+	"github.com/luiscm/oro/ast"
+	"github.com/luiscm/oro/rerror"
+	"github.com/luiscm/oro/runtime"
+	"github.com/luiscm/oro/runtime/stdlib"
+	"github.com/luiscm/oro/token"
+	"strings"
+)
+
+const (
+	mainFrame      = "<main>"
+	anonymousFrame = "<fn>"
+	maxTailFrames  = 16
+)
+
+type frame struct {
+	name string
+	call token.Position
+}
+
+type tailCall struct {
+	node      ast.Node
+	function  *runtime.TFunction
+	arguments []runtime.Data
+	scope     *runtime.Scope
+}
+
+func (t *tailCall) Type() string {
+	return runtime.TTFunction
+}
+
+func (t *tailCall) Check() string {
+	return t.function.Check()
+}
+
+type returnCheck struct {
+	node     ast.Node
+	expected string
+}
+
+func addReturnCheck(pending []returnCheck, n ast.Node, expected string) []returnCheck {
+	for _, check := range pending {
+		if check.expected == expected {
+			return pending
+		}
+	}
+	return append(pending, returnCheck{node: n, expected: expected})
+}
+
+func (i *Interpreter) pushFrame(name string, n ast.Node) {
+	i.frames = append(i.frames, frame{name: name, call: n.TokenPosition()})
+}
+
+func (i *Interpreter) trace(n ast.Node) []rerror.Frame {
+	position := n.TokenPosition()
+	var trace []rerror.Frame
+	for idx := len(i.frames) - 1; idx >= 0; idx-- {
+		trace = append(trace, rerror.Frame{Name: i.frames[idx].name, File: position.File, Row: position.Row, Col: position.Col})
+		position = i.frames[idx].call
+	}
+	return append(trace, rerror.Frame{Name: mainFrame, File: position.File, Row: position.Row, Col: position.Col})
+}
+
+func (i *Interpreter) nameFunction(data runtime.Data, name string) {
+	if function, ok := data.(*runtime.TFunction); ok && function.Name == "" {
+		function.Name = name
+	}
+}
+
+func (i *Interpreter) callName(n ast.Node) string {
+	if call, ok := n.(*ast.FunctionCall); ok {
+		switch function := call.Function.(type) {
+		case *ast.Identifier:
+			return function.Value
+		case *ast.ModuleAccess:
+			return function.Object.Value + token.Dot + function.Parameter.Value
+		}
+	}
+	return anonymousFrame
+}
+
+func (i *Interpreter) raise(n ast.Node, err *runtime.TError) {
+	if err.Stack == nil {
+		err.Stack = i.trace(n)
+	}
+	i.interpreterError(n, err.Message)
+	i.raised = err
+	i.raisedAt = i.diagnostics.Len() - 1
+}
+
+func userFrame(stack []rerror.Frame) (rerror.Frame, bool) {
+	for _, frame := range stack {
+		if _, ok := stdlib.Source(frame.File); !ok {
+			return frame, true
+		}
+	}
+	return rerror.Frame{}, false
+}
+
+func (i *Interpreter) raisedError(index int) *runtime.TError {
+	d := i.diagnostics.Errors()[index]
+	if i.raised != nil && i.raisedAt == index {
+		return i.raised
+	}
+	kind := strings.ToLower(strings.Fields(string(d.Kind))[0])
+	stack := d.Trace
+	if stack == nil {
+		stack = []rerror.Frame{{Name: mainFrame, File: d.File, Row: d.Row, Col: d.Col}}
+	}
+	return &runtime.TError{
+		Kind:    kind,
+		Message: d.Message,
+		Tag:     &runtime.TSymbol{Value: kind},
+		Payload: runtime.Nil,
+		Stack:   stack,
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package interpreter implements functions to generators.
+package interpreter
+
+import (
+	"fmt"
+	"github.com/luiscm/oro/ast"
+	"github.com/luiscm/oro/runtime"
+)
+
+// generator runs the body of a generator function on its own goroutine. The
+// generator and its consumer hand the interpreter to each other over the
+// channels, so only one of them runs at a time.
+type generator struct {
+	interpreter *Interpreter
+	body        *ast.BlockStatement
+	scope       *runtime.Scope
+	frames      []frame
+	depth       int
+	resume      chan bool
+	yielded     chan runtime.Data
+	started     bool
+	done        bool
+	stopped     bool
+	err         error
+}
+
+func (i *Interpreter) sequence(n ast.Node, function *runtime.TFunction, name string, scope *runtime.Scope) *runtime.TSequence {
+	frames := append(append([]frame{}, i.frames...), frame{name: name, call: n.TokenPosition()})
+	depth := i.depth
+	return &runtime.TSequence{
+		Name: name,
+		Iterate: func() runtime.Iterator {
+			fnScope := scope.Copy()
+			return &generator{
+				interpreter: i,
+				body:        function.Body,
+				scope:       fnScope,
+				frames:      append([]frame{}, frames...),
+				depth:       depth,
+				resume:      make(chan bool),
+				yielded:     make(chan runtime.Data),
+			}
+		},
+	}
+}
+
+func (g *generator) Next() (runtime.Data, bool) {
+	if g.done {
+		return nil, false
+	}
+	if !g.started {
+		g.started = true
+		go g.run()
+	}
+	var value runtime.Data
+	var ok bool
+	g.switchTo(func() {
+		g.resume <- true
+		value, ok = <-g.yielded
+	})
+	if !ok {
+		g.done = true
+		return nil, false
+	}
+	return value, true
+}
+
+func (g *generator) Stop() {
+	if !g.started || g.done {
+		g.done = true
+		return
+	}
+	g.done = true
+	g.switchTo(func() {
+		checkpoint := g.interpreter.diagnostics.Len()
+		g.stopped = true
+		g.resume <- false
+		for range g.yielded {
+		}
+		g.interpreter.diagnostics.Truncate(checkpoint)
+	})
+}
+
+func (g *generator) Err() error {
+	return g.err
+}
+
+func (g *generator) run() {
+	defer close(g.yielded)
+	if !<-g.resume {
+		return
+	}
+	if g.interpreter.Interpreter(g.body, g.scope) == nil && !g.stopped {
+		g.err = runtime.ErrReported
+	}
+}
+
+func (g *generator) yield(value runtime.Data) runtime.Data {
+	if g.stopped {
+		return nil
+	}
+	g.yielded <- value
+	if !<-g.resume {
+		return nil
+	}
+	return runtime.Nil
+}
+
+func (g *generator) switchTo(run func()) {
+	i := g.interpreter
+	frames, depth, current := i.frames, i.depth, i.generator
+	i.frames, i.depth, i.generator = g.frames, g.depth, g
+	run()
+	g.frames, g.depth = i.frames, i.depth
+	i.frames, i.depth, i.generator = frames, depth, current
+}
+
+func (i *Interpreter) Yield(ny *ast.Yield, sc *runtime.Scope) runtime.Data {
+	if i.generator == nil {
+		i.interpreterError(ny, "YIELD outside of a generator")
+		return nil
+	}
+	var value runtime.Data = runtime.Nil
+	if ny.Value != nil {
+		if value = i.Interpreter(ny.Value, sc); value == nil {
+			return nil
+		}
+	}
+	return i.generator.yield(value)
+}
+
+func (i *Interpreter) ForSequence(nr *ast.Repeat, sequence *runtime.TSequence, sc *runtime.Scope) runtime.Data {
+	return i.forIterator(nr, "a sequence", sequence.Iterate(), sc)
+}
+
+func (i *Interpreter) forIterator(nr *ast.Repeat, kind string, iterator runtime.Iterator, sc *runtime.Scope) runtime.Data {
+	defer iterator.Stop()
+	for index := 0; ; index++ {
+		value, ok := iterator.Next()
+		if !ok {
+			break
+		}
+		newScope := runtime.NewScopeFrom(sc)
+		switch i.loopArguments(nr) {
+		case 1:
+			if !i.loopValue(nr, value, sc, newScope) {
+				return nil
+			}
+		case 2:
+			bind(nr.Arguments.Elements[0], newScope, &runtime.TInteger{Value: int64(index)}, false)
+			if !i.loopValue(nr, value, sc, newScope) {
+				return nil
+			}
+		default:
+			i.interpreterError(nr, fmt.Sprintf("A for loop with %s expects at most 2 arguments", kind))
+			return nil
+		}
+		result := i.Interpreter(nr.Body, newScope)
+		if result == nil {
+			return nil
+		}
+		if result.Type() == runtime.TTBreak {
+			break
+		} else if result.Type() == runtime.TTContinue {
+			continue
+		} else if result.Type() == runtime.TTReturn {
+			return result
+		}
+	}
+	if iterator.Err() != nil {
+		return nil
+	}
+	return runtime.Nil
+}
@@ -5,11 +5,14 @@
 package interpreter
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/luiscm/oro/ast"
 	"github.com/luiscm/oro/lexer"
 	"github.com/luiscm/oro/parser"
 	"github.com/luiscm/oro/rerror"
+	"github.com/luiscm/oro/resolver"
 	"github.com/luiscm/oro/runtime"
 	"github.com/luiscm/oro/runtime/stdlib"
 	"github.com/luiscm/oro/token"
@@ -17,39 +20,115 @@ import (
 	"io/ioutil"
 	"math"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 )
 
 type Interpreter struct {
 	modules     map[string]*runtime.TModule
+	types       map[string]ast.Node
 	moduleCache map[string]map[string]runtime.Data
 	useCache    map[string]runtime.Data
-	immutable   map[string]*ast.Identifier
-	useStdlib   bool
+	natives     map[string]*runtime.TNativeFunction
+	ctx         context.Context
+	limits      Limits
+	steps       int64
+	depth       int
+	halted      error
+	lock        sync.Mutex
+	running     bool
+	group       *taskGroup
+	tasks       int
+	blocked     int
+	frames      []frame
+	generator   *generator
+	raised      *runtime.TError
+	raisedAt    int
+	engine      Engine
+	chunks      map[*ast.BlockStatement]*chunk
+	fallbacks   map[string]int
+	diagnostics *rerror.Diagnostics
 }
 
 func New() *Interpreter {
-	return &Interpreter{
+	i := &Interpreter{
 		modules:     map[string]*runtime.TModule{},
+		types:       map[string]ast.Node{},
 		moduleCache: map[string]map[string]runtime.Data{},
 		useCache:    map[string]runtime.Data{},
-		immutable:   map[string]*ast.Identifier{},
-		useStdlib:   false,
+		natives:     map[string]*runtime.TNativeFunction{},
+		ctx:         context.Background(),
+		engine:      defaultEngine,
+		chunks:      map[*ast.BlockStatement]*chunk{},
+		fallbacks:   map[string]int{},
+		group:       newTaskGroup(),
+		diagnostics: rerror.NewDiagnostics(),
+	}
+	i.lock.Lock()
+	i.useStdLibModules()
+	return i
+}
+
+func (i *Interpreter) Diagnostics() *rerror.Diagnostics {
+	return i.diagnostics
+}
+
+func (i *Interpreter) SetContext(ctx context.Context) {
+	i.ctx = ctx
+}
+
+func (i *Interpreter) RegisterFunction(name string, fn runtime.TNativeFn) {
+	i.natives[name] = &runtime.TNativeFunction{Name: name, Fn: fn}
+}
+
+func (i *Interpreter) Native(name string) runtime.Data {
+	if native, ok := i.natives[name]; ok {
+		return native
 	}
+	return nil
+}
+
+func (i *Interpreter) RegisterModule(name string, members map[string]runtime.Data) error {
+	if _, ok := i.modules[name]; ok {
+		return rerror.ErrorFmt("Module '%s' redeclared", name)
+	}
+	results := map[string]runtime.Data{}
+	for member, value := range members {
+		if native, ok := value.(*runtime.TNativeFunction); ok && native.Name == "" {
+			named := *native
+			named.Name = name + token.Dot + member
+			value = &named
+		}
+		results[member] = value
+	}
+	i.modules[name] = &runtime.TModule{
+		Name: &ast.Identifier{Token: token.Token{Type: token.Identifier, Literal: name}, Value: name},
+		Body: &ast.BlockStatement{},
+	}
+	i.moduleCache[name] = results
+	return nil
 }
 
 func (i *Interpreter) Interpreter(ni ast.Node, sc *runtime.Scope) runtime.Data {
-	if err := i.useStdLibModules(sc); err != nil {
-		i.interpreterError(ni, err.Error())
+	if !i.step(ni) {
+		return nil
+	}
+	result := i.dispatch(ni, sc)
+	if result == nil || !i.checkDataSize(ni, result) {
 		return nil
 	}
+	return result
+}
+
+func (i *Interpreter) dispatch(ni ast.Node, sc *runtime.Scope) runtime.Data {
 	switch ni := ni.(type) {
 	case *ast.Program:
 		return i.Program(ni, sc)
 	case *ast.Boolean:
 		return i.nativeToBoolean(ni.Value)
 	case *ast.String:
-		return &runtime.TString{Value: ni.Value}
+		return i.String(ni, sc)
 	case *ast.Integer:
 		return &runtime.TInteger{Value: ni.Value}
 	case *ast.Float:
@@ -76,22 +155,36 @@ func (i *Interpreter) Interpreter(ni ast.Node, sc *runtime.Scope) runtime.Data {
 		return i.Repeat(ni, sc)
 	case *ast.Match:
 		return i.Match(ni, sc)
+	case *ast.Try:
+		return i.Try(ni, sc)
 	case *ast.Break:
 		return &runtime.TBreak{}
 	case *ast.Continue:
 		return &runtime.TContinue{}
 	case *ast.Return:
 		return &runtime.TReturn{Value: i.Interpreter(ni.Value, sc)}
+	case *ast.Yield:
+		return i.Yield(ni, sc)
+	case *ast.Spawn:
+		return i.Spawn(ni, sc)
+	case *ast.Await:
+		return i.Await(ni, sc)
+	case *ast.Select:
+		return i.Select(ni, sc)
 	case *ast.Pipe:
 		return i.Pipe(ni, sc)
 	case *ast.PlaceHolder:
 		return &runtime.TPlaceHolder{}
+	case *ast.BadExpression:
+		i.interpreterError(ni, "Cannot run an expression that failed to parse")
+		return nil
 	case *ast.Function:
 		return &runtime.TFunction{
 			Parameters: ni.Parameters,
 			Body:       ni.Body,
 			ReturnType: ni.ReturnType,
 			Variadic:   ni.Variadic,
+			Generator:  ni.Generator,
 			Scope:      runtime.NewScopeFrom(sc),
 		}
 	case *ast.FunctionCall:
@@ -100,6 +193,12 @@ func (i *Interpreter) Interpreter(ni ast.Node, sc *runtime.Scope) runtime.Data {
 		return i.Module(ni, sc)
 	case *ast.ModuleAccess:
 		return i.ModuleAccess(ni, sc)
+	case *ast.Struct:
+		return i.Struct(ni, sc)
+	case *ast.Enum:
+		return i.Enum(ni, sc)
+	case *ast.FieldAccess:
+		return i.FieldAccess(ni, sc)
 	case *ast.Subscript:
 		return i.Subscript(ni, sc)
 	case *ast.Use:
@@ -116,31 +215,50 @@ func (i *Interpreter) Interpreter(ni ast.Node, sc *runtime.Scope) runtime.Data {
 		return i.PrefixExpression(ni, sc)
 	case *ast.InfixExpression:
 		return i.InfixExpression(ni, sc)
+	case *ast.TypePattern, *ast.RestPattern:
+		i.interpreterError(ni, "Patterns can only be used in a MATCH WHEN")
 	}
 	return nil
 }
 
-func (i *Interpreter) useStdLibModules(sc *runtime.Scope) error {
-	if i.useStdlib {
-		return nil
-	}
-	i.useStdlib = true
+func (i *Interpreter) useStdLibModules() {
+	sc := runtime.NewScope()
 	for _, module := range stdlib.Modules {
-		lex := lexer.New([]byte(module))
-		if rerror.HasErrors() {
-			return rerror.ErrorFmt("Problem reading Standard Library module")
-		}
+		lex := lexer.New(stdlib.FileName(module), []byte(module))
 		parse := parser.New(lex)
 		program := parse.Parse()
-		if rerror.HasErrors() {
-			return rerror.ErrorFmt("Problem parsing Standard Library module")
+		if parse.Diagnostics().HasErrors() {
+			i.diagnostics.Merge(parse.Diagnostics())
+			continue
 		}
-		i.Interpreter(program, sc)
+		// The modules only declare modules, so they always walk the tree.
+		i.program(program, sc, EngineTree)
 	}
-	return nil
 }
 
 func (i *Interpreter) Program(np *ast.Program, sc *runtime.Scope) runtime.Data {
+	return i.program(np, sc, i.engine)
+}
+
+func (i *Interpreter) program(np *ast.Program, sc *runtime.Scope, engine Engine) runtime.Data {
+	if i.enterRun() {
+		defer i.exitRun()
+	}
+	var natives []string
+	for name := range i.natives {
+		natives = append(natives, name)
+	}
+	resolve := resolver.New(sc, natives)
+	resolve.Resolve(np)
+	if resolve.Diagnostics().HasErrors() {
+		i.diagnostics.Merge(resolve.Diagnostics())
+		return nil
+	}
+	if engine == EngineVM {
+		if code := i.compileProgram(np); code != nil {
+			return i.runProgram(code, np, sc)
+		}
+	}
 	var result runtime.Data
 	for _, statement := range np.Statements {
 		result = i.Interpreter(statement, sc)
@@ -153,14 +271,18 @@ func (i *Interpreter) Val(nl *ast.Val, sc *runtime.Scope) runtime.Data {
 	if data == nil {
 		return nil
 	}
-	if _, ok := sc.Read(nl.Name.Value); ok {
+	if nl.Pattern != nil {
+		if !i.declarePattern(nl, nl.Pattern, data, sc, true) {
+			return nil
+		}
+		return data
+	}
+	if declared(nl.Name, sc) {
 		i.interpreterError(nl, fmt.Sprintf("Identifier '%s' already declared", nl.Name.Value))
 		return nil
 	}
-	sc.Write(nl.Name.Value, data)
-	if _, ok := i.immutable[nl.Name.Value]; !ok {
-		i.immutable[nl.Name.Value] = nl.Name
-	}
+	i.nameFunction(data, nl.Name.Value)
+	bind(nl.Name, sc, data, true)
 	return data
 }
 
@@ -169,17 +291,53 @@ func (i *Interpreter) Var(nv *ast.Var, sc *runtime.Scope) runtime.Data {
 	if data == nil {
 		return nil
 	}
-	if _, ok := sc.Read(nv.Name.Value); ok {
+	if nv.Pattern != nil {
+		if !i.declarePattern(nv, nv.Pattern, data, sc, false) {
+			return nil
+		}
+		return data
+	}
+	if declared(nv.Name, sc) {
 		i.interpreterError(nv, fmt.Sprintf("Identifier '%s' already declared", nv.Name.Value))
 		return nil
 	}
-	sc.Write(nv.Name.Value, data)
+	i.nameFunction(data, nv.Name.Value)
+	bind(nv.Name, sc, data, false)
 	return data
 }
 
+func (i *Interpreter) declarePattern(n ast.Node, pattern ast.Expression, data runtime.Data, sc *runtime.Scope, immutable bool) bool {
+	bound, names, err := i.destructure(pattern, data, sc)
+	if err != nil {
+		i.interpreterError(n, err.Error())
+		return false
+	}
+	for _, name := range names {
+		if declared(name, sc) {
+			i.interpreterError(n, fmt.Sprintf("Identifier '%s' already declared", name.Value))
+			return false
+		}
+	}
+	for _, name := range names {
+		value, _ := read(name, bound, 0)
+		i.nameFunction(value, name.Value)
+		bind(name, sc, value, immutable)
+	}
+	return true
+}
+
 func (i *Interpreter) Module(nm *ast.Module, sc *runtime.Scope) runtime.Data {
-	if _, ok := i.modules[nm.Name.Value]; ok {
-		i.interpreterError(nm, fmt.Sprintf("Module '%s' redeclared", nm.Name.Value))
+	if module, ok := i.modules[nm.Name.Value]; ok {
+		position := module.Name.TokenPosition()
+		i.diagnostics.Add(rerror.Diagnostic{
+			Kind:    rerror.Runtime,
+			File:    nm.TokenPosition().File,
+			Row:     nm.TokenPosition().Row,
+			Col:     nm.TokenPosition().Col,
+			Span:    len(nm.TokenLiteral()),
+			Message: fmt.Sprintf("Module '%s' redeclared", nm.Name.Value),
+			Related: &rerror.Note{File: position.File, Row: position.Row, Col: position.Col, Message: "First declared here"},
+		})
 	} else {
 		i.modules[nm.Name.Value] = &runtime.TModule{Name: nm.Name, Body: nm.Body}
 	}
@@ -204,6 +362,15 @@ func (i *Interpreter) ModuleAccess(na *ast.ModuleAccess, sc *runtime.Scope) runt
 						if result == nil {
 							return nil
 						}
+						if eType.Pattern != nil {
+							for _, name := range i.patternNames(eType.Pattern, newScope, nil) {
+								results[name.Value], _ = read(name, newScope, 0)
+							}
+							continue
+						}
+						if function, ok := result.(*runtime.TFunction); ok && function.Name == eType.Name.Value {
+							function.Name = module.Name.Value + token.Dot + eType.Name.Value
+						}
 						results[eType.Name.Value] = result
 					default:
 						i.interpreterError(na, "Only Val statements are accepted as Module members")
@@ -217,21 +384,46 @@ func (i *Interpreter) ModuleAccess(na *ast.ModuleAccess, sc *runtime.Scope) runt
 			i.moduleCache[module.Name.Value] = results
 			if val, ok := i.moduleCache[module.Name.Value][na.Parameter.Value]; ok {
 				return val
-			} else {
-				i.interpreterError(na, fmt.Sprintf("Member '%s' in module '%s' not found", na.Parameter.Value, na.Object.Value))
-				return nil
 			}
 		}
+		var members []string
+		for name := range i.moduleCache[module.Name.Value] {
+			members = append(members, module.Name.Value+token.Dot+name)
+		}
+		i.interpreterErrorHint(na, fmt.Sprintf("Member '%s' in module '%s' not found", na.Parameter.Value, na.Object.Value),
+			rerror.Suggest(na.Object.Value+token.Dot+na.Parameter.Value, members))
+		return nil
+	}
+	if data, ok := read(na.Object, sc, na.Object.Depth); ok {
+		return i.member(na, data, na.Parameter.Value)
 	}
-	i.interpreterError(na, fmt.Sprintf("%s.%s not found", na.Object.Value, na.Parameter.Value))
+	var modules []string
+	for name := range i.modules {
+		modules = append(modules, name)
+	}
+	i.interpreterErrorHint(na, fmt.Sprintf("%s.%s not found", na.Object.Value, na.Parameter.Value), rerror.Suggest(na.Object.Value, modules))
 	return nil
 }
 
 func (i *Interpreter) Identifier(ni *ast.Identifier, sc *runtime.Scope) runtime.Data {
-	if data, ok := sc.Read(ni.Value); ok {
+	return i.identifier(ni, sc, ni.Depth)
+}
+
+func (i *Interpreter) identifier(ni *ast.Identifier, sc *runtime.Scope, depth int) runtime.Data {
+	if data, ok := read(ni, sc, depth); ok {
 		return data
 	}
-	i.interpreterError(ni, fmt.Sprintf("Identifier '%s' not found in current memory", ni.Value))
+	if native, ok := i.natives[ni.Value]; ok {
+		return native
+	}
+	names := sc.Names()
+	for name := range i.natives {
+		names = append(names, name)
+	}
+	for name := range runtime.FnRuntime {
+		names = append(names, name)
+	}
+	i.interpreterErrorHint(ni, fmt.Sprintf("Identifier '%s' not found in current memory", ni.Value), rerror.Suggest(ni.Value, names))
 	return nil
 }
 
@@ -251,20 +443,28 @@ func (i *Interpreter) BlockStatement(nb *ast.BlockStatement, sc *runtime.Scope)
 
 func (i *Interpreter) Assign(na *ast.Assign, sc *runtime.Scope) runtime.Data {
 	var original runtime.Data
-	var name string
+	var target *ast.Identifier
 	var ok bool
 	var err error
 	switch naType := na.Name.(type) {
 	case *ast.Identifier:
-		name = naType.Value
+		target = naType
 	case *ast.Subscript:
-		name = naType.Left.(*ast.Identifier).Value
+		target = naType.Left.(*ast.Identifier)
+	case *ast.ModuleAccess:
+		target = naType.Object
+	case *ast.FieldAccess:
+		if target, ok = i.assignRoot(naType); !ok {
+			i.interpreterError(na, "Assignment operator expects an identifier")
+			return nil
+		}
 	}
-	if original, ok = sc.Read(name); !ok {
+	name := target.Value
+	if original, ok = read(target, sc, target.Depth); !ok {
 		i.interpreterError(na, fmt.Sprintf("Identifier '%s' not found in current memory", name))
 		return nil
 	}
-	if _, ok = i.immutable[name]; ok {
+	if immutable(target, sc, target.Depth) {
 		i.interpreterError(na, fmt.Sprintf("Identifier '%s' is immutable", name))
 		return nil
 	}
@@ -279,15 +479,78 @@ func (i *Interpreter) Assign(na *ast.Assign, sc *runtime.Scope) runtime.Data {
 			i.interpreterError(na, err.Error())
 			return nil
 		}
+	case *ast.ModuleAccess, *ast.FieldAccess:
+		data, err = i.AssignField(naType, original, data, sc)
+		if err != nil {
+			i.fail(na, err)
+			return nil
+		}
+		if data == nil {
+			return nil
+		}
 	}
 	if data.Type() != original.Type() {
-		i.interpreterError(na, fmt.Sprintf("Variable assignment should keep the original data type '%s'", original.Type()))
+		i.typeError(na, fmt.Sprintf("Variable assignment should keep the original data type '%s'", original.Type()))
 		return nil
 	}
-	sc.Update(name, data)
+	update(target, sc, target.Depth, data)
 	return data
 }
 
+func read(ni *ast.Identifier, sc *runtime.Scope, depth int) (runtime.Data, bool) {
+	if ni.Resolved {
+		return sc.ReadAt(depth, ni.Slot)
+	}
+	return sc.Read(ni.Value)
+}
+
+func immutable(ni *ast.Identifier, sc *runtime.Scope, depth int) bool {
+	if ni.Resolved {
+		return sc.ImmutableAt(depth, ni.Slot)
+	}
+	return sc.Immutable(ni.Value)
+}
+
+func update(ni *ast.Identifier, sc *runtime.Scope, depth int, value runtime.Data) {
+	if ni.Resolved {
+		sc.UpdateAt(depth, ni.Slot, value)
+	} else {
+		sc.Update(ni.Value, value)
+	}
+}
+
+func bind(ni *ast.Identifier, sc *runtime.Scope, value runtime.Data, immutable bool) {
+	if ni.Resolved {
+		sc.DeclareAt(ni.Slot, ni.Value, value, immutable)
+	} else {
+		sc.Declare(ni.Value, value, immutable)
+	}
+}
+
+func declared(ni *ast.Identifier, sc *runtime.Scope) bool {
+	if ni.Resolved {
+		return sc.DeclaredAt(ni.Slot)
+	}
+	return sc.Declared(ni.Value)
+}
+
+func (i *Interpreter) assignRoot(target ast.Expression) (*ast.Identifier, bool) {
+	for {
+		switch node := target.(type) {
+		case *ast.Identifier:
+			return node, true
+		case *ast.ModuleAccess:
+			return node.Object, true
+		case *ast.FieldAccess:
+			target = node.Object
+		case *ast.Subscript:
+			target = node.Left
+		default:
+			return nil, false
+		}
+	}
+}
+
 func (i *Interpreter) AssignSubscript(ns *ast.Subscript, original runtime.Data, value runtime.Data, sc *runtime.Scope) (runtime.Data, error) {
 	index := i.Interpreter(ns.Index, sc)
 	if index == nil {
@@ -307,54 +570,84 @@ func (i *Interpreter) AssignSubscript(ns *ast.Subscript, original runtime.Data,
 		array := original.(*runtime.TArray)
 		if index.Type() == runtime.TTInteger {
 			idx := index.(*runtime.TInteger).Value
-			idx, err := i.checkArrayBounds(array.Elements, idx)
+			idx, err := i.checkArrayBounds(array.Len(), idx)
 			if err != nil {
 				return nil, err
 			}
-			array.Elements[idx] = value
-		} else {
-			array.Elements = append(array.Elements, value)
+			return array.Set(int(idx), value), nil
 		}
-		return array, nil
+		return array.Append(value), nil
 	case original.Type() == runtime.TTDictionary:
-		dictionary := original.(*runtime.TDictionary)
-		foundDict := false
-		for k := range dictionary.Pairs {
-			if k.Check() == index.Check() {
-				dictionary.Pairs[k] = value
-				foundDict = true
-				break
-			}
-		}
-		if !foundDict {
-			dictionary.Pairs[index] = value
-		}
-		return dictionary, nil
+		return original.(*runtime.TDictionary).Set(index, value), nil
 	default:
 		return nil, rerror.ErrorFmt("Subscript assignment not recognized")
 	}
 }
 
+func (i *Interpreter) String(ns *ast.String, sc *runtime.Scope) runtime.Data {
+	if len(ns.Interpolated) == 0 {
+		return &runtime.TString{Value: ns.Value}
+	}
+	var out bytes.Buffer
+	for idx := 0; idx < len(ns.Value); {
+		text, expression := i.interpolationAt(ns, idx)
+		if expression == nil {
+			out.WriteByte(ns.Value[idx])
+			idx++
+			continue
+		}
+		value := i.Interpreter(expression, sc)
+		if value == nil {
+			return nil
+		}
+		out.WriteString(value.Check())
+		idx += len(text)
+	}
+	return &runtime.TString{Value: out.String()}
+}
+
+// interpolationAt returns the text and the expression of the interpolation
+// starting at idx. An escaped "\#{" is kept as text, so only the offsets
+// where the lexer found an interpolation are looked at.
+func (i *Interpreter) interpolationAt(ns *ast.String, idx int) (string, ast.Expression) {
+	at := sort.SearchInts(ns.Starts, idx)
+	if at == len(ns.Starts) || ns.Starts[at] != idx {
+		return "", nil
+	}
+	for text, expression := range ns.Interpolated {
+		if strings.HasPrefix(ns.Value[idx:], text) {
+			return text, expression
+		}
+	}
+	return "", nil
+}
+
 func (i *Interpreter) Array(na *ast.Array, sc *runtime.Scope) runtime.Data {
 	var result []runtime.Data
 	for _, element := range na.List.Elements {
 		value := i.Interpreter(element, sc)
+		if value == nil {
+			return nil
+		}
 		result = append(result, value)
 	}
-	return &runtime.TArray{Elements: result}
+	return runtime.NewArray(result)
 }
 
 func (i *Interpreter) Dictionary(nd *ast.Dictionary, sc *runtime.Scope) runtime.Data {
-	result := map[runtime.Data]runtime.Data{}
-	for k, v := range nd.Pairs {
+	result := runtime.NewDictionary()
+	for _, k := range nd.Keys {
 		key := i.Interpreter(k, sc)
 		if key == nil {
 			return nil
 		}
-		value := i.Interpreter(v, sc)
-		result[key] = value
+		value := i.Interpreter(nd.Pairs[k], sc)
+		if value == nil {
+			return nil
+		}
+		result = result.Set(key, value)
 	}
-	return &runtime.TDictionary{Pairs: result}
+	return result
 }
 
 func (i *Interpreter) If(ni *ast.If, sc *runtime.Scope) runtime.Data {
@@ -379,52 +672,109 @@ func (i *Interpreter) Match(nm *ast.Match, sc *runtime.Scope) runtime.Data {
 			return nil
 		}
 	}
-	theWhen, err := i.MatchWhen(nm.Whens, control, sc)
+	if variant, ok := control.(*runtime.TVariant); ok && nm.Else == nil {
+		if missing := i.missingVariants(nm.Whens, variant.Variant.Enum, sc); len(missing) > 0 {
+			i.interpreterErrorHint(nm, fmt.Sprintf("Non-exhaustive match over enum '%s', missing %s", variant.Variant.Enum.Name, strings.Join(missing, ", ")),
+				"add a when for every variant or an else")
+			return nil
+		}
+	}
+	theWhen, whenScope, err := i.MatchWhen(nm.Whens, control, sc)
 	if err != nil {
 		i.interpreterError(nm, err.Error())
 		return nil
 	}
 	if theWhen != nil {
-		return i.Interpreter(theWhen.Body, runtime.NewScopeFrom(sc))
+		return i.Interpreter(theWhen.Body, whenScope)
 	}
 	if nm.Else != nil {
 		return i.Interpreter(nm.Else, runtime.NewScopeFrom(sc))
 	}
-	return nil
+	return runtime.Nil
 }
 
-func (i *Interpreter) MatchWhen(whens []*ast.MatchWhen, control runtime.Data, sc *runtime.Scope) (*ast.MatchWhen, error) {
+func (i *Interpreter) Try(nt *ast.Try, sc *runtime.Scope) runtime.Data {
+	checkpoint := i.diagnostics.Len()
+	result := i.Interpreter(nt.Body, runtime.NewScopeFrom(sc))
+	if i.halted == nil && i.diagnostics.Len() > checkpoint && nt.Rescue != nil {
+		raised := i.raisedError(checkpoint)
+		i.diagnostics.Truncate(checkpoint)
+		i.raised = nil
+		rescueScope := runtime.NewScopeFrom(sc)
+		if nt.Error != nil {
+			bind(nt.Error, rescueScope, raised, false)
+		}
+		result = i.Interpreter(nt.Rescue, rescueScope)
+	}
+	if nt.Ensure != nil {
+		errorCount := i.diagnostics.Len()
+		if i.Interpreter(nt.Ensure, runtime.NewScopeFrom(sc)) == nil && i.diagnostics.Len() > errorCount {
+			return nil
+		}
+	}
+	return result
+}
+
+func (i *Interpreter) MatchWhen(whens []*ast.MatchWhen, control runtime.Data, sc *runtime.Scope) (*ast.MatchWhen, *runtime.Scope, error) {
 	for _, ws := range whens {
 		matches := 0
 		for index, element := range ws.Values.Elements {
-			parameter := i.Interpreter(element, sc)
-			switch {
-			case parameter.Type() == control.Type():
-				if parameter.Check() == control.Check() {
-					return ws, nil
-				}
-			case control.Type() == runtime.TTArray:
-				arrayData := control.(*runtime.TArray).Elements
-				if len(ws.Values.Elements) != len(arrayData) {
-					break
+			whenScope := runtime.NewScopeFrom(sc)
+			matched, ok, err := i.matchPattern(element, control, sc, whenScope)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !ok {
+				parameter := i.Interpreter(element, sc)
+				if parameter == nil {
+					return nil, nil, rerror.ErrorFmt("Match when expression couldn't be interpreted")
 				}
-				if parameter.Type() == arrayData[index].Type() && parameter.Check() == arrayData[index].Check() ||
-					parameter.Type() == runtime.TTPlaceHolder {
-					matches++
-					if matches == len(arrayData) {
-						return ws, nil
+				switch {
+				case parameter.Type() == control.Type():
+					matched = runtime.Equal(parameter, control)
+				case control.Type() == runtime.TTArray:
+					arrayData := control.(*runtime.TArray).Elements()
+					if len(ws.Values.Elements) != len(arrayData) {
+						break
 					}
+					if runtime.Equal(parameter, arrayData[index]) ||
+						parameter.Type() == runtime.TTPlaceHolder {
+						matches++
+						matched = matches == len(arrayData)
+					}
+				case parameter.Type() == runtime.TTSymbol && control.Type() == runtime.TTError:
+					tag := control.(*runtime.TError).Tag
+					matched = tag != nil && tag.Value == parameter.(*runtime.TSymbol).Value
+				case parameter.Type() == runtime.TTSymbol && control.Type() == runtime.TTString:
+					matched = parameter.(*runtime.TSymbol).Value == control.(*runtime.TString).Value
+				default:
+					return nil, nil, rerror.ErrorFmt("Type '%s' can't be used in a match when with control type '%s'", parameter.Type(), control.Type())
 				}
-			case parameter.Type() == runtime.TTSymbol && control.Type() == runtime.TTString:
-				if parameter.(*runtime.TSymbol).Value == control.(*runtime.TString).Value {
-					return ws, nil
-				}
-			default:
-				return nil, rerror.ErrorFmt("Type '%s' can't be used in a match when with control type '%s'", parameter.Type(), control.Type())
+			}
+			if !matched {
+				continue
+			}
+			if guarded, err := i.guard(ws, whenScope); err != nil || guarded {
+				return ws, whenScope, err
 			}
 		}
 	}
-	return nil, nil
+	return nil, nil, nil
+}
+
+func (i *Interpreter) guard(ws *ast.MatchWhen, scope *runtime.Scope) (bool, error) {
+	if ws.Guard == nil {
+		return true, nil
+	}
+	condition := i.Interpreter(ws.Guard, scope)
+	if condition == nil {
+		return false, rerror.ErrorFmt("Match guard couldn't be interpreted")
+	}
+	value, ok := condition.(*runtime.TBoolean)
+	if !ok {
+		return false, rerror.ErrorFmt("Match guard expects a Boolean but got '%s'", condition.Type())
+	}
+	return value.Value, nil
 }
 
 func (i *Interpreter) Repeat(nr *ast.Repeat, sc *runtime.Scope) runtime.Data {
@@ -442,6 +792,12 @@ func (i *Interpreter) Repeat(nr *ast.Repeat, sc *runtime.Scope) runtime.Data {
 		return i.ForArray(nr, enum, sc)
 	case *runtime.TDictionary:
 		return i.ForDictionary(nr, enum, sc)
+	case *runtime.TSequence:
+		return i.ForSequence(nr, enum, sc)
+	case *runtime.TRange:
+		return i.ForRange(nr, enum, sc)
+	case *runtime.TChannel:
+		return i.ForChannel(nr, enum, sc)
 	case *runtime.TSymbol:
 		str := &runtime.TString{Value: enum.Value}
 		return i.ForArray(nr, i.stringToArray(str), sc)
@@ -467,22 +823,40 @@ func (i *Interpreter) RepeatInfinite(nr *ast.Repeat, sc *runtime.Scope) runtime.
 			return result
 		}
 		out = append(out, result)
+		if !i.checkCollectionSize(nr, int64(len(out))) {
+			return nil
+		}
 	}
-	return &runtime.TArray{Elements: out}
+	return runtime.NewArray(out)
 }
 
 func (i *Interpreter) ForArray(nr *ast.Repeat, array *runtime.TArray, sc *runtime.Scope) runtime.Data {
+	return i.forIndexed(nr, "an array", int64(array.Len()), func(index int64) runtime.Data {
+		return array.At(int(index))
+	}, sc)
+}
+
+func (i *Interpreter) ForRange(nr *ast.Repeat, data *runtime.TRange, sc *runtime.Scope) runtime.Data {
+	return i.forIndexed(nr, "a range", data.Len(), data.At, sc)
+}
+
+func (i *Interpreter) forIndexed(nr *ast.Repeat, kind string, count int64, at func(int64) runtime.Data, sc *runtime.Scope) runtime.Data {
 	var out []runtime.Data
-	for index, value := range array.Elements {
+	for index := int64(0); index < count; index++ {
+		value := at(index)
 		newScope := runtime.NewScopeFrom(sc)
-		switch len(nr.Arguments.Elements) {
+		switch i.loopArguments(nr) {
 		case 1:
-			sc.Write(nr.Arguments.Elements[0].Value, value)
+			if !i.loopValue(nr, value, sc, newScope) {
+				return nil
+			}
 		case 2:
-			sc.Write(nr.Arguments.Elements[0].Value, &runtime.TInteger{Value: int64(index)})
-			sc.Write(nr.Arguments.Elements[1].Value, value)
+			bind(nr.Arguments.Elements[0], newScope, &runtime.TInteger{Value: index}, false)
+			if !i.loopValue(nr, value, sc, newScope) {
+				return nil
+			}
 		default:
-			i.interpreterError(nr, "A for loop with an array expects at most 2 arguments")
+			i.interpreterError(nr, fmt.Sprintf("A for loop with %s expects at most 2 arguments", kind))
 			return nil
 		}
 		result := i.Interpreter(nr.Body, newScope)
@@ -497,20 +871,28 @@ func (i *Interpreter) ForArray(nr *ast.Repeat, array *runtime.TArray, sc *runtim
 			return result
 		}
 		out = append(out, result)
+		if !i.checkCollectionSize(nr, int64(len(out))) {
+			return nil
+		}
 	}
-	return &runtime.TArray{Elements: out}
+	return runtime.NewArray(out)
 }
 
 func (i *Interpreter) ForDictionary(nr *ast.Repeat, dictionary *runtime.TDictionary, sc *runtime.Scope) runtime.Data {
 	var out []runtime.Data
-	for pair, value := range dictionary.Pairs {
+	for idx := 0; idx < dictionary.Len(); idx++ {
+		pair, value := dictionary.At(idx)
 		newScope := runtime.NewScopeFrom(sc)
-		switch len(nr.Arguments.Elements) {
+		switch i.loopArguments(nr) {
 		case 1:
-			sc.Write(nr.Arguments.Elements[0].Value, value)
+			if !i.loopValue(nr, value, sc, newScope) {
+				return nil
+			}
 		case 2:
-			sc.Write(nr.Arguments.Elements[0].Value, pair)
-			sc.Write(nr.Arguments.Elements[1].Value, value)
+			bind(nr.Arguments.Elements[0], newScope, pair, false)
+			if !i.loopValue(nr, value, sc, newScope) {
+				return nil
+			}
 		default:
 			i.interpreterError(nr, "A for loop with a dictionary expects at most 2 arguments")
 			return nil
@@ -528,34 +910,167 @@ func (i *Interpreter) ForDictionary(nr *ast.Repeat, dictionary *runtime.TDiction
 		}
 		out = append(out, result)
 	}
-	return &runtime.TArray{Elements: out}
+	return runtime.NewArray(out)
+}
+
+func (i *Interpreter) loopArguments(nr *ast.Repeat) int {
+	if nr.Pattern != nil {
+		return len(nr.Arguments.Elements) + 1
+	}
+	return len(nr.Arguments.Elements)
+}
+
+func (i *Interpreter) loopValue(nr *ast.Repeat, value runtime.Data, sc, scope *runtime.Scope) bool {
+	if nr.Pattern == nil {
+		bind(nr.Arguments.Elements[len(nr.Arguments.Elements)-1], scope, value, false)
+		return true
+	}
+	bound, names, err := i.destructure(nr.Pattern, value, sc)
+	if err != nil {
+		i.interpreterError(nr, err.Error())
+		return false
+	}
+	for _, name := range names {
+		value, _ := read(name, bound, 0)
+		bind(name, scope, value, false)
+	}
+	return true
 }
 
 func (i *Interpreter) Function(nf *ast.FunctionCall, sc *runtime.Scope) runtime.Data {
 	switch nfType := nf.Function.(type) {
 	case *ast.Identifier:
-		if runtimeFn, ok := runtime.FnRuntime[nfType.Value]; ok {
-			return i.RuntimeFunction(nf, runtimeFn, sc)
+		if _, ok := i.natives[nfType.Value]; !ok {
+			if runtimeFn, ok := runtime.FnRuntime[nfType.Value]; ok {
+				return i.RuntimeFunction(nf, runtimeFn, sc)
+			}
 		}
 	}
 	fn := i.Interpreter(nf.Function, sc)
 	if fn == nil {
 		return nil
 	}
-	if fn.Type() != runtime.TTFunction {
+	if !i.callable(nf, fn) {
+		return nil
+	}
+	var arguments []runtime.Data
+	for _, element := range nf.Arguments.Elements {
+		value := i.Interpreter(element, sc)
+		if value == nil {
+			return nil
+		}
+		arguments = append(arguments, value)
+	}
+	return i.callData(nf, fn, arguments, sc)
+}
+
+func (i *Interpreter) callable(nf *ast.FunctionCall, fn runtime.Data) bool {
+	if fn.Type() != runtime.TTFunction && fn.Type() != runtime.TTStruct {
 		i.interpreterError(nf, "Trying to call a non-function")
+		return false
+	}
+	return true
+}
+
+func (i *Interpreter) callData(nf *ast.FunctionCall, fn runtime.Data, arguments []runtime.Data, sc *runtime.Scope) runtime.Data {
+	switch function := fn.(type) {
+	case *runtime.TNativeFunction:
+		return i.NativeFunction(nf, function, arguments, sc)
+	case *runtime.TStructType:
+		return i.Construct(nf, function, arguments)
+	case *runtime.TVariantType:
+		return i.ConstructVariant(nf, function, arguments)
+	default:
+		callee := function.(*runtime.TFunction)
+		if nf.Tail && !callee.Generator {
+			return &tailCall{node: nf, function: callee, arguments: arguments, scope: sc}
+		}
+		return i.Call(nf, callee, arguments, sc)
+	}
+}
+
+// Call runs a function. The tail calls it ends with run in a loop, each one
+// in place of its caller, so tail recursion runs in constant stack space.
+// Stack traces keep the last maxTailFrames functions of a chain, and the
+// return type of every function in it is checked against the final result.
+func (i *Interpreter) Call(n ast.Node, function *runtime.TFunction, arguments []runtime.Data, sc *runtime.Scope) runtime.Data {
+	if i.enterRun() {
+		defer i.exitRun()
+	}
+	if !i.enterCall(n) {
 		return nil
 	}
-	function := fn.(*runtime.TFunction)
+	defer i.exitCall()
+	base := len(i.frames)
+	defer func() {
+		i.frames = i.frames[:base]
+	}()
+	var pending []returnCheck
+	for {
+		var fnScope *runtime.Scope
+		code := i.bytecode(function)
+		if code != nil {
+			if !i.checkArguments(n, function, arguments) {
+				return nil
+			}
+		} else if fnScope = i.bindArguments(n, function, arguments, sc); fnScope == nil {
+			return nil
+		}
+		name := function.Name
+		if name == "" {
+			name = i.callName(n)
+		}
+		if function.Generator {
+			if function.ReturnType != nil {
+				if err := i.checkTypeMatch(runtime.TTSequence, function.ReturnType.Value); err != nil {
+					i.fail(n, err)
+					return nil
+				}
+			}
+			return i.sequence(n, function, name, fnScope)
+		}
+		if len(i.frames)-base == maxTailFrames {
+			i.frames = append(i.frames[:base], i.frames[base+1:]...)
+		}
+		i.pushFrame(name, n)
+		var result runtime.Data
+		if code != nil {
+			result = i.execute(code, function, arguments)
+		} else {
+			result = i.unwrapReturnValue(i.Interpreter(function.Body, fnScope))
+		}
+		if result == nil {
+			return nil
+		}
+		if function.ReturnType != nil {
+			pending = addReturnCheck(pending, n, function.ReturnType.Value)
+		}
+		if call, ok := result.(*tailCall); ok {
+			n, function, arguments, sc = call.node, call.function, call.arguments, call.scope
+			continue
+		}
+		i.frames = i.frames[:base]
+		for idx := len(pending) - 1; idx >= 0; idx-- {
+			if err := i.checkTypeMatch(result.Type(), pending[idx].expected); err != nil {
+				i.fail(pending[idx].node, err)
+				return nil
+			}
+		}
+		return result
+	}
+}
+
+func (i *Interpreter) bindArguments(n ast.Node, function *runtime.TFunction, arguments []runtime.Data, sc *runtime.Scope) *runtime.Scope {
 	fnScope := runtime.NewScopeFrom(function.Scope)
 	if !function.Variadic {
-		if len(nf.Arguments.Elements) > len(function.Parameters) {
-			i.interpreterError(nf, "Too many arguments in function call")
+		if len(arguments) > len(function.Parameters) {
+			i.interpreterError(n, "Too many arguments in function call")
 			return nil
 		}
 	}
+	values := make([]runtime.Data, len(function.Parameters))
 	defaultCount := 0
-	for _, param := range function.Parameters {
+	for index, param := range function.Parameters {
 		if param.Default != nil {
 			value := i.Interpreter(param.Default, sc)
 			if value == nil {
@@ -563,75 +1078,123 @@ func (i *Interpreter) Function(nf *ast.FunctionCall, sc *runtime.Scope) runtime.
 			}
 			if param.Type != nil {
 				if err := i.checkTypeMatch(value.Type(), param.Type.Value); err != nil {
-					i.interpreterError(nf, err.Error())
+					i.fail(n, err)
 					return nil
 				}
 			}
-			fnScope.Write(param.Name.Value, value)
+			values[index] = value
 			defaultCount++
 		}
 	}
-	if len(nf.Arguments.Elements) < len(function.Parameters)-defaultCount {
-		i.interpreterError(nf, "Too few arguments in function call")
+	if len(arguments) < len(function.Parameters)-defaultCount {
+		i.interpreterError(n, "Too few arguments in function call")
 		return nil
 	}
-	var arguments []runtime.Data
+	var variadic []runtime.Data
 	countParams := len(function.Parameters) - 1
-	for index, element := range nf.Arguments.Elements {
-		value := i.Interpreter(element, sc)
-		if value == nil {
-			return nil
-		}
-		var paramName *ast.Identifier
+	for index, value := range arguments {
 		var paramType *ast.Identifier
 		if function.Variadic && index >= countParams {
-			paramName = function.Parameters[countParams].Name
 			paramType = function.Parameters[countParams].Type
 		} else {
-			paramName = function.Parameters[index].Name
 			paramType = function.Parameters[index].Type
 		}
 		if paramType != nil {
 			if err := i.checkTypeMatch(value.Type(), paramType.Value); err != nil {
-				i.interpreterError(nf, err.Error())
+				i.fail(n, err)
 				return nil
 			}
 		}
 		if function.Variadic && index >= countParams {
-			arguments = append(arguments, value)
+			variadic = append(variadic, value)
 		} else {
-			fnScope.Write(paramName.Value, value)
+			values[index] = value
 		}
 	}
-	if function.Variadic && len(arguments) > 0 {
-		fnScope.Write(function.Parameters[len(function.Parameters)-1].Name.Value, &runtime.TArray{Elements: arguments})
+	if function.Variadic && len(variadic) > 0 {
+		values[countParams] = runtime.NewArray(variadic)
 	}
-	result := i.unwrapReturnValue(i.Interpreter(function.Body, fnScope))
-	if result == nil {
-		return nil
+	for index, param := range function.Parameters {
+		if values[index] != nil {
+			bind(param.Name, fnScope, values[index], false)
+		}
 	}
-	if function.ReturnType != nil {
-		if err := i.checkTypeMatch(result.Type(), function.ReturnType.Value); err != nil {
-			i.interpreterError(nf, err.Error())
-			return nil
+	return fnScope
+}
+
+func (i *Interpreter) checkArguments(n ast.Node, function *runtime.TFunction, arguments []runtime.Data) bool {
+	if len(arguments) > len(function.Parameters) {
+		i.interpreterError(n, "Too many arguments in function call")
+		return false
+	}
+	if len(arguments) < len(function.Parameters) {
+		i.interpreterError(n, "Too few arguments in function call")
+		return false
+	}
+	for index, value := range arguments {
+		if paramType := function.Parameters[index].Type; paramType != nil {
+			if err := i.checkTypeMatch(value.Type(), paramType.Value); err != nil {
+				i.fail(n, err)
+				return false
+			}
 		}
 	}
-	return result
+	return true
 }
 
 func (i *Interpreter) RuntimeFunction(nf *ast.FunctionCall, fn runtime.TRuntimeFn, sc *runtime.Scope) runtime.Data {
 	var args []runtime.Data
 	for _, element := range nf.Arguments.Elements {
 		value := i.Interpreter(element, sc)
-		if value != nil {
-			args = append(args, value)
+		if value == nil {
+			return nil
 		}
+		args = append(args, value)
+	}
+	return i.callRuntime(nf, fn, args)
+}
+
+func (i *Interpreter) callRuntime(nf *ast.FunctionCall, fn runtime.TRuntimeFn, args []runtime.Data) runtime.Data {
+	if name, ok := nf.Function.(*ast.Identifier); ok && name.Value == runtime.TTArray && len(args) == 1 {
+		fn = i.arrayOf(nf)
 	}
 	data, err := fn(args...)
+	if raised, ok := err.(*runtime.TError); ok {
+		i.raise(nf, raised)
+		return nil
+	}
+	if err == runtime.ErrReported {
+		return nil
+	}
 	if err != nil {
 		i.interpreterError(nf, err.Error())
 		return nil
 	}
+	if created, ok := data.(*runtime.TError); ok && created.Stack == nil {
+		created.Stack = i.trace(nf)
+	}
+	return data
+}
+
+func (i *Interpreter) NativeFunction(n ast.Node, function *runtime.TNativeFunction, arguments []runtime.Data, sc *runtime.Scope) runtime.Data {
+	data, err := function.Fn(i.ctx, sc, arguments...)
+	if raised, ok := err.(*runtime.TError); ok {
+		i.raise(n, raised)
+		return nil
+	}
+	if err == runtime.ErrReported {
+		return nil
+	}
+	if err != nil {
+		i.interpreterError(n, err.Error())
+		return nil
+	}
+	if created, ok := data.(*runtime.TError); ok && created.Stack == nil {
+		created.Stack = i.trace(n)
+	}
+	if data == nil {
+		return runtime.Nil
+	}
 	return data
 }
 
@@ -641,6 +1204,10 @@ func (i *Interpreter) Subscript(ns *ast.Subscript, sc *runtime.Scope) runtime.Da
 	if left == nil || index == nil {
 		return nil
 	}
+	return i.subscript(ns, left, index)
+}
+
+func (i *Interpreter) subscript(ns *ast.Subscript, left, index runtime.Data) runtime.Data {
 	switch {
 	case left.Type() == runtime.TTString && index.Type() == runtime.TTInteger:
 		result, err := i.StringSubscript(left, index)
@@ -650,8 +1217,12 @@ func (i *Interpreter) Subscript(ns *ast.Subscript, sc *runtime.Scope) runtime.Da
 		return result
 	case left.Type() == runtime.TTArray && index.Type() == runtime.TTInteger:
 		return i.ArraySubscript(left, index)
+	case left.Type() == runtime.TTRange && index.Type() == runtime.TTInteger:
+		return i.RangeSubscript(left.(*runtime.TRange), index.(*runtime.TInteger).Value)
 	case left.Type() == runtime.TTDictionary:
 		return i.DictionarySubscript(left, index)
+	case left.Type() == runtime.TTError && index.Type() == runtime.TTSymbol:
+		return i.ErrorSubscript(left.(*runtime.TError), index.(*runtime.TSymbol))
 	default:
 		i.interpreterError(ns, fmt.Sprintf("Subscript on '%s' not supported with literal '%s'", left.Type(), index.Type()))
 		return nil
@@ -659,25 +1230,71 @@ func (i *Interpreter) Subscript(ns *ast.Subscript, sc *runtime.Scope) runtime.Da
 }
 
 func (i *Interpreter) ArraySubscript(array, index runtime.Data) runtime.Data {
-	arrayData := array.(*runtime.TArray).Elements
+	arrayData := array.(*runtime.TArray)
 	idx := index.(*runtime.TInteger).Value
-	idx, err := i.checkArrayBounds(arrayData, idx)
+	idx, err := i.checkArrayBounds(arrayData.Len(), idx)
 	if err != nil {
 		return runtime.Nil
 	}
-	return arrayData[idx]
+	return arrayData.At(int(idx))
+}
+
+func (i *Interpreter) RangeSubscript(data *runtime.TRange, index int64) runtime.Data {
+	length := data.Len()
+	if index < 0 {
+		index += length
+	}
+	if index < 0 || index >= length {
+		return runtime.Nil
+	}
+	return data.At(index)
 }
 
 func (i *Interpreter) DictionarySubscript(dictionary, index runtime.Data) runtime.Data {
-	dictionaryData := dictionary.(*runtime.TDictionary).Pairs
-	for k, v := range dictionaryData {
-		if k.Check() == index.Check() {
-			return v
-		}
+	if value, ok := dictionary.(*runtime.TDictionary).Get(index); ok {
+		return value
 	}
 	return runtime.Nil
 }
 
+func (i *Interpreter) ErrorSubscript(err *runtime.TError, index *runtime.TSymbol) runtime.Data {
+	switch index.Value {
+	case "message":
+		return &runtime.TString{Value: err.Message}
+	case "kind":
+		if err.Kind == "" {
+			return runtime.Nil
+		}
+		return &runtime.TSymbol{Value: err.Kind}
+	case "tag":
+		if err.Tag == nil {
+			return runtime.Nil
+		}
+		return err.Tag
+	case "payload":
+		return err.Payload
+	case "file", "line", "column":
+		frame, ok := userFrame(err.Stack)
+		switch {
+		case !ok:
+			return runtime.Nil
+		case index.Value == "file":
+			return &runtime.TString{Value: frame.File}
+		case index.Value == "line":
+			return &runtime.TInteger{Value: int64(frame.Row)}
+		}
+		return &runtime.TInteger{Value: int64(frame.Col)}
+	case "stack":
+		var frames []runtime.Data
+		for _, f := range err.Stack {
+			frames = append(frames, &runtime.TString{Value: f.String()})
+		}
+		return runtime.NewArray(frames)
+	default:
+		return runtime.Nil
+	}
+}
+
 func (i *Interpreter) StringSubscript(str, index runtime.Data) (runtime.Data, error) {
 	stringData := str.(*runtime.TString).Value
 	idx := index.(*runtime.TInteger).Value
@@ -700,7 +1317,7 @@ func (i *Interpreter) Pipe(np *ast.Pipe, sc *runtime.Scope) runtime.Data {
 }
 
 func (i *Interpreter) Use(nu *ast.Use, sc *runtime.Scope) runtime.Data {
-	fileName := i.checkExtFileName(nu.File.Value)
+	fileName := i.usePath(nu)
 	if cache, ok := i.useCache[fileName]; ok {
 		return cache
 	}
@@ -709,13 +1326,11 @@ func (i *Interpreter) Use(nu *ast.Use, sc *runtime.Scope) runtime.Data {
 		i.interpreterError(nu, fmt.Sprintf("Couldn't read imported file '%s'", nu.File.Value))
 		return nil
 	}
-	lex := lexer.New(source)
-	if rerror.HasErrors() {
-		return nil
-	}
+	lex := lexer.New(fileName, source)
 	parse := parser.New(lex)
 	program := parse.Parse()
-	if rerror.HasErrors() {
+	if parse.Diagnostics().HasErrors() {
+		i.diagnostics.Merge(parse.Diagnostics())
 		return nil
 	}
 	result := i.Interpreter(program, sc)
@@ -732,7 +1347,7 @@ func (i *Interpreter) Is(ni *ast.Is, sc *runtime.Scope) runtime.Data {
 		i.interpreterError(ni, fmt.Sprintf("Unknown type '%s' in is operator", ni.Right.Value))
 		return nil
 	}
-	if dataIs.Type() == ni.Right.Value {
+	if i.typeMatches(dataIs.Type(), ni.Right.Value) {
 		return runtime.Yes
 	}
 	return runtime.No
@@ -745,6 +1360,7 @@ func (i *Interpreter) As(na *ast.As, sc *runtime.Scope) runtime.Data {
 	}
 	nf := &ast.FunctionCall{
 		Token:     na.Token,
+		Function:  na.Right,
 		Arguments: &ast.ExpressionList{Elements: []ast.Expression{na.Left}},
 	}
 	switch na.Right.Value {
@@ -768,6 +1384,10 @@ func (i *Interpreter) PrefixExpression(np *ast.PrefixExpression, sc *runtime.Sco
 		i.interpreterError(np, fmt.Sprintf("Trying to run operator '%s' with an unknown value", np.Operator))
 		return nil
 	}
+	return i.prefix(np, data)
+}
+
+func (i *Interpreter) prefix(np *ast.PrefixExpression, data runtime.Data) runtime.Data {
 	var out runtime.Data
 	var err error
 	switch np.Operator {
@@ -818,9 +1438,17 @@ func (i *Interpreter) InfixExpression(ni *ast.InfixExpression, sc *runtime.Scope
 	if left == nil || right == nil {
 		return nil
 	}
+	return i.infix(ni, left, right)
+}
+
+func (i *Interpreter) infix(ni *ast.InfixExpression, left, right runtime.Data) runtime.Data {
 	var out runtime.Data
 	var err error
 	switch {
+	case ni.Operator == token.In:
+		out, err = i.InInfix(left, right)
+	case ni.Operator == token.Step:
+		out, err = i.StepInfix(left, right)
 	case left.Type() == runtime.TTBoolean && right.Type() == runtime.TTString:
 		l := &runtime.TString{Value: fmt.Sprintf("%t", left.(*runtime.TBoolean).Value)}
 		r := &runtime.TString{Value: fmt.Sprintf("%s", right.(*runtime.TString).Value)}
@@ -863,17 +1491,25 @@ func (i *Interpreter) InfixExpression(ni *ast.InfixExpression, sc *runtime.Scope
 		out, err = i.ArrayInfix(ni.Operator, left, right)
 	case left.Type() == runtime.TTDictionary && right.Type() == runtime.TTDictionary:
 		out, err = i.DictionaryInfix(ni.Operator, left, right)
+	case left.Type() == runtime.TTRange && right.Type() == runtime.TTRange:
+		out, err = i.RangeEqualityInfix(ni.Operator, left.(*runtime.TRange), right.(*runtime.TRange))
 	case left.Type() == runtime.TTSymbol && right.Type() == runtime.TTSymbol:
 		out, err = i.StringInfix(ni.Operator, left.(*runtime.TSymbol).Value, right.(*runtime.TSymbol).Value)
 	case left.Type() == runtime.TTSymbol && right.Type() == runtime.TTString:
 		out, err = i.StringInfix(ni.Operator, left.(*runtime.TSymbol).Value, right.(*runtime.TString).Value)
 	case left.Type() == runtime.TTNil || right.Type() == runtime.TTNil:
 		out, err = i.NilInfix(ni.Operator, left, right)
+	case i.isValue(left) || i.isValue(right):
+		out, err = i.ValueInfix(ni.Operator, left, right)
 	case left.Type() != right.Type():
 		err = rerror.ErrorFmt("Cannot run expression with types '%s' and '%s'", left.Type(), right.Type())
 	default:
 		err = rerror.ErrorFmt("Unknown operator %s for types '%s' and '%s'", ni.Operator, left.Type(), right.Type())
 	}
+	if err == ErrCollectionSize {
+		i.halt(ni, err)
+		return nil
+	}
 	if err != nil {
 		i.interpreterError(ni, err.Error())
 	}
@@ -929,8 +1565,8 @@ func (i *Interpreter) IntegerInfix(operator string, left, right runtime.Data) (r
 		return i.nativeToBoolean(leftVal == rightVal), nil
 	case token.NotEqual:
 		return i.nativeToBoolean(leftVal != rightVal), nil
-	case token.Range:
-		return i.RangeIntegerInfix(leftVal, rightVal), nil
+	case token.Range, token.RangeExclusive:
+		return i.RangeInfix(operator, left, right)
 	default:
 		return nil, rerror.ErrorFmt("Unsupported Integer operator '%s'", operator)
 	}
@@ -965,6 +1601,8 @@ func (i *Interpreter) FloatInfix(operator string, left, right float64) (runtime.
 		return i.nativeToBoolean(left == right), nil
 	case token.NotEqual:
 		return i.nativeToBoolean(left != right), nil
+	case token.Range, token.RangeExclusive:
+		return i.RangeInfix(operator, &runtime.TFloat{Value: left}, &runtime.TFloat{Value: right})
 	default:
 		return nil, rerror.ErrorFmt("Unsupported Float operator '%s'", operator)
 	}
@@ -1011,46 +1649,79 @@ func (i *Interpreter) BooleanInfix(operator string, left, right runtime.Data) (r
 }
 
 func (i *Interpreter) ArrayInfix(operator string, left, right runtime.Data) (runtime.Data, error) {
-	leftVal := left.(*runtime.TArray).Elements
-	rightVal := right.(*runtime.TArray).Elements
+	leftVal := left.(*runtime.TArray)
+	rightVal := right.(*runtime.TArray)
 	switch operator {
 	case string(token.Plus):
-		return &runtime.TArray{Elements: append(leftVal, rightVal...)}, nil
+		return leftVal.Concat(rightVal), nil
 	case token.Equal:
-		return i.nativeToBoolean(i.compareArrays(leftVal, rightVal)), nil
+		return i.nativeToBoolean(leftVal.Equals(rightVal)), nil
 	case token.NotEqual:
-		return i.nativeToBoolean(!i.compareArrays(leftVal, rightVal)), nil
+		return i.nativeToBoolean(!leftVal.Equals(rightVal)), nil
 	case string(token.Less):
-		return i.nativeToBoolean(len(leftVal) < len(rightVal)), nil
+		return i.nativeToBoolean(leftVal.Len() < rightVal.Len()), nil
 	case string(token.Greater):
-		return i.nativeToBoolean(len(leftVal) > len(rightVal)), nil
+		return i.nativeToBoolean(leftVal.Len() > rightVal.Len()), nil
 	default:
 		return nil, rerror.ErrorFmt("Unsupported Array operator '%s'", operator)
 	}
 }
 
 func (i *Interpreter) DictionaryInfix(operator string, left, right runtime.Data) (runtime.Data, error) {
-	leftVal := left.(*runtime.TDictionary).Pairs
-	rightVal := right.(*runtime.TDictionary).Pairs
+	leftVal := left.(*runtime.TDictionary)
+	rightVal := right.(*runtime.TDictionary)
 	switch operator {
 	case string(token.Plus):
-		for k, v := range leftVal {
-			rightVal[k] = v
+		merged := leftVal
+		for idx := 0; idx < rightVal.Len(); idx++ {
+			if key, value := rightVal.At(idx); !merged.Has(key) {
+				merged = merged.Set(key, value)
+			}
 		}
-		return &runtime.TDictionary{Pairs: rightVal}, nil
+		return merged, nil
 	case token.Equal:
-		return i.nativeToBoolean(i.compareDictionaries(leftVal, rightVal)), nil
+		return i.nativeToBoolean(leftVal.Equals(rightVal)), nil
 	case token.NotEqual:
-		return i.nativeToBoolean(!i.compareDictionaries(leftVal, rightVal)), nil
+		return i.nativeToBoolean(!leftVal.Equals(rightVal)), nil
 	case string(token.Less):
-		return i.nativeToBoolean(len(leftVal) < len(rightVal)), nil
+		return i.nativeToBoolean(leftVal.Len() < rightVal.Len()), nil
 	case string(token.Greater):
-		return i.nativeToBoolean(len(leftVal) > len(rightVal)), nil
+		return i.nativeToBoolean(leftVal.Len() > rightVal.Len()), nil
 	default:
 		return nil, rerror.ErrorFmt("Unsupported Dictionary operator '%s'", operator)
 	}
 }
 
+func (i *Interpreter) RangeEqualityInfix(operator string, left, right *runtime.TRange) (runtime.Data, error) {
+	switch operator {
+	case token.Equal:
+		return i.nativeToBoolean(*left == *right), nil
+	case token.NotEqual:
+		return i.nativeToBoolean(*left != *right), nil
+	default:
+		return nil, rerror.ErrorFmt("Unsupported Range operator '%s'", operator)
+	}
+}
+
+func (i *Interpreter) ValueInfix(operator string, left, right runtime.Data) (runtime.Data, error) {
+	switch operator {
+	case token.Equal:
+		return i.nativeToBoolean(runtime.Equal(left, right)), nil
+	case token.NotEqual:
+		return i.nativeToBoolean(!runtime.Equal(left, right)), nil
+	default:
+		return nil, rerror.ErrorFmt("Unsupported operator '%s' for types '%s' and '%s'", operator, left.Type(), right.Type())
+	}
+}
+
+func (i *Interpreter) isValue(data runtime.Data) bool {
+	switch data.(type) {
+	case *runtime.TStruct, *runtime.TVariant:
+		return true
+	}
+	return false
+}
+
 func (i *Interpreter) NilInfix(operator string, left, right runtime.Data) (runtime.Data, error) {
 	switch operator {
 	case token.Equal:
@@ -1068,18 +1739,49 @@ func (i *Interpreter) NilInfix(operator string, left, right runtime.Data) (runti
 	}
 }
 
-func (i *Interpreter) RangeIntegerInfix(left, right int64) runtime.Data {
-	var result []runtime.Data
-	if left < right {
-		for idx := left; idx <= right; idx++ {
-			result = append(result, &runtime.TInteger{Value: idx})
+func (i *Interpreter) RangeInfix(operator string, left, right runtime.Data) (runtime.Data, error) {
+	data, err := runtime.NewRange(left, right, operator == token.RangeExclusive)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (i *Interpreter) StepInfix(left, right runtime.Data) (runtime.Data, error) {
+	data, ok := left.(*runtime.TRange)
+	if !ok {
+		return nil, rerror.ErrorFmt("Operator 'step' expects a Range but got '%s'", left.Type())
+	}
+	stepped, err := data.WithStep(right)
+	if err != nil {
+		return nil, err
+	}
+	return stepped, nil
+}
+
+func (i *Interpreter) InInfix(left, right runtime.Data) (runtime.Data, error) {
+	switch collection := right.(type) {
+	case *runtime.TRange:
+		return i.nativeToBoolean(collection.Contains(left)), nil
+	case *runtime.TArray:
+		for idx := 0; idx < collection.Len(); idx++ {
+			if runtime.Equal(collection.At(idx), left) {
+				return runtime.Yes, nil
+			}
 		}
-	} else {
-		for idx := left; idx >= right; idx-- {
-			result = append(result, &runtime.TInteger{Value: idx})
+		return runtime.No, nil
+	case *runtime.TDictionary:
+		_, ok := collection.Get(left)
+		return i.nativeToBoolean(ok), nil
+	case *runtime.TString:
+		str, ok := left.(*runtime.TString)
+		if !ok {
+			return nil, rerror.ErrorFmt("Operator 'in' expects a String to look for in a String but got '%s'", left.Type())
 		}
+		return i.nativeToBoolean(strings.Contains(collection.Value, str.Value)), nil
+	default:
+		return nil, rerror.ErrorFmt("Operator 'in' expects a Range, an Array, a Dictionary or a String but got '%s'", right.Type())
 	}
-	return &runtime.TArray{Elements: result}
 }
 
 func (i *Interpreter) RangeStringInfix(left, right string) (runtime.Data, error) {
@@ -1104,7 +1806,16 @@ func (i *Interpreter) RangeStringInfix(left, right string) (runtime.Data, error)
 			}
 		}
 	}
-	return &runtime.TArray{Elements: result}, nil
+	return runtime.NewArray(result), nil
+}
+
+func (i *Interpreter) usePath(nu *ast.Use) string {
+	file := i.checkExtFileName(nu.File.Value)
+	caller := nu.TokenPosition().File
+	if !filepath.IsAbs(file) && caller != "" && !strings.HasPrefix(caller, "<") {
+		file = filepath.Join(filepath.Dir(caller), file)
+	}
+	return filepath.Clean(file)
 }
 
 func (i *Interpreter) checkExtFileName(file string) string {
@@ -1131,41 +1842,12 @@ func (i *Interpreter) unwrapReturnValue(data runtime.Data) runtime.Data {
 	return data
 }
 
-func (i *Interpreter) compareArrays(left, right []runtime.Data) bool {
-	if len(left) != len(right) {
-		return false
-	}
-	for i, v := range left {
-		if v.Type() != right[i].Type() || v.Check() != right[i].Check() {
-			return false
-		}
-	}
-	return true
-}
-
-func (i *Interpreter) compareDictionaries(left, right map[runtime.Data]runtime.Data) bool {
-	if len(left) != len(right) {
-		return false
-	}
-	found := 0
-	for lk, lv := range left {
-		for rk, rv := range right {
-			if lk.Check() == rk.Check() && lv.Check() == rv.Check() {
-				found += 1
-				continue
-			}
-		}
-	}
-	return found == len(left)
-}
-
 func (i *Interpreter) stringToArray(str *runtime.TString) *runtime.TArray {
-	array := &runtime.TArray{}
-	array.Elements = []runtime.Data{}
+	elements := []runtime.Data{}
 	for _, s := range str.Value {
-		array.Elements = append(array.Elements, &runtime.TString{Value: string(s)})
+		elements = append(elements, &runtime.TString{Value: string(s)})
 	}
-	return array
+	return runtime.NewArray(elements)
 }
 
 func (i *Interpreter) nativeToBoolean(value bool) runtime.Data {
@@ -1186,9 +1868,9 @@ func (i *Interpreter) isType(data runtime.Data) bool {
 	case *runtime.TFloat:
 		return data.Value != 0.0
 	case *runtime.TArray:
-		return len(data.Elements) > 0
+		return data.Len() > 0
 	case *runtime.TDictionary:
-		return len(data.Pairs) > 0
+		return data.Len() > 0
 	case *runtime.TSymbol:
 		return true
 	case *runtime.TNil:
@@ -1198,12 +1880,12 @@ func (i *Interpreter) isType(data runtime.Data) bool {
 	}
 }
 
-func (i *Interpreter) checkArrayBounds(array []runtime.Data, index int64) (int64, error) {
+func (i *Interpreter) checkArrayBounds(length int, index int64) (int64, error) {
 	originalIdx := index
 	if index < 0 {
-		index = int64(len(array)) + index
+		index = int64(length) + index
 	}
-	if index < 0 || index > int64(len(array)-1) {
+	if index < 0 || index > int64(length-1) {
 		return 0, rerror.ErrorFmt("Array index '%d' out of bounds", originalIdx)
 	}
 	return index, nil
@@ -1223,10 +1905,12 @@ func (i *Interpreter) checkStringBounds(str string, index int64) (int64, error)
 func (i *Interpreter) checkSupportedType(t string) bool {
 	switch t {
 	case runtime.TTBoolean, runtime.TTString, runtime.TTInteger, runtime.TTFloat,
-		runtime.TTArray, runtime.TTDictionary, runtime.TTSymbol, runtime.TTFunction:
+		runtime.TTArray, runtime.TTDictionary, runtime.TTSymbol, runtime.TTFunction, runtime.TTError, runtime.TTStruct, runtime.TTEnum,
+		runtime.TTSequence, runtime.TTRange, runtime.TTTask, runtime.TTChannel, runtime.TTEnumerable:
 		return true
 	default:
-		return false
+		_, ok := i.types[t]
+		return ok
 	}
 }
 
@@ -1234,12 +1918,67 @@ func (i *Interpreter) checkTypeMatch(actual, expected string) error {
 	if !i.checkSupportedType(actual) {
 		return rerror.ErrorFmt("Unknown type '%s' in function parameter", actual)
 	}
-	if actual != expected {
-		return rerror.ErrorFmt("Function asks for type '%s' but got '%s'", expected, actual)
+	if !i.checkSupportedType(expected) {
+		return rerror.ErrorFmt("Unknown type '%s' in function parameter", expected)
+	}
+	if !i.typeMatches(actual, expected) {
+		return &typeMismatch{fmt.Sprintf("Function asks for type '%s' but got '%s'", expected, actual)}
 	}
 	return nil
 }
 
+func (i *Interpreter) typeMatches(actual, expected string) bool {
+	if expected == runtime.TTEnumerable {
+		switch actual {
+		case runtime.TTArray, runtime.TTDictionary, runtime.TTRange, runtime.TTSequence:
+			return true
+		}
+		return false
+	}
+	return actual == expected
+}
+
+type typeMismatch struct {
+	message string
+}
+
+func (e *typeMismatch) Error() string {
+	return e.message
+}
+
+func (i *Interpreter) fail(n ast.Node, err error) {
+	if _, ok := err.(*typeMismatch); ok {
+		i.typeError(n, err.Error())
+		return
+	}
+	i.interpreterError(n, err.Error())
+}
+
 func (i *Interpreter) interpreterError(n ast.Node, msg string) {
-	rerror.Error(rerror.Runtime, n.TokenPosition(), msg)
+	i.interpreterErrorHint(n, msg, "")
+}
+
+func (i *Interpreter) typeError(n ast.Node, msg string) {
+	i.report(rerror.Type, n, msg, "")
+}
+
+func (i *Interpreter) interpreterErrorHint(n ast.Node, msg, hint string) {
+	i.report(rerror.Runtime, n, msg, hint)
+}
+
+func (i *Interpreter) report(kind rerror.TError, n ast.Node, msg, hint string) {
+	position, span := n.TokenPosition(), len(n.TokenLiteral())
+	if na, ok := n.(*ast.ModuleAccess); ok {
+		position, span = na.Object.TokenPosition(), len(na.Object.Value)+len(token.Dot)+len(na.Parameter.Value)
+	}
+	i.diagnostics.Add(rerror.Diagnostic{
+		Kind:    kind,
+		File:    position.File,
+		Row:     position.Row,
+		Col:     position.Col,
+		Span:    span,
+		Message: msg,
+		Hint:    hint,
+		Trace:   i.trace(n),
+	})
 }
@@ -4,13 +4,33 @@
 package interpreter
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"github.com/luiscm/oro/lexer"
 	"github.com/luiscm/oro/parser"
 	"github.com/luiscm/oro/rerror"
 	"github.com/luiscm/oro/runtime"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
+var engine = flag.String("engine", "tree", "engine the tests run on: tree or vm")
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	selected, err := ParseEngine(*engine)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	defaultEngine = selected
+	os.Exit(m.Run())
+}
+
 func TestInterpreterString(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -19,14 +39,27 @@ func TestInterpreterString(t *testing.T) {
 		{`"hello"`, "hello"},
 		{`"hello"+"world"`, "helloworld"},
 		{`"hello"+" "+"world"`, "hello world"},
+		{`val name = "Ana"
+"Hello #{name}!"`, "Hello Ana!"},
+		{`val age = 30
+"#{age + 1} #{age * 2}"`, "31 60"},
+		{`val user = ["name" => "Ana"]
+"#{user["name"]}, #{[1, 2]}, #{:ok}, #{nil}"`, "Ana, [1, 2], :ok, nil"},
+		{`val n = 2
+"a#{"b#{n}c"}d"`, "ab2cd"},
+		{`val x = 1
+"#{x} and #{x}"`, "1 and 1"},
+		{`"# not #{1 > 2 ? "a" : "b"}"`, "# not b"},
+		{`val x = 1
+"\#{x} is #{x}"`, "#{x} is 1"},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := parser.New(lex)
 		program := parse.Parse()
 		runner := New()
 		actual := runner.Interpreter(program, runtime.NewScope())
-		checkInterpreterErrors(t)
+		checkInterpreterErrors(t, parse, runner)
 		testString(t, actual, test.expected)
 	}
 }
@@ -47,12 +80,12 @@ func TestInterpreterInteger(t *testing.T) {
 		{`5 % 2`, 1},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := parser.New(lex)
 		program := parse.Parse()
 		runner := New()
 		actual := runner.Interpreter(program, runtime.NewScope())
-		checkInterpreterErrors(t)
+		checkInterpreterErrors(t, parse, runner)
 		testInteger(t, actual, test.expected)
 	}
 }
@@ -70,12 +103,12 @@ func TestInterpreterFloat(t *testing.T) {
 		{`9.0 / 3`, 3.0},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := parser.New(lex)
 		program := parse.Parse()
 		runner := New()
 		actual := runner.Interpreter(program, runtime.NewScope())
-		checkInterpreterErrors(t)
+		checkInterpreterErrors(t, parse, runner)
 		testFloat(t, actual, test.expected)
 	}
 }
@@ -108,12 +141,12 @@ func TestInterpreterBoolean(t *testing.T) {
 		{`false || true`, true},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := parser.New(lex)
 		program := parse.Parse()
 		runner := New()
 		actual := runner.Interpreter(program, runtime.NewScope())
-		checkInterpreterErrors(t)
+		checkInterpreterErrors(t, parse, runner)
 		testBoolean(t, actual, test.expected)
 	}
 }
@@ -128,12 +161,12 @@ func TestInterpreterVal(t *testing.T) {
 		//{`val x = 2 x = 3`, 2},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := parser.New(lex)
 		program := parse.Parse()
 		runner := New()
 		actual := runner.Interpreter(program, runtime.NewScope())
-		checkInterpreterErrors(t)
+		checkInterpreterErrors(t, parse, runner)
 		result, ok := test.expected.(int)
 		if !ok {
 			t.Errorf("Expected Integer but got %T", test.expected)
@@ -152,12 +185,12 @@ func TestInterpreterIf(t *testing.T) {
 		{`if true then 10 end`, 10},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := parser.New(lex)
 		program := parse.Parse()
 		runner := New()
 		actual := runner.Interpreter(program, runtime.NewScope())
-		checkInterpreterErrors(t)
+		checkInterpreterErrors(t, parse, runner)
 		result, ok := test.expected.(int)
 		if !ok {
 			t.Errorf("Expected Integer but got %T", test.expected)
@@ -181,12 +214,12 @@ func TestInterpreterMatch(t *testing.T) {
 		{`match ["Luis", "Carlos", 2] with when "Luis", _, _ then 10 when _, _ 2 then 20 else then -1 end`, 10},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := parser.New(lex)
 		program := parse.Parse()
 		runner := New()
 		actual := runner.Interpreter(program, runtime.NewScope())
-		checkInterpreterErrors(t)
+		checkInterpreterErrors(t, parse, runner)
 		result, ok := test.expected.(int)
 		if !ok {
 			t.Errorf("Expected Integer but got %T", test.expected)
@@ -247,11 +280,1627 @@ func testBoolean(t *testing.T, tp runtime.Data, expected bool) bool {
 	return true
 }
 
-func checkInterpreterErrors(t *testing.T) {
-	if rerror.HasErrors() {
-		t.Errorf(rerror.ParseErrors)
-		for _, e := range rerror.GetErrors() {
-			t.Errorf(e)
+func checkInterpreterErrors(t *testing.T, parse *parser.Parser, runner *Interpreter) {
+	diagnostics := rerror.NewDiagnostics()
+	diagnostics.Merge(parse.Diagnostics())
+	diagnostics.Merge(runner.Diagnostics())
+	if diagnostics.HasErrors() {
+		t.Errorf("%s", rerror.ParseErrors)
+		for _, e := range diagnostics.Errors() {
+			t.Errorf("%s", e)
+		}
+	}
+}
+
+func TestInterpreterTry(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try
+  "ok"
+rescue
+  "rescued"
+end`, "ok"},
+		{`val f = fn
+  missing + 1
+end
+try
+  f()
+rescue err
+  err[:message]
+end`, "Identifier 'missing' not found in current memory"},
+		{`try
+  panic("boom")
+rescue err
+  "" + err[:tag] + ":" + String(err[:line])
+end`, "runtime:2"},
+		{`try
+  Dictionary.insert(["a" => 1], "a", 2)
+rescue err
+  err[:message]
+end`, "Dictionary key 'a' already exists"},
+		{`val d = ["a" => 1]
+try
+  Dictionary.insert(d, "a", 2)
+rescue err
+  "#{err[:file]}:#{err[:line]}:#{err[:column]}"
+end`, "main.oro:3:20"},
+		{`val add = fn (x: Integer) -> Integer
+  x + 1
+end
+val typed = try
+  add("1")
+rescue err
+  err[:kind]
+end
+val divided = try
+  1 / 0
+rescue err
+  err[:kind]
+end
+val raised = try
+  panic(Error("raised", :custom))
+rescue err
+  err[:kind]
+end
+"#{[typed, divided, raised, Error("value")[:kind]]}"`, "[:type, :runtime, :error, :error]"},
+		{`try
+  panic("boom")
+rescue err
+  "#{err[:kind]} #{err[:file]}:#{err[:line]}"
+end`, ":runtime main.oro:2"},
+		{`var log = ""
+val f = fn
+  try
+    return "body"
+  ensure
+    log = "ensured"
+  end
+end
+f() + " " + log`, "body ensured"},
+		{`try
+  try
+    panic("inner")
+  ensure
+    1
+  end
+rescue err
+  err[:message]
+end`, "inner"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("main.oro", []byte(test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		testString(t, actual, test.expected)
+	}
+}
+
+func TestInterpreterDiagnosticsAreIsolated(t *testing.T) {
+	failing := New()
+	lex := lexer.New("", []byte(`missing + 1`))
+	failing.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+	if !failing.Diagnostics().HasErrors() {
+		t.Errorf("Expected an error for an unknown identifier")
+	}
+	passing := New()
+	lex = lexer.New("", []byte(`1 + 1`))
+	passing.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+	if passing.Diagnostics().HasErrors() {
+		t.Errorf("Expected no errors but got %d", passing.Diagnostics().Len())
+	}
+}
+
+func TestInterpreterNatives(t *testing.T) {
+	double := func(ctx context.Context, sc *runtime.Scope, args ...runtime.Data) (runtime.Data, error) {
+		value, ok := args[0].(*runtime.TInteger)
+		if !ok {
+			return nil, rerror.ErrorFmt("double expects an Integer")
+		}
+		return &runtime.TInteger{Value: value.Value * 2}, nil
+	}
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`double(21)`, 42},
+		{`21 |> double()`, 42},
+		{`val f = double
+f(2)`, 4},
+		{`Host.double(5)`, 10},
+		{`Host.answer`, 42},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		runner.RegisterFunction("double", double)
+		runner.RegisterModule("Host", map[string]runtime.Data{
+			"double": &runtime.TNativeFunction{Fn: double},
+			"answer": &runtime.TInteger{Value: 42},
+		})
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		testInteger(t, actual, test.expected)
+	}
+	lex := lexer.New("", []byte(`double(1)`))
+	runner := New()
+	runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+	if !runner.Diagnostics().HasErrors() {
+		t.Errorf("Expected natives to be registered per interpreter")
+	}
+	shared := &runtime.TNativeFunction{Fn: double}
+	runner.RegisterModule("A", map[string]runtime.Data{"double": shared})
+	runner.RegisterModule("B", map[string]runtime.Data{"twice": shared})
+	if shared.Name != "" {
+		t.Errorf("Expected the registered function to be left unnamed but got %s", shared.Name)
+	}
+	for _, name := range []string{"A.double", "B.twice"} {
+		lex = lexer.New("", []byte(name))
+		actual := runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		if native, ok := actual.(*runtime.TNativeFunction); !ok || native.Name != name {
+			t.Errorf("Expected %s but got %v", name, actual)
+		}
+	}
+}
+
+func TestInterpreterResolveErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"record(1)\nmissing", "Resolve Error [Line 2:1]: Identifier 'missing' not found in current memory"},
+		{"record(1)\nval a = 1\nval a = 2", "Resolve Error [Line 3:5]: Identifier 'a' already declared"},
+	}
+	for _, test := range tests {
+		calls := 0
+		record := func(ctx context.Context, sc *runtime.Scope, args ...runtime.Data) (runtime.Data, error) {
+			calls++
+			return runtime.Nil, nil
+		}
+		lex := lexer.New("", []byte(test.input))
+		runner := New()
+		runner.RegisterFunction("record", record)
+		runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		errors := runner.Diagnostics().Errors()
+		if len(errors) != 1 || errors[0].String() != test.expected {
+			t.Errorf("Expected %q but got %v", test.expected, errors)
+		}
+		if calls != 0 {
+			t.Errorf("Expected nothing to run before the names were resolved but got %d calls", calls)
+		}
+	}
+}
+
+func TestInterpreterLimits(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		input    string
+		limits   Limits
+		ctx      context.Context
+		expected error
+	}{
+		{`repeat
+  1
+end`, Limits{MaxSteps: 1000}, context.Background(), ErrStepLimit},
+		{`val f = fn x
+  1 + f(x + 1)
+end
+f(1)`, Limits{MaxCallDepth: 100}, context.Background(), ErrCallDepth},
+		{`(1..100000) as Array`, Limits{MaxCollectionSize: 1000}, context.Background(), ErrCollectionSize},
+		{`(0..1000000000000) as Array`, Limits{MaxCollectionSize: 100}, context.Background(), ErrCollectionSize},
+		{`Array(0..1000000000000)`, Limits{MaxCollectionSize: 100}, context.Background(), ErrCollectionSize},
+		{`Type.toArray(0..1000000000000)`, Limits{MaxCollectionSize: 100}, context.Background(), ErrCollectionSize},
+		{`Enum.take(0..1000000000000, 1000000000000)`, Limits{MaxCollectionSize: 100}, context.Background(), ErrCollectionSize},
+		{`Enum.map(0..1000000000000, (x) -> x)`, Limits{MaxCollectionSize: 100}, context.Background(), ErrCollectionSize},
+		{`var a = []
+repeat
+  a = a + [1]
+end`, Limits{MaxCollectionSize: 100}, context.Background(), ErrCollectionSize},
+		{`repeat
+  1
+end`, Limits{}, canceled, context.Canceled},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		runner.SetLimits(test.limits)
+		runner.SetContext(test.ctx)
+		if actual := runner.Interpreter(program, runtime.NewScope()); actual != nil {
+			t.Errorf("Expected nil but got %s", actual.Check())
+		}
+		if runner.Halted() != test.expected {
+			t.Errorf("Expected %v but got %v", test.expected, runner.Halted())
+		}
+		errors := runner.Diagnostics().Errors()
+		if len(errors) != 1 || errors[0].Kind != rerror.Limit {
+			t.Errorf("Expected a single %s but got %v", rerror.Limit, errors)
+		}
+	}
+}
+
+func TestInterpreterError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`Error("failed")[:message]`, "failed"},
+		{`Error("failed", :io)[:tag] + ""`, "io"},
+		{`Error("failed", :io, "file.txt")[:payload]`, "file.txt"},
+		{`Error("failed") is Error ? "yes" : "no"`, "yes"},
+		{`typeof(Error("failed"))`, "Error"},
+		{`match Error("failed", :io)
+when :parse
+  "parse"
+when :io
+  "io"
+end`, "io"},
+		{`val f = fn (e: Error) -> String
+  e[:message]
+end
+f(Error("typed"))`, "typed"},
+		{`try
+  panic(Error("raised", :custom, 1))
+rescue err
+  err[:tag] + ""
+end`, "custom"},
+		{`val n = Type.parseInteger("ten")
+n[:tag] + ":" + n[:payload]`, "invalid_integer:ten"},
+		{`val inner = fn
+  Error("deep")
+end
+val outer = fn
+  inner()
+end
+outer()[:stack][0] + " " + outer()[:stack][1]`, "inner [Line 2:8] outer [Line 5:8]"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		testString(t, actual, test.expected)
+	}
+}
+
+func TestInterpreterTrace(t *testing.T) {
+	input := `val check = fn (x: Integer) -> Integer
+  x + 1
+end
+val run = fn xs
+  Enum.map(xs, (x) -> check(x))
+end
+run([1, "2"])`
+	lex := lexer.New("main.oro", []byte(input))
+	runner := New()
+	runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+	errors := runner.Diagnostics().Errors()
+	if len(errors) != 1 {
+		t.Fatalf("Expected %d error but got %d", 1, len(errors))
+	}
+	expected := []struct {
+		name string
+		file string
+	}{
+		{"fun", "main.oro"},
+		{"Enum.map", "<stdlib:Enum>"},
+		{"run", "main.oro"},
+		{"<main>", "main.oro"},
+	}
+	trace := errors[0].Trace
+	if len(trace) != len(expected) {
+		t.Fatalf("Expected %d frames but got %v", len(expected), trace)
+	}
+	for idx, frame := range trace {
+		if frame.Name != expected[idx].name || frame.File != expected[idx].file {
+			t.Errorf("Expected %s in %s but got %s in %s", expected[idx].name, expected[idx].file, frame.Name, frame.File)
+		}
+	}
+	if main := trace[len(trace)-1]; main.Row != 7 || main.Col != 4 {
+		t.Errorf("Expected the call at %d:%d but got %d:%d", 7, 4, main.Row, main.Col)
+	}
+}
+
+func TestInterpreterUseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oro")
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"main.oro":       "use \"lib/other\"\nfail()",
+		"lib/other.oro":  "use helper\nval fail = fn\n  helper()\nend",
+		"lib/helper.oro": "val helper = fn\n  missing + 1\nend",
+	}
+	os.Mkdir(filepath.Join(dir, "lib"), 0755)
+	for name, source := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(source), 0644); err != nil {
+			t.Fatalf("Expected no error but got %s", err)
+		}
+	}
+	main := filepath.Join(dir, "main.oro")
+	lex := lexer.New(main, []byte(files["main.oro"]))
+	runner := New()
+	runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+	errors := runner.Diagnostics().Errors()
+	if len(errors) != 1 {
+		t.Fatalf("Expected %d error but got %v", 1, errors)
+	}
+	helper := filepath.Join(dir, "lib", "helper.oro")
+	expected := fmt.Sprintf("%s:2:3: Runtime Error: Identifier 'missing' not found in current memory", helper)
+	if errors[0].String() != expected {
+		t.Errorf("Expected %s but got %s", expected, errors[0].String())
+	}
+	trace := errors[0].Trace
+	if len(trace) != 3 {
+		t.Fatalf("Expected %d frames but got %v", 3, trace)
+	}
+	if caller := trace[1]; caller.File != filepath.Join(dir, "lib", "other.oro") || caller.Row != 3 {
+		t.Errorf("Expected the call in other.oro:%d but got %s", 3, caller)
+	}
+	if caller := trace[2]; caller.File != main || caller.Row != 2 {
+		t.Errorf("Expected the call in main.oro:%d but got %s", 2, caller)
+	}
+}
+
+func TestInterpreterScopedImmutability(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val x = 1
+val f = fn
+  var x = 2
+  x = x + 10
+  x
+end
+[f(), x]`, "[12, 1]"},
+		{`var count = 0
+val inc = fn do count = count + 1 end
+inc()
+inc()
+count`, "2"},
+		{`val make = fn
+  val count = 100
+  fn do count end
+end
+var count = 1
+count = make()()
+count`, "100"},
+		{`val x = 1
+if true
+  val x = 2
+  x
+end`, "2"},
+		{`Enum.first([1])
+var first = 1
+first = 2
+first`, "2"},
+		{`var i = 10
+repeat i in [1, 2]
+  i
+end
+i`, "10"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		if actual == nil || actual.Check() != test.expected {
+			t.Errorf("Expected %s but got %v", test.expected, actual)
 		}
 	}
 }
+
+func TestInterpreterScopedImmutabilityErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val make = fn
+  val y = 1
+  fn do y = 2 end
+end
+make()()`, "Identifier 'y' is immutable"},
+		{`var x = 1
+val f = fn
+  val x = 2
+  x = 3
+end
+f()`, "Identifier 'x' is immutable"},
+		{`val x = 1
+var x = 2`, "Identifier 'x' already declared"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		runner := New()
+		runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		errors := runner.Diagnostics().Errors()
+		if len(errors) == 0 || errors[0].Message != test.expected {
+			t.Errorf("Expected %q but got %v", test.expected, errors)
+		}
+	}
+}
+
+func TestInterpreterHints(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Enum.sise([1])", "did you mean `Enum.size`?"},
+		{"Enm.size([1])", "did you mean `Enum`?"},
+		{"val value = 1\nvaleu + 1", "did you mean `value`?"},
+		{"prinln(1)", "did you mean `println`?"},
+		{"unknown + 1", ""},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		runner := New()
+		runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		errors := runner.Diagnostics().Errors()
+		if len(errors) != 1 {
+			t.Fatalf("Expected %d error but got %d", 1, len(errors))
+		}
+		if errors[0].Hint != test.expected {
+			t.Errorf("Expected %q but got %q", test.expected, errors[0].Hint)
+		}
+	}
+}
+
+func TestInterpreterStruct(t *testing.T) {
+	definitions := `struct Point x: Float, y: Float end
+struct Line
+  start: Point
+  finish: Point
+  label
+end
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`Point(1.0, 2.0)`, "Point(x: 1.000000, y: 2.000000)"},
+		{`Point(1.0, 2.0).y`, "2.000000"},
+		{`var p = Point(1.0, 2.0)
+p.x = 3.0
+p.y += 1.0
+p`, "Point(x: 3.000000, y: 3.000000)"},
+		{`var l = Line(Point(0.0, 0.0), Point(1.0, 1.0), "a")
+l.finish.x = 2.0
+l.finish.x`, "2.000000"},
+		{`Point(1.0, 2.0) is Point`, "true"},
+		{`[Point(1.0, 2.0) == Point(1.0, 2.0), Point(1.0, 2.0) != Point(1.0, 3.0), Point(1.0, 2.0) == nil]`, "[true, true, false]"},
+		{`typeof(Line(Point(0.0, 0.0), Point(0.0, 0.0), nil)) + " " + typeof(Point)`, "Line Struct"},
+		{`val norm = fn (p: Point) -> Float
+  p.x + p.y
+end
+norm(Point(1.0, 2.0))`, "3.000000"},
+		{`match Line(Point(0.0, 1.0), Point(2.0, 3.0), "a")
+when Line(Point(1.0, _), _, _)
+  "one"
+when Line(Point(0.0, y), Point(x, _), label)
+  "#{label} #{x} #{y}"
+end`, "a 2.000000 1.000000"},
+		{`val P = Point
+val [P(x, y)] = [Point(1.0, 2.0)]
+var total = x + y
+repeat [P(a, _)] in [[Point(3.0, 0.0)]]
+  total += a
+end
+total`, "6.000000"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(definitions+test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		if actual == nil || actual.Check() != test.expected {
+			t.Errorf("Expected %s but got %v", test.expected, actual)
+		}
+	}
+}
+
+func TestInterpreterPatterns(t *testing.T) {
+	definitions := `val describe = fn x
+  match x
+    when [] then "empty"
+    when [first: Integer, ...rest] if first > 10 then "big #{first} #{rest}"
+    when [[a, b], ...] then "pair #{a} #{b}"
+    when [first, ..._] then "first #{first}"
+    when [:status => 200, :body => body] then "ok #{body}"
+    when [:status => status] then "status #{status}"
+    when n: Integer if n < 0 then "negative"
+    when 0..9 then "digit"
+    when "a".."m" then "early"
+    when n: Integer, n: Float then "number #{n}"
+    when s: String then "string #{s}"
+    else then "other"
+  end
+end
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`describe([])`, "empty"},
+		{`describe([11, 2, 3])`, "big 11 [2, 3]"},
+		{`describe([[1, 2], 3])`, "pair 1 2"},
+		{`describe([1, 2, 3])`, "first 1"},
+		{`describe([:status => 200, :body => "hi", :size => 2])`, "ok hi"},
+		{`describe([:status => 404])`, "status 404"},
+		{`describe([:body => "hi"])`, "other"},
+		{`describe(-3)`, "negative"},
+		{`describe(7)`, "digit"},
+		{`describe(70)`, "number 70"},
+		{`describe(70.5)`, "number 70.500000"},
+		{`describe("c")`, "early"},
+		{`describe("x")`, "string x"},
+		{`describe(true)`, "other"},
+		{`match [1, 2]
+when [x, y] if x > y then "down"
+when [x, y] if x < y then "up #{x} #{y}"
+end`, "up 1 2"},
+		{`val x = 5
+match [1]
+when [x] then x
+end`, "1"},
+		{`val x = 5
+match [1]
+when [x] then x
+end
+x`, "5"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(definitions+test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		if actual == nil || actual.Check() != test.expected {
+			t.Errorf("Expected %s but got %v", test.expected, actual)
+		}
+	}
+}
+
+func TestInterpreterPatternErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match [1, 2]
+when [...rest, x] then x
+end`, "Rest pattern '...rest' must be the last element of an array pattern"},
+		{`match 1
+when n: Integr then n
+end`, "Unknown type 'Integr' in type pattern"},
+		{`match 1
+when n: Integer if n then n
+end`, "Match guard expects a Boolean but got 'Integer'"},
+		{`match [1]
+when [x] then x
+end
+x`, "Identifier 'x' not found in current memory"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		runner := New()
+		runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		errors := runner.Diagnostics().Errors()
+		if len(errors) == 0 || errors[0].Message != test.expected {
+			t.Errorf("Expected %q but got %v", test.expected, errors)
+		}
+	}
+}
+
+func TestInterpreterDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val [a, b, ...rest] = [1, 2, 3, 4]
+[a, b, rest]`, "[1, 2, [3, 4]]"},
+		{`val [:name => n, :age => age: Integer] = [:name => "Ann", :age => 30, :id => 1]
+n + " #{age}"`, "Ann 30"},
+		{`var [x, [y, _]] = [1, [2, 3]]
+x = 10
+x + y`, "12"},
+		{`val [first, ...] = "ab" |> String.split("")
+first`, "a"},
+		{`repeat [k, v] in [["a", 1], ["b", 2]]
+  k + " #{v}"
+end`, "[a 1, b 2]"},
+		{`repeat i, [k, _] in [["a", 1], ["b", 2]]
+  "#{i}#{k}"
+end`, "[0a, 1b]"},
+		{`repeat key, [:v => v] in [:one => [:v => 1]]
+  v
+end`, "[1]"},
+		{`module M
+  val [one, two] = [1, 2]
+end
+M.two`, "2"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		if actual == nil || actual.Check() != test.expected {
+			t.Errorf("Expected %s but got %v", test.expected, actual)
+		}
+	}
+}
+
+func TestInterpreterDestructuringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val [a, b] = [1]`, "Array pattern expects 2 elements but got 1"},
+		{`val [a, b, ...rest] = [1]`, "Array pattern expects at least 2 elements but got 1"},
+		{`val [a] = 5`, "Can't destructure type 'Integer' as an array"},
+		{`val [:id => a] = [1]`, "Can't destructure type 'Array' as a dictionary"},
+		{`val [:id => a] = [:name => 1]`, "Key ':id' not found in dictionary to destructure"},
+		{`val [[a]] = [[1, 2]]`, "Array pattern expects 1 elements but got 2"},
+		{`val [a: String] = [1]`, "Type pattern 'a: String' expects type 'String' but got 'Integer'"},
+		{`val [a, 2] = [1, 3]`, "Value '3' doesn't match '2' in pattern"},
+		{`val [a, a] = [1, 2]`, "Identifier 'a' bound twice in pattern"},
+		{`val a = 1
+val [a] = [2]`, "Identifier 'a' already declared"},
+		{`val [a] = [1]
+a = 2`, "Identifier 'a' is immutable"},
+		{`repeat [k, v] in [[1]]
+  k
+end`, "Array pattern expects 2 elements but got 1"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		runner := New()
+		runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		errors := runner.Diagnostics().Errors()
+		if len(errors) == 0 || errors[0].Message != test.expected {
+			t.Errorf("Expected %q but got %v", test.expected, errors)
+		}
+	}
+}
+
+func TestInterpreterEnum(t *testing.T) {
+	definitions := `enum Shape
+  Circle(r: Float)
+  Rect(w, h)
+  Empty
+end
+val area = fn s
+  match s
+    when Shape.Circle(r) then r * r
+    when Shape.Rect(w, h) then w * h
+    when Shape.Empty then 0.0
+  end
+end
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`Shape.Rect(1, 2)`, "Shape.Rect(w: 1, h: 2)"},
+		{`Shape.Empty`, "Shape.Empty"},
+		{`[Shape.Rect(1, 2) == Shape.Rect(1, 2), Shape.Rect(1, 2) == Shape.Rect(1, "2"), Shape.Empty != Shape.Empty, Shape.Empty in [Shape.Empty]]`, "[true, false, false, true]"},
+		{`Shape.Rect(1, 2).h`, "2"},
+		{`typeof(Shape.Empty) + " " + typeof(Shape)`, "Shape Enum"},
+		{`Shape.Circle`, "Shape.Circle(r: Float)"},
+		{`area(Shape.Circle(2.0)) + area(Shape.Rect(1.0, 2.0)) + area(Shape.Empty)`, "6.000000"},
+		{`match Shape.Rect(2, 3)
+when Shape.Rect(1, h) then "one"
+when Shape.Rect(_, 3) then "three"
+else then "other"
+end`, "three"},
+		{`match Shape.Rect(Shape.Circle(1.0), 3)
+when Shape.Rect(Shape.Circle(r), h) then r
+when Shape.Circle, Shape.Rect, Shape.Empty then 0
+end`, "1.000000"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(definitions+test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		if actual == nil || actual.Check() != test.expected {
+			t.Errorf("Expected %s but got %v", test.expected, actual)
+		}
+	}
+}
+
+func TestInterpreterEnumErrors(t *testing.T) {
+	definitions := "enum Shape Circle(r: Float), Rect(w, h), Empty end\n"
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`Shape.Circle(1)`, "Field 'r' of variant 'Shape.Circle' asks for type 'Float' but got 'Integer'"},
+		{`Shape.Rect(1)`, "Variant 'Shape.Rect' expects 2 fields but got 1"},
+		{`Shape.Square`, "Variant 'Square' not found in enum 'Shape'"},
+		{`Shape.Rect(1, 2).r`, "Field 'r' not found in variant 'Shape.Rect(w, h)'"},
+		{`var s = Shape.Rect(1, 2)
+s.w = 3`, "Fields of enum variants can't be assigned"},
+		{`enum Shape A end`, "Enum 'Shape' redeclared"},
+		{`struct Shape x end`, "Struct 'Shape' redeclared"},
+		{`match Shape.Empty
+when Shape.Circle(r) then r
+when Shape.Rect(1, h) then h
+end`, "Non-exhaustive match over enum 'Shape', missing Shape.Rect, Shape.Empty"},
+		{`match Shape.Empty
+when Shape.Rect(w) then w
+else then 0
+end`, "Pattern for variant 'Shape.Rect' expects 2 fields but got 1"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(definitions+test.input))
+		runner := New()
+		runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		errors := runner.Diagnostics().Errors()
+		if len(errors) == 0 || errors[0].Message != test.expected {
+			t.Errorf("Expected %q but got %v", test.expected, errors)
+		}
+	}
+}
+
+func TestInterpreterStructErrors(t *testing.T) {
+	definitions := "struct Point x: Float, y: Float end\n"
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`Point(1.0)`, "Struct 'Point' expects 2 fields but got 1"},
+		{`Point(1, 2)`, "Field 'x' of struct 'Point' asks for type 'Float' but got 'Integer'"},
+		{`Point(1.0, 2.0).z`, "Field 'z' not found in struct 'Point'"},
+		{`val p = Point(1.0, 2.0)
+p.x = 3.0`, "Identifier 'p' is immutable"},
+		{`var p = Point(1.0, 2.0)
+p.x = "a"`, "Field 'x' of struct 'Point' asks for type 'Float' but got 'String'"},
+		{`struct Point z end`, "Struct 'Point' redeclared"},
+		{`struct String z end`, "Struct 'String' can't take the name of a builtin type"},
+		{`val f = fn (p: Pont)
+  p
+end
+f(1)`, "Unknown type 'Pont' in function parameter"},
+		{`match Point(1.0, 2.0)
+when Point(x)
+  x
+end`, "Pattern for struct 'Point' expects 2 fields but got 1"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(definitions+test.input))
+		runner := New()
+		runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		errors := runner.Diagnostics().Errors()
+		if len(errors) == 0 || errors[0].Message != test.expected {
+			t.Errorf("Expected %q but got %v", test.expected, errors)
+		}
+	}
+}
+
+func TestInterpreterGenerators(t *testing.T) {
+	definitions := `val counter = fn (start: Integer)
+  var n = start
+  repeat
+    yield n
+    n += 1
+  end
+end
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`counter(1)`, "Sequence(counter)"},
+		{`(counter(1) |> Enum.take(3)) as Array`, "[1, 2, 3]"},
+		{`(counter(1) |> Enum.filter((x) -> x % 2 == 0) |> Enum.map((x) -> x * 10) |> Enum.take(2)) as Array`, "[20, 40]"},
+		{`val firsts = counter(0) |> Enum.take(2)
+Array(firsts) + Array(firsts)`, "[0, 1, 0, 1]"},
+		{`var total = 0
+repeat i, v in counter(10)
+  if i == 3
+    break
+  end
+  total += v
+end
+total`, "33"},
+		{`Enum.reduce(Enum.take(counter(1), 4), 0, (v, acc) -> v + acc)`, "10"},
+		{`Enum.find(counter(1), (v) -> v * v > 50)`, "8"},
+		{`Enum.size(Enum.take(counter(1), 5))`, "5"},
+		{`Enum.take([1, 2, 3], 2)`, "[1, 2]"},
+		{`val three = Enum.take(counter(1), 3)
+[Enum.first(counter(5)), Enum.last(three), Enum.reverse(three), Enum.unique(three), Enum.delete(three, 0)]`, "[5, 3, [3, 2, 1], [1, 2, 3], [2, 3]]"},
+		{`[Enum.reverse(1..3 |> Enum.map((x) -> x * 2)), Enum.reverse(3..1), Enum.first([]), Enum.reverse([])]`, "[[6, 4, 2], [1, 2, 3], nil, []]"},
+		{`val pairs = fn (items: Array)
+  repeat [k, v] in items
+    yield k + v
+  end
+end
+pairs([[1, 2], [3, 4]]) as Array`, "[3, 7]"},
+		{`val once = (x) -> yield x
+once(4) as Array`, "[4]"},
+		{`val empty = fn
+  return nil
+  yield 1
+end
+empty() as Array`, "[]"},
+		{`counter(1) is Sequence`, "true"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(definitions+test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		if actual == nil || actual.Check() != test.expected {
+			t.Errorf("Expected %s but got %v", test.expected, actual)
+		}
+	}
+}
+
+func TestInterpreterGeneratorErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val bad = fn
+  yield 1
+  yield 1 + []
+end
+bad() as Array`, "Cannot run expression with types 'Integer' and 'Array'"},
+		{`val bad = fn (n: Integer)
+  yield n
+end
+bad("1")`, "Function asks for type 'Integer' but got 'String'"},
+		{`val typed = fn -> Array
+  yield 1
+end
+typed()`, "Function asks for type 'Array' but got 'Sequence'"},
+		{`val gen = fn
+  yield 1
+  yield 2
+end
+repeat v in gen()
+  v + []
+end`, "Cannot run expression with types 'Integer' and 'Array'"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		runner := New()
+		runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		errors := runner.Diagnostics().Errors()
+		if len(errors) != 1 || errors[0].Message != test.expected {
+			t.Errorf("Expected %q but got %v", test.expected, errors)
+		}
+	}
+}
+
+func TestInterpreterEnumArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`Enum.size(5)`, "Function asks for type 'Enumerable' but got 'Integer'"},
+		{`Enum.map("ab", (x) -> x)`, "Function asks for type 'Enumerable' but got 'String'"},
+		{`Enum.reverse(5)`, "Function asks for type 'Enumerable' but got 'Integer'"},
+		{`Enum.first(true)`, "Function asks for type 'Enumerable' but got 'Boolean'"},
+		{`Enum.reduce(:a, 0, (v, acc) -> acc)`, "Function asks for type 'Enumerable' but got 'Symbol'"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("main.oro", []byte(test.input))
+		runner := New()
+		runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		errors := runner.Diagnostics().Errors()
+		if len(errors) != 1 || errors[0].Message != test.expected {
+			t.Errorf("Expected %q but got %v", test.expected, errors)
+			continue
+		}
+		if errors[0].File != "main.oro" || errors[0].Row != 1 {
+			t.Errorf("Expected the error at the call in %s but got %s:%d", "main.oro", errors[0].File, errors[0].Row)
+		}
+	}
+}
+
+func TestInterpreterTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val countdown = fn (n: Integer) -> Integer
+  if n == 0
+    return 0
+  end
+  countdown(n - 1)
+end
+countdown(1_000_000)`, "0"},
+		{`val even = fn n
+  match n
+    when 0 then true
+    else then odd(n - 1)
+  end
+end
+val odd = fn n
+  if n == 0 then false else even(n - 1) end
+end
+[even(100_001), odd(100_001)]`, "[false, true]"},
+		{`val find = fn (xs, target, idx)
+  repeat x in xs
+    if x == target
+      return idx
+    end
+    return find(Enum.filter(xs, (v) -> v != x), target, idx + 1)
+  end
+  -1
+end
+find([1, 2, 3], 3, 0)`, "2"},
+		{`val fails = fn n
+  if n == 0
+    return 1 / 0
+  end
+  fails(n - 1)
+end
+val safe = fn n
+  try
+    fails(n)
+  rescue err
+    err[:message]
+  end
+end
+safe(10)`, "Division by 0"},
+		{`val sum = fn (n, acc = 0)
+  if n == 0 then acc else sum(n - 1, acc + n) end
+end
+sum(100_000)`, "5000050000"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		runner.SetLimits(Limits{MaxCallDepth: 50})
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		if actual == nil || actual.Check() != test.expected {
+			t.Errorf("Expected %s but got %v", test.expected, actual)
+		}
+	}
+}
+
+func TestInterpreterTailCallErrors(t *testing.T) {
+	input := `val text = fn (n) -> String
+  number(n)
+end
+val number = fn (n) -> Integer
+  if n == 0
+    return 1 / 0
+  end
+  number(n - 1)
+end
+text(0)
+text(1_000)`
+	lex := lexer.New("main.oro", []byte(input))
+	runner := New()
+	runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+	errors := runner.Diagnostics().Errors()
+	if len(errors) != 2 {
+		t.Fatalf("Expected %d errors but got %v", 2, errors)
+	}
+	if expected := "Division by 0"; errors[0].Message != expected {
+		t.Errorf("Expected %s but got %s", expected, errors[0].Message)
+	}
+	if len(errors[0].Trace) != 3 {
+		t.Errorf("Expected %d frames but got %v", 3, errors[0].Trace)
+	}
+	if len(errors[1].Trace) != maxTailFrames+1 {
+		t.Errorf("Expected %d frames but got %d", maxTailFrames+1, len(errors[1].Trace))
+	}
+}
+
+func TestInterpreterTasks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val task = spawn fn
+  1 + 2
+end
+await task`, "3"},
+		{`spawn fn
+  1
+end`, "Task(<fn>)"},
+		{`Channel(2)`, "Channel(2)"},
+		{`val ch = Channel()
+val producer = spawn fn
+  repeat x in 1..3
+    ch.send(x * 10)
+  end
+  ch.close()
+end
+var received = []
+repeat v in ch
+  received += [v]
+end
+received`, "[10, 20, 30]"},
+		{`val jobs = Channel(2)
+val results = Channel()
+val worker = fn
+  repeat j in jobs
+    results.send(j * j)
+  end
+end
+val workers = [spawn worker, spawn worker]
+spawn fn
+  repeat j in 1..6
+    jobs.send(j)
+  end
+  jobs.close()
+end
+var total = 0
+repeat k in 1..6
+  total += results.receive()
+end
+total`, "91"},
+		{`val ch = Channel(1)
+select
+  when v = ch.receive() then v
+  else then "empty"
+end`, "empty"},
+		{`val a = Channel()
+val b = Channel()
+spawn fn
+  b.send("b")
+end
+select
+  when v = a.receive() then "a" + v
+  when v = b.receive() then "from " + v
+end`, "from b"},
+		{`val out = Channel()
+val reader = spawn fn
+  out.receive()
+end
+select
+  when out.send(42) then nil
+end
+await reader`, "42"},
+		{`val ch = Channel()
+ch.close()
+[ch.receive(), ch.receive()]`, "[nil, nil]"},
+		{`val failing = spawn fn
+  1 / 0
+end
+try
+  await failing
+rescue err
+  err[:message]
+end`, "Division by 0"},
+		{`val stuck = spawn fn
+  Channel().receive()
+end
+try
+  await stuck
+rescue err
+  err[:message]
+end`, "Deadlock: every task is blocked"},
+		{`val ch = Channel()
+val sender = spawn fn
+  try
+    ch.send(1)
+  rescue err
+    err[:message]
+  end
+end
+spawn fn
+  ch.close()
+end
+await sender`, "Can't send on a closed channel"},
+		{`var count = 0
+val tasks = [1, 2] |> Enum.map((n) -> spawn fn
+  repeat i in 1..500
+    count += 0
+  end
+  n
+end)
+tasks |> Enum.map((task) -> await task)`, "[1, 2]"},
+		{`val task = spawn fn
+  1
+end
+task is Task`, "true"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		if actual == nil || actual.Check() != test.expected {
+			t.Errorf("Expected %s but got %v", test.expected, actual)
+		}
+	}
+}
+
+func TestInterpreterTaskErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`spawn 1`, "SPAWN expects a function but got 'Integer'"},
+		{`await 1`, "AWAIT expects a Task but got 'Integer'"},
+		{`Channel().receive()`, "Deadlock: every task is blocked"},
+		{`val ch = Channel()
+ch.close()
+ch.close()`, "Channel already closed"},
+		{`val ch = Channel(1)
+ch.close()
+ch.send(1)`, "Can't send on a closed channel"},
+		{`Channel().sned(1)`, "Channel has no method 'sned'"},
+		{`Channel(-1)`, "Channel() expects a capacity as a positive Integer but got '-1'"},
+		{`select
+  when v = [].receive() then v
+end`, "SELECT WHEN expects a Channel but got 'Array'"},
+		{`val task = spawn fn
+  [] + 1
+end
+await task`, "Cannot run expression with types 'Array' and 'Integer'"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		runner := New()
+		runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		errors := runner.Diagnostics().Errors()
+		if len(errors) != 1 || errors[0].Message != test.expected {
+			t.Errorf("Expected %q but got %v", test.expected, errors)
+		}
+	}
+}
+
+func TestInterpreterDictionary(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val d = [1 => "integer", "1" => "string", 1.0 => "float", :a => "symbol", "a" => "text"]
+[d[1], d["1"], d[1.0], d[:a], d["a"]]`, "[integer, string, float, symbol, text]"},
+		{`var d = [=>]
+d[1] = "one"
+d["1"] = "text"
+d[1] = "uno"
+d`, "[1 => uno, 1 => text]"},
+		{`val d = [[1, 2] => "pair", [:x => 1] => "dict", nil => "none", true => "yes"]
+[d[[1, 2]], d[[:x => 1]], d[nil], d[true], d[[2, 1]]]`, "[pair, dict, none, yes, nil]"},
+		{`var d = [=>]
+repeat i in 1..100
+  d[i] = i * i
+end
+[d[1], d[50], d[100], Dictionary.size(d)]`, "[1, 2500, 10000, 100]"},
+		{`var keys = []
+repeat k, v in ["c" => 3, "a" => 1, "b" => 2]
+  keys += [k]
+end
+keys`, "[c, a, b]"},
+		{`[1 in [1 => 2], "1" in [1 => 2]]`, "[true, false]"},
+		{`[Dictionary.contains?([1 => 2], "1"), Dictionary.contains?([1 => 2], 1), Dictionary.delete([1 => 2, "1" => 3], 1)]`, "[false, true, [1 => 3]]"},
+		{`[[1 => 2, 3 => 4] == [3 => 4, 1 => 2], [1 => 2] == ["1" => 2], [1 => 2] != [1 => 3]]`, "[true, false, true]"},
+		{`[[[1]] == [["1"]], [1] in [["1"]], [1 => [1]] == [1 => ["1"]], [[1]] == [[1]], [1] in [[1]]]`, "[false, false, false, true, true]"},
+		{`match [[1]]
+when [["1"]] then "text"
+when [[1]] then "integer"
+end`, "integer"},
+		{`match ["1" => "text", 1 => "integer"]
+when [1 => v] then v
+end`, "integer"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		if actual == nil || actual.Check() != test.expected {
+			t.Errorf("Expected %s but got %v", test.expected, actual)
+		}
+	}
+}
+
+func TestInterpreterDictionaryOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[:z => 1, :a => 2, :m => 3]`, "[:z => 1, :a => 2, :m => 3]"},
+		{`var d = [:b => 1, :a => 2]
+d[:c] = 3
+d[:b] = 10
+d`, "[:b => 10, :a => 2, :c => 3]"},
+		{`var out = ""
+repeat k, v in [:z => 1, :a => 2, :m => 3]
+  out += "#{k}=#{v} "
+end
+out`, ":z=1 :a=2 :m=3 "},
+		{`[:c => 3, :a => 1] + [:a => 10, :b => 2]`, "[:c => 3, :a => 1, :b => 2]"},
+		{`val left = [:a => 1]
+val right = [:b => 2]
+left + right
+[left, right]`, "[[:a => 1], [:b => 2]]"},
+		{`Dictionary.delete([:d => 4, :b => 2, :c => 3, :a => 1], :c)`, "[:d => 4, :b => 2, :a => 1]"},
+		{`[:a => 1, :b => 2] == [:b => 2, :a => 1]`, "true"},
+		{`Enum.map([:x => 1, :y => 2, :w => 3], (v) -> v * 2)`, "[2, 4, 6]"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		if actual == nil || actual.Check() != test.expected {
+			t.Errorf("Expected %s but got %v", test.expected, actual)
+		}
+	}
+}
+
+func TestInterpreterValueSemantics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val a = [1, 2]
+val f = fn (array)
+  array[] = 3
+  array[0] = 9
+  array
+end
+[f(a), a]`, "[[9, 2, 3], [1, 2]]"},
+		{`val a = [1, 2]
+Enum.insert(a, 3)
+a`, "[1, 2]"},
+		{`var a = [1, 2]
+val b = a
+a[] = 3
+[a, b]`, "[[1, 2, 3], [1, 2]]"},
+		{`val a = [1, 2]
+val b = a + [3]
+val c = a + [4]
+[a, b, c]`, "[[1, 2], [1, 2, 3], [1, 2, 4]]"},
+		{`val d = [:a => 1]
+val f = fn (dict)
+  dict[:a] = 2
+  dict[:b] = 3
+  dict
+end
+[f(d), d]`, "[[:a => 2, :b => 3], [:a => 1]]"},
+		{`val d = [:a => 1]
+Dictionary.insert(d, :b, 2)
+d`, "[:a => 1]"},
+		{`var a = []
+repeat i in 0..2999
+  a[] = i
+end
+val b = a
+a[1500] = -1
+a[-1] = -2
+[len(a), a[1500], b[1500], a[2999], b[2999], Enum.reduce(b, 0, (acc, v) -> acc + v)]`, "[3000, -1, 1500, -2, 2999, 4498500]"},
+		{`var d = [:k => 0]
+repeat i in 0..1999
+  d[i] = i * 2
+end
+val e = d
+d[1000] = -1
+[Dictionary.size(d), d[1000], e[1000], d[1999], d[:k]]`, "[2001, -1, 2000, 3998, 0]"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		if actual == nil || actual.Check() != test.expected {
+			t.Errorf("Expected %s but got %v", test.expected, actual)
+		}
+	}
+}
+
+func TestInterpreterRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1..1_000_000_000`, "1..1000000000"},
+		{`(1..5) as Array`, "[1, 2, 3, 4, 5]"},
+		{`(3..1) as Array`, "[3, 2, 1]"},
+		{`(0..<4) as Array`, "[0, 1, 2, 3]"},
+		{`(0..100 step 25) as Array`, "[0, 25, 50, 75, 100]"},
+		{`(10..0 step 3) as Array`, "[10, 7, 4, 1]"},
+		{`(0..<10 step 5) as Array`, "[0, 5]"},
+		{`(0.0..1.0 step 0.25) as Array`, "[0.000000, 0.250000, 0.500000, 0.750000, 1.000000]"},
+		{`(0..1 step 0.5) as Array`, "[0.000000, 0.500000, 1.000000]"},
+		{`0..10 step 2`, "0..10 step 2"},
+		{`len(1..1_000_000) + len(0..<0)`, "1000000"},
+		{`[(1..10)[2], (1..10)[-1], (1..10)[10]]`, "[3, 10, nil]"},
+		{`[5 in 1..10, 11 in 1..10, 4 in 0..10 step 2, 5 in 0..10 step 2, 10 in 0..<10, 0.5 in 0.0..1.0 step 0.25]`, "[true, false, true, false, false, true]"},
+		{`[2 in [1, 2], "2" in [1, 2], :a in [:a => 1], "ell" in "hello"]`, "[true, false, true, true]"},
+		{`(1..3) == (1..3) && (1..3) != (1..<3)`, "true"},
+		{`repeat i, v in 5..<8
+  i * v
+end`, "[0, 6, 14]"},
+		{`var total = 0
+repeat v in 1..1_000_000_000
+  if v > 4
+    break
+  end
+  total += v
+end
+total`, "10"},
+		{`Enum.map(1..3, (x) -> x * 2)`, "[2, 4, 6]"},
+		{`[Enum.size(1..<4), Enum.reduce(1..100, 0, (v, acc) -> v + acc), Enum.first(3..1), Enum.last(1..<4)]`, "[3, 5050, 3, 3]"},
+		{`Enum.take(1..1_000_000_000, 3)`, "[1, 2, 3]"},
+		{`typeof(1..2) + " #{(1..2) is Range}"`, "Range true"},
+		{`[1..2 is Enumerable, [1] is Enumerable, "a" is Enumerable]`, "[true, true, false]"},
+		{`match 9
+when 0..<9 then "low"
+when 9..20 then "high"
+end`, "high"},
+		{`val big = 9007199254740993
+[(big..(big + 2)) as Array, (big..(big + 2))[1], big + 1 in big..(big + 2), len(big..(big + 4) step 2)]`, "[[9007199254740993, 9007199254740994, 9007199254740995], 9007199254740994, true, 3]"},
+		{`9007199254740993..9007199254740999 step 3`, "9007199254740993..9007199254740999 step 3"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := parser.New(lex)
+		program := parse.Parse()
+		runner := New()
+		actual := runner.Interpreter(program, runtime.NewScope())
+		checkInterpreterErrors(t, parse, runner)
+		if actual == nil || actual.Check() != test.expected {
+			t.Errorf("Expected %s but got %v", test.expected, actual)
+		}
+	}
+}
+
+func TestInterpreterRangeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`0..10 step 0`, "Range step must be positive but got '0'"},
+		{`0..10 step "2"`, "Range step expects an Integer or a Float but got 'String'"},
+		{`[1, 2] step 2`, "Operator 'step' expects a Range but got 'Array'"},
+		{`1 in 5`, "Operator 'in' expects a Range, an Array, a Dictionary or a String but got 'Integer'"},
+		{`1 in "123"`, "Operator 'in' expects a String to look for in a String but got 'Integer'"},
+		{`repeat a, b, c in 1..2
+  a
+end`, "A for loop with a range expects at most 2 arguments"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		runner := New()
+		runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		errors := runner.Diagnostics().Errors()
+		if len(errors) != 1 || errors[0].Message != test.expected {
+			t.Errorf("Expected %q but got %v", test.expected, errors)
+		}
+	}
+}
+
+func TestInterpreterVM(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string
+		compiled  int
+		fallbacks map[string]int
+	}{
+		{`val fib = fn (n: Integer) -> Integer
+  if n < 2 then n else fib(n - 1) + fib(n - 2) end
+end
+fib(15)`, "610", 1, map[string]int{"Function": 1}},
+		{`val sum = fn (xs)
+  var total = 0
+  repeat i, x in xs
+    if x % 2 == 0
+      continue
+    end
+    if i > 6
+      break
+    end
+    total += x * i
+  end
+  total
+end
+sum(1..20)`, "68", 1, map[string]int{"Function": 1}},
+		{`val count = 0
+var calls = 0
+val greet = fn (name)
+  calls += 1
+  val text = "hi #{name}, #{calls}"
+  len(text) > 3 && text != "" ? text : "none"
+end
+[greet("ana"), greet(:bob), calls]`, "[hi ana, 1, hi :bob, 2, 2]", 1, map[string]int{"Function": 1}},
+		{`val pairs = fn (d)
+  var keys = []
+  repeat k, v in d
+    keys += [k + v]
+  end
+  keys
+end
+pairs(["a" => "b"])`, "[ab]", 1, map[string]int{"Function": 1, "Dictionary": 1}},
+		{`val loop = fn (n)
+  var i = 0
+  repeat
+    i += 1
+    if i >= n
+      return i
+    end
+  end
+  0
+end
+loop(5)`, "5", 1, map[string]int{"Function": 1}},
+		{`val outer = fn (xs)
+  val inner = (x) -> x * 2
+  Enum.map(xs, inner)
+end
+outer([1, 2])`, "[2, 4]", 1, map[string]int{"Function": 2, "Is": 1}},
+		{`var total = 0
+repeat i in 1..4
+  total += i
+end
+val label = match total with when 10 then "ten" else then "other" end
+[total, label]`, "[10, ten]", 0, map[string]int{"Match": 1}},
+		{`val base = 2
+if base > 1
+  val double = (x) -> x * base
+  double(3)
+end`, "6", 1, map[string]int{"Function": 1}},
+	}
+	for _, test := range tests {
+		results := map[Engine]string{}
+		for _, engine := range []Engine{EngineTree, EngineVM} {
+			lex := lexer.New("", []byte(test.input))
+			parse := parser.New(lex)
+			program := parse.Parse()
+			runner := New()
+			runner.SetEngine(engine)
+			actual := runner.Interpreter(program, runtime.NewScope())
+			checkInterpreterErrors(t, parse, runner)
+			if actual != nil {
+				results[engine] = actual.Check()
+			}
+			if engine != EngineVM {
+				continue
+			}
+			compiled := 0
+			for _, code := range runner.chunks {
+				if code != nil {
+					compiled++
+				}
+			}
+			if compiled != test.compiled {
+				t.Errorf("Expected %d compiled functions but got %d", test.compiled, compiled)
+			}
+			if !reflect.DeepEqual(runner.fallbacks, test.fallbacks) {
+				t.Errorf("Expected the tree to run %v but got %v", test.fallbacks, runner.fallbacks)
+			}
+		}
+		for engine, result := range results {
+			if result != test.expected {
+				t.Errorf("Expected %s but got %s on engine %d", test.expected, result, engine)
+			}
+		}
+	}
+}
+
+func TestInterpreterVMErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val f = fn (x: Integer)
+  x + 1
+end
+f("a")`, "Function asks for type 'Integer' but got 'String'"},
+		{`val f = (x) -> x + 1
+f(1, 2)`, "Too many arguments in function call"},
+		{`val f = fn (x)
+  var y = 1
+  y = "a"
+end
+f(1)`, "Variable assignment should keep the original data type 'Integer'"},
+		{`val limit = 1
+val f = fn (x)
+  limit = x
+end
+f(2)`, "Identifier 'limit' is immutable"},
+		{`val f = fn (x)
+  repeat v in x
+    v
+  end
+  nil
+end
+f(1)`, "Type Integer is not an enumerable"},
+		{`val f = (x) -> missing + x
+f(1)`, "Identifier 'missing' not found in current memory"},
+		{`val f = (x) -> -x / 0
+f(3)`, "Division by 0"},
+		{`val spin = fn (n)
+  repeat
+    n += 1
+  end
+  n
+end
+spin(0)`, ErrStepLimit.Error()},
+		{`val grow = fn (n)
+  var items = []
+  repeat
+    items += [n]
+  end
+  items
+end
+grow(0)`, ErrCollectionSize.Error()},
+		{`val limit = 1
+limit = 2
+limit + 1`, "Identifier 'limit' is immutable"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		runner := New()
+		runner.SetEngine(EngineVM)
+		runner.SetLimits(Limits{MaxSteps: 10_000, MaxCollectionSize: 100})
+		runner.Interpreter(parser.New(lex).Parse(), runtime.NewScope())
+		errors := runner.Diagnostics().Errors()
+		if len(errors) != 1 || errors[0].Message != test.expected {
+			t.Errorf("Expected %q but got %v", test.expected, errors)
+		}
+	}
+}
+
+func benchmarkEngine(b *testing.B, engine Engine) {
+	input := `val fib = (n) -> n < 2 ? n : fib(n - 1) + fib(n - 2)
+val sum = fn (n)
+  var total = 0
+  repeat i in 0..n
+    total += i * 2 - 1
+  end
+  total
+end
+[fib(20), sum(100_000)]`
+	program := parser.New(lexer.New("", []byte(input))).Parse()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		runner := New()
+		runner.SetEngine(engine)
+		if runner.Interpreter(program, runtime.NewScope()) == nil {
+			b.Fatal(runner.Diagnostics().Errors())
+		}
+	}
+}
+
+func BenchmarkTree(b *testing.B) {
+	benchmarkEngine(b, EngineTree)
+}
+
+func BenchmarkVM(b *testing.B) {
+	benchmarkEngine(b, EngineVM)
+}
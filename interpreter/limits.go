@@ -0,0 +1,133 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package interpreter implements functions to limit an interpreter run.
+package interpreter
+
+import (
+	"errors"
+	"github.com/luiscm/oro/ast"
+	"github.com/luiscm/oro/rerror"
+	"github.com/luiscm/oro/runtime"
+)
+
+const cancelCheckInterval = 256
+
+var (
+	ErrStepLimit      = errors.New("Step limit exceeded")
+	ErrCallDepth      = errors.New("Call depth limit exceeded")
+	ErrCollectionSize = errors.New("Collection size limit exceeded")
+)
+
+type Limits struct {
+	MaxSteps          int64
+	MaxCallDepth      int
+	MaxCollectionSize int
+}
+
+func (i *Interpreter) SetLimits(limits Limits) {
+	i.limits = limits
+}
+
+func (i *Interpreter) Halted() error {
+	return i.halted
+}
+
+func (i *Interpreter) ResetLimits() {
+	i.steps = 0
+	i.depth = 0
+	i.halted = nil
+}
+
+func (i *Interpreter) step(n ast.Node) bool {
+	if i.halted != nil || i.group.stopped || (i.generator != nil && i.generator.stopped) {
+		return false
+	}
+	i.steps++
+	if i.limits.MaxSteps > 0 && i.steps > i.limits.MaxSteps {
+		i.halt(n, ErrStepLimit)
+		return false
+	}
+	if i.steps%cancelCheckInterval == 0 {
+		if err := i.ctx.Err(); err != nil {
+			i.halt(n, err)
+			return false
+		}
+		if i.tasks > 0 {
+			i.pause()
+		}
+	}
+	return true
+}
+
+func (i *Interpreter) enterCall(n ast.Node) bool {
+	i.depth++
+	if i.limits.MaxCallDepth > 0 && i.depth > i.limits.MaxCallDepth {
+		i.halt(n, ErrCallDepth)
+		return false
+	}
+	return true
+}
+
+func (i *Interpreter) exitCall() {
+	i.depth--
+}
+
+func (i *Interpreter) checkCollectionSize(n ast.Node, size int64) bool {
+	if i.limits.MaxCollectionSize > 0 && size > int64(i.limits.MaxCollectionSize) {
+		i.halt(n, ErrCollectionSize)
+		return false
+	}
+	return true
+}
+
+func (i *Interpreter) arrayOf(n ast.Node) runtime.TRuntimeFn {
+	return func(args ...runtime.Data) (runtime.Data, error) {
+		switch data := args[0].(type) {
+		case *runtime.TRange:
+			if !i.checkCollectionSize(n, data.Len()) {
+				return nil, runtime.ErrReported
+			}
+		case *runtime.TSequence:
+			iterator := data.Iterate()
+			defer iterator.Stop()
+			elements := []runtime.Data{}
+			for {
+				value, ok := iterator.Next()
+				if !ok {
+					break
+				}
+				elements = append(elements, value)
+				if !i.checkCollectionSize(n, int64(len(elements))) {
+					return nil, runtime.ErrReported
+				}
+			}
+			if err := iterator.Err(); err != nil {
+				return nil, err
+			}
+			return runtime.NewArray(elements), nil
+		}
+		return runtime.FnRuntime[runtime.TTArray](args...)
+	}
+}
+
+func (i *Interpreter) checkDataSize(n ast.Node, data runtime.Data) bool {
+	switch data := data.(type) {
+	case *runtime.TArray:
+		return i.checkCollectionSize(n, int64(data.Len()))
+	case *runtime.TDictionary:
+		return i.checkCollectionSize(n, int64(data.Len()))
+	case *runtime.TString:
+		return i.checkCollectionSize(n, int64(len(data.Value)))
+	default:
+		return true
+	}
+}
+
+func (i *Interpreter) halt(n ast.Node, err error) {
+	if i.halted != nil {
+		return
+	}
+	i.halted = err
+	i.diagnostics.Error(rerror.Limit, n.TokenPosition(), len(n.TokenLiteral()), err.Error())
+}
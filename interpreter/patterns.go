@@ -0,0 +1,343 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package interpreter implements functions to match patterns.
+package interpreter
+
+import (
+	"github.com/luiscm/oro/ast"
+	"github.com/luiscm/oro/rerror"
+	"github.com/luiscm/oro/runtime"
+	"github.com/luiscm/oro/token"
+)
+
+func (i *Interpreter) matchPattern(element ast.Expression, control runtime.Data, sc, scope *runtime.Scope) (matched, ok bool, err error) {
+	switch pattern := element.(type) {
+	case *ast.Array:
+		matched, err := i.matchArray(pattern, control, sc, scope)
+		return matched, true, err
+	case *ast.Dictionary:
+		matched, err := i.matchDictionary(pattern, control, sc, scope)
+		return matched, true, err
+	case *ast.TypePattern:
+		matched, err := i.matchType(pattern, control, scope)
+		return matched, true, err
+	case *ast.RestPattern:
+		return false, true, rerror.ErrorFmt("Rest pattern '%s' must be the last element of an array pattern", pattern.Check())
+	case *ast.InfixExpression:
+		if (pattern.Operator == token.Range || pattern.Operator == token.RangeExclusive) && control.Type() != runtime.TTArray {
+			matched, err := i.matchRange(pattern, control, sc)
+			return matched, true, err
+		}
+	}
+	if pattern, definition, ok := i.structPattern(element, sc); ok {
+		matched, err := i.matchStruct(pattern, definition, control, sc, scope)
+		return matched, true, err
+	}
+	if arguments, variant, ok := i.variantPattern(element, sc); ok {
+		matched, err := i.matchVariant(arguments, variant, control, sc, scope)
+		return matched, true, err
+	}
+	return false, false, nil
+}
+
+func (i *Interpreter) structPattern(element ast.Expression, sc *runtime.Scope) (*ast.FunctionCall, *runtime.TStructType, bool) {
+	call, ok := element.(*ast.FunctionCall)
+	if !ok {
+		return nil, nil, false
+	}
+	name, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, nil, false
+	}
+	data, ok := read(name, sc, name.Depth)
+	if !ok {
+		return nil, nil, false
+	}
+	definition, ok := data.(*runtime.TStructType)
+	return call, definition, ok
+}
+
+func (i *Interpreter) variantPattern(element ast.Expression, sc *runtime.Scope) ([]ast.Expression, *runtime.TVariantType, bool) {
+	var arguments []ast.Expression
+	access, ok := element.(*ast.ModuleAccess)
+	if call, isCall := element.(*ast.FunctionCall); isCall {
+		access, ok = call.Function.(*ast.ModuleAccess)
+		arguments = call.Arguments.Elements
+		if arguments == nil {
+			arguments = []ast.Expression{}
+		}
+	}
+	if !ok {
+		return nil, nil, false
+	}
+	if _, isModule := i.modules[access.Object.Value]; isModule {
+		return nil, nil, false
+	}
+	data, ok := read(access.Object, sc, access.Object.Depth)
+	if !ok {
+		return nil, nil, false
+	}
+	definition, ok := data.(*runtime.TEnumType)
+	if !ok {
+		return nil, nil, false
+	}
+	variant := definition.Variant(access.Parameter.Value)
+	return arguments, variant, variant != nil
+}
+
+func (i *Interpreter) matchStruct(pattern *ast.FunctionCall, definition *runtime.TStructType, control runtime.Data, sc, scope *runtime.Scope) (bool, error) {
+	if len(pattern.Arguments.Elements) != len(definition.Fields) {
+		return false, rerror.ErrorFmt("Pattern for struct '%s' expects %d fields but got %d", definition.Name, len(definition.Fields), len(pattern.Arguments.Elements))
+	}
+	value, ok := control.(*runtime.TStruct)
+	if !ok || value.Definition != definition {
+		return false, nil
+	}
+	return i.matchElements(pattern.Arguments.Elements, value.Values, sc, scope)
+}
+
+func (i *Interpreter) matchVariant(arguments []ast.Expression, variant *runtime.TVariantType, control runtime.Data, sc, scope *runtime.Scope) (bool, error) {
+	if arguments != nil && len(arguments) != len(variant.Fields) {
+		return false, rerror.ErrorFmt("Pattern for variant '%s' expects %d fields but got %d", variant.Enum.Name+token.Dot+variant.Name, len(variant.Fields), len(arguments))
+	}
+	value, ok := control.(*runtime.TVariant)
+	if !ok || value.Variant != variant {
+		return false, nil
+	}
+	return i.matchElements(arguments, value.Values, sc, scope)
+}
+
+func (i *Interpreter) matchArray(pattern *ast.Array, control runtime.Data, sc, scope *runtime.Scope) (bool, error) {
+	value, ok := control.(*runtime.TArray)
+	if !ok {
+		return false, nil
+	}
+	elements, rest := splitRest(pattern)
+	values := value.Elements()
+	if rest == nil {
+		if len(values) != len(elements) {
+			return false, nil
+		}
+		return i.matchElements(elements, values, sc, scope)
+	}
+	if len(values) < len(elements) {
+		return false, nil
+	}
+	matched, err := i.matchElements(elements, values, sc, scope)
+	if err != nil || !matched {
+		return false, err
+	}
+	if name, ok := rest.Name.(*ast.Identifier); ok {
+		bind(name, scope, runtime.NewArray(values[len(elements):]), false)
+	}
+	return true, nil
+}
+
+func (i *Interpreter) matchDictionary(pattern *ast.Dictionary, control runtime.Data, sc, scope *runtime.Scope) (bool, error) {
+	value, ok := control.(*runtime.TDictionary)
+	if !ok {
+		return false, nil
+	}
+	for _, k := range pattern.Keys {
+		v := pattern.Pairs[k]
+		key := i.Interpreter(k, sc)
+		if key == nil {
+			return false, rerror.ErrorFmt("Match when expression couldn't be interpreted")
+		}
+		found, ok := value.Get(key)
+		if !ok {
+			return false, nil
+		}
+		matched, err := i.matchElements([]ast.Expression{v}, []runtime.Data{found}, sc, scope)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (i *Interpreter) matchType(pattern *ast.TypePattern, control runtime.Data, scope *runtime.Scope) (bool, error) {
+	if !i.checkSupportedType(pattern.Type.Value) {
+		return false, rerror.ErrorFmt("Unknown type '%s' in type pattern", pattern.Type.Value)
+	}
+	if control.Type() != pattern.Type.Value {
+		return false, nil
+	}
+	if name, ok := pattern.Name.(*ast.Identifier); ok {
+		bind(name, scope, control, false)
+	}
+	return true, nil
+}
+
+func (i *Interpreter) matchRange(pattern *ast.InfixExpression, control runtime.Data, sc *runtime.Scope) (bool, error) {
+	left := i.Interpreter(pattern.Left, sc)
+	right := i.Interpreter(pattern.Right, sc)
+	if left == nil || right == nil {
+		return false, rerror.ErrorFmt("Match when expression couldn't be interpreted")
+	}
+	if value, ok := control.(*runtime.TString); ok {
+		low, lowOk := left.(*runtime.TString)
+		high, highOk := right.(*runtime.TString)
+		return lowOk && highOk && low.Value <= value.Value && value.Value <= high.Value, nil
+	}
+	number, ok := i.rangeBound(control)
+	low, lowOk := i.rangeBound(left)
+	high, highOk := i.rangeBound(right)
+	if pattern.Operator == token.RangeExclusive {
+		return ok && lowOk && highOk && low <= number && number < high, nil
+	}
+	return ok && lowOk && highOk && low <= number && number <= high, nil
+}
+
+func splitRest(pattern *ast.Array) ([]ast.Expression, *ast.RestPattern) {
+	elements := pattern.List.Elements
+	if len(elements) == 0 {
+		return elements, nil
+	}
+	if rest, ok := elements[len(elements)-1].(*ast.RestPattern); ok {
+		return elements[:len(elements)-1], rest
+	}
+	return elements, nil
+}
+
+func (i *Interpreter) rangeBound(data runtime.Data) (float64, bool) {
+	switch value := data.(type) {
+	case *runtime.TInteger:
+		return float64(value.Value), true
+	case *runtime.TFloat:
+		return value.Value, true
+	}
+	return 0, false
+}
+
+func (i *Interpreter) matchElements(elements []ast.Expression, values []runtime.Data, sc, scope *runtime.Scope) (bool, error) {
+	for idx, element := range elements {
+		value := values[idx]
+		switch element := element.(type) {
+		case *ast.PlaceHolder:
+			continue
+		case *ast.Identifier:
+			bind(element, scope, value, false)
+			continue
+		}
+		if matched, ok, err := i.matchPattern(element, value, sc, scope); ok {
+			if err != nil || !matched {
+				return false, err
+			}
+			continue
+		}
+		expected := i.Interpreter(element, sc)
+		if expected == nil {
+			return false, rerror.ErrorFmt("Match when expression couldn't be interpreted")
+		}
+		if !runtime.Equal(expected, value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (i *Interpreter) destructure(pattern ast.Expression, value runtime.Data, sc *runtime.Scope) (*runtime.Scope, []*ast.Identifier, error) {
+	names := i.patternNames(pattern, sc, nil)
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name.Value] {
+			return nil, nil, rerror.ErrorFmt("Identifier '%s' bound twice in pattern", name.Value)
+		}
+		seen[name.Value] = true
+	}
+	bound := runtime.NewScopeFrom(sc)
+	matched, _, err := i.matchPattern(pattern, value, sc, bound)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !matched {
+		return nil, nil, i.mismatch(pattern, value, sc)
+	}
+	return bound, names, nil
+}
+
+func (i *Interpreter) mismatch(pattern ast.Expression, value runtime.Data, sc *runtime.Scope) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier, *ast.PlaceHolder:
+		return nil
+	case *ast.Array:
+		array, ok := value.(*runtime.TArray)
+		if !ok {
+			return rerror.ErrorFmt("Can't destructure type '%s' as an array", value.Type())
+		}
+		elements, rest := splitRest(pattern)
+		if rest == nil && array.Len() != len(elements) {
+			return rerror.ErrorFmt("Array pattern expects %d elements but got %d", len(elements), array.Len())
+		}
+		if array.Len() < len(elements) {
+			return rerror.ErrorFmt("Array pattern expects at least %d elements but got %d", len(elements), array.Len())
+		}
+		for idx, element := range elements {
+			if err := i.mismatch(element, array.At(idx), sc); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ast.Dictionary:
+		dictionary, ok := value.(*runtime.TDictionary)
+		if !ok {
+			return rerror.ErrorFmt("Can't destructure type '%s' as a dictionary", value.Type())
+		}
+		for _, k := range pattern.Keys {
+			v := pattern.Pairs[k]
+			key := i.Interpreter(k, sc)
+			if key == nil {
+				return rerror.ErrorFmt("Match when expression couldn't be interpreted")
+			}
+			found, ok := dictionary.Get(key)
+			if !ok {
+				return rerror.ErrorFmt("Key '%s' not found in dictionary to destructure", key.Check())
+			}
+			if err := i.mismatch(v, found, sc); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ast.TypePattern:
+		if value.Type() != pattern.Type.Value {
+			return rerror.ErrorFmt("Type pattern '%s' expects type '%s' but got '%s'", pattern.Check(), pattern.Type.Value, value.Type())
+		}
+		return nil
+	}
+	if matched, err := i.matchElements([]ast.Expression{pattern}, []runtime.Data{value}, sc, runtime.NewScopeFrom(sc)); err != nil || matched {
+		return err
+	}
+	return rerror.ErrorFmt("Value '%s' doesn't match '%s' in pattern", value.Check(), pattern.Check())
+}
+
+func (i *Interpreter) patternNames(pattern ast.Expression, sc *runtime.Scope, names []*ast.Identifier) []*ast.Identifier {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		return append(names, pattern)
+	case *ast.TypePattern:
+		return i.patternNames(pattern.Name, sc, names)
+	case *ast.RestPattern:
+		if pattern.Name != nil {
+			return i.patternNames(pattern.Name, sc, names)
+		}
+	case *ast.Array:
+		for _, element := range pattern.List.Elements {
+			names = i.patternNames(element, sc, names)
+		}
+	case *ast.Dictionary:
+		for _, key := range pattern.Keys {
+			names = i.patternNames(pattern.Pairs[key], sc, names)
+		}
+	case *ast.FunctionCall:
+		_, _, isStruct := i.structPattern(pattern, sc)
+		_, _, isVariant := i.variantPattern(pattern, sc)
+		if isStruct || isVariant {
+			for _, argument := range pattern.Arguments.Elements {
+				names = i.patternNames(argument, sc, names)
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,157 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package interpreter implements functions to struct types.
+package interpreter
+
+import (
+	"fmt"
+	"github.com/luiscm/oro/ast"
+	"github.com/luiscm/oro/rerror"
+	"github.com/luiscm/oro/runtime"
+)
+
+func (i *Interpreter) Struct(ns *ast.Struct, sc *runtime.Scope) runtime.Data {
+	name := ns.Name.Value
+	if !i.declareType(ns, "Struct", ns.Name, sc) {
+		return nil
+	}
+	definition := &runtime.TStructType{Name: name}
+	for _, field := range ns.Fields {
+		definition.Fields = append(definition.Fields, field.Name.Value)
+		if field.Type != nil {
+			definition.Types = append(definition.Types, field.Type.Value)
+		} else {
+			definition.Types = append(definition.Types, "")
+		}
+	}
+	i.bindType(ns, ns.Name, definition, sc)
+	return definition
+}
+
+func (i *Interpreter) declareType(n ast.Node, kind string, ni *ast.Identifier, sc *runtime.Scope) bool {
+	name := ni.Value
+	if declared, ok := i.types[name]; ok {
+		position := declared.TokenPosition()
+		i.diagnostics.Add(rerror.Diagnostic{
+			Kind:    rerror.Runtime,
+			File:    n.TokenPosition().File,
+			Row:     n.TokenPosition().Row,
+			Col:     n.TokenPosition().Col,
+			Span:    len(n.TokenLiteral()),
+			Message: fmt.Sprintf("%s '%s' redeclared", kind, name),
+			Related: &rerror.Note{File: position.File, Row: position.Row, Col: position.Col, Message: "First declared here"},
+		})
+		return false
+	}
+	if i.checkSupportedType(name) {
+		i.interpreterError(n, fmt.Sprintf("%s '%s' can't take the name of a builtin type", kind, name))
+		return false
+	}
+	// The resolver checks the names it placed.
+	if !ni.Resolved {
+		if _, ok := sc.Read(name); ok {
+			i.interpreterError(n, fmt.Sprintf("Identifier '%s' already declared", name))
+			return false
+		}
+	}
+	return true
+}
+
+func (i *Interpreter) bindType(n ast.Node, name *ast.Identifier, definition runtime.Data, sc *runtime.Scope) {
+	i.types[name.Value] = n
+	bind(name, sc, definition, true)
+}
+
+func (i *Interpreter) Construct(n ast.Node, definition *runtime.TStructType, arguments []runtime.Data) runtime.Data {
+	if len(arguments) != len(definition.Fields) {
+		i.interpreterError(n, fmt.Sprintf("Struct '%s' expects %d fields but got %d", definition.Name, len(definition.Fields), len(arguments)))
+		return nil
+	}
+	for idx, value := range arguments {
+		if err := i.checkFieldType("struct '"+definition.Name+"'", definition.Fields[idx], definition.Types[idx], value); err != nil {
+			i.fail(n, err)
+			return nil
+		}
+	}
+	values := make([]runtime.Data, len(arguments))
+	copy(values, arguments)
+	return &runtime.TStruct{Definition: definition, Values: values}
+}
+
+func (i *Interpreter) FieldAccess(nf *ast.FieldAccess, sc *runtime.Scope) runtime.Data {
+	object := i.Interpreter(nf.Object, sc)
+	if object == nil {
+		return nil
+	}
+	return i.member(nf, object, nf.Field.Value)
+}
+
+func (i *Interpreter) member(n ast.Node, data runtime.Data, name string) runtime.Data {
+	switch value := data.(type) {
+	case *runtime.TStruct:
+		idx := value.Definition.Field(name)
+		if idx < 0 {
+			i.interpreterErrorHint(n, fmt.Sprintf("Field '%s' not found in struct '%s'", name, value.Definition.Name),
+				rerror.Suggest(name, value.Definition.Fields))
+			return nil
+		}
+		return value.Values[idx]
+	case *runtime.TVariant:
+		idx := value.Variant.Field(name)
+		if idx < 0 {
+			i.interpreterErrorHint(n, fmt.Sprintf("Field '%s' not found in variant '%s'", name, value.Variant.Check()),
+				rerror.Suggest(name, value.Variant.Fields))
+			return nil
+		}
+		return value.Values[idx]
+	case *runtime.TEnumType:
+		return i.variant(n, value, name)
+	case *runtime.TChannel:
+		return i.channelMethod(n, value, name)
+	}
+	i.interpreterError(n, fmt.Sprintf("Type '%s' has no field '%s'", data.Type(), name))
+	return nil
+}
+
+func (i *Interpreter) AssignField(target ast.Expression, root, value runtime.Data, sc *runtime.Scope) (runtime.Data, error) {
+	object, name := root, ""
+	switch target := target.(type) {
+	case *ast.ModuleAccess:
+		name = target.Parameter.Value
+	case *ast.FieldAccess:
+		if object = i.Interpreter(target.Object, sc); object == nil {
+			return nil, nil
+		}
+		name = target.Field.Value
+	}
+	if _, ok := object.(*runtime.TVariant); ok {
+		return nil, rerror.ErrorFmt("Fields of enum variants can't be assigned")
+	}
+	data, ok := object.(*runtime.TStruct)
+	if !ok {
+		return nil, rerror.ErrorFmt("Type '%s' has no field '%s'", object.Type(), name)
+	}
+	idx := data.Definition.Field(name)
+	if idx < 0 {
+		return nil, rerror.ErrorFmt("Field '%s' not found in struct '%s'", name, data.Definition.Name)
+	}
+	if err := i.checkFieldType("struct '"+data.Definition.Name+"'", name, data.Definition.Types[idx], value); err != nil {
+		return nil, err
+	}
+	data.Values[idx] = value
+	return root, nil
+}
+
+func (i *Interpreter) checkFieldType(owner, field, expected string, value runtime.Data) error {
+	if expected == "" {
+		return nil
+	}
+	if !i.checkSupportedType(expected) {
+		return rerror.ErrorFmt("Unknown type '%s' in field '%s' of %s", expected, field, owner)
+	}
+	if !i.typeMatches(value.Type(), expected) {
+		return &typeMismatch{fmt.Sprintf("Field '%s' of %s asks for type '%s' but got '%s'", field, owner, expected, value.Type())}
+	}
+	return nil
+}
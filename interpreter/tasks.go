@@ -0,0 +1,425 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package interpreter implements functions to tasks and channels.
+package interpreter
+
+import (
+	"context"
+	"fmt"
+	"github.com/luiscm/oro/ast"
+	"github.com/luiscm/oro/rerror"
+	"github.com/luiscm/oro/runtime"
+	goruntime "runtime"
+	"sync"
+)
+
+// The interpreter runs one task at a time: the running task holds lock and
+// hands it over when it blocks on a task or a channel, and every
+// cancelCheckInterval steps while other tasks are alive. Scopes, arrays,
+// dictionaries and channels are only touched by the task holding the lock,
+// so they need no lock of their own. The program holds the lock from New, so
+// spawned tasks only run while it's running. When a top-level Program or Call
+// ends, the tasks it spawned that are still alive are stopped.
+
+type taskGroup struct {
+	stopped bool
+	stop    chan struct{}
+	alive   sync.WaitGroup
+}
+
+func newTaskGroup() *taskGroup {
+	return &taskGroup{stop: make(chan struct{})}
+}
+
+func (i *Interpreter) enterRun() bool {
+	if i.running {
+		return false
+	}
+	i.running = true
+	return true
+}
+
+func (i *Interpreter) exitRun() {
+	i.stopTasks()
+	i.running = false
+}
+
+func (i *Interpreter) stopTasks() {
+	if i.tasks == 0 {
+		return
+	}
+	checkpoint, halted := i.diagnostics.Len(), i.halted
+	group := i.group
+	group.stopped = true
+	close(group.stop)
+	state := i.release()
+	group.alive.Wait()
+	i.acquire(state)
+	i.diagnostics.Truncate(checkpoint)
+	i.halted = halted
+	i.group = newTaskGroup()
+}
+
+type taskState struct {
+	frames    []frame
+	depth     int
+	generator *generator
+	raised    *runtime.TError
+	raisedAt  int
+}
+
+func (i *Interpreter) release() taskState {
+	state := taskState{frames: i.frames, depth: i.depth, generator: i.generator, raised: i.raised, raisedAt: i.raisedAt}
+	i.lock.Unlock()
+	return state
+}
+
+func (i *Interpreter) acquire(state taskState) {
+	i.lock.Lock()
+	i.frames, i.depth, i.generator = state.frames, state.depth, state.generator
+	i.raised, i.raisedAt = state.raised, state.raisedAt
+}
+
+func (i *Interpreter) pause() {
+	state := i.release()
+	goruntime.Gosched()
+	i.acquire(state)
+}
+
+func (i *Interpreter) Spawn(ns *ast.Spawn, sc *runtime.Scope) runtime.Data {
+	data := i.Interpreter(ns.Function, sc)
+	if data == nil {
+		return nil
+	}
+	function, ok := data.(*runtime.TFunction)
+	if !ok {
+		i.interpreterError(ns, fmt.Sprintf("SPAWN expects a function but got '%s'", data.Type()))
+		return nil
+	}
+	name := function.Name
+	if name == "" {
+		name = anonymousFrame
+	}
+	task := &runtime.TTask{Name: name}
+	state := taskState{frames: append([]frame{}, i.frames...), depth: i.depth}
+	group := i.group
+	group.alive.Add(1)
+	i.tasks++
+	go func() {
+		defer group.alive.Done()
+		i.acquire(state)
+		checkpoint := i.diagnostics.Len()
+		if !group.stopped {
+			task.Result = i.Call(ns, function, nil, sc)
+		}
+		if group.stopped {
+			task.Result, task.Err = nil, i.stoppedError(ns)
+		} else if task.Result == nil && i.halted == nil && i.diagnostics.Len() > checkpoint {
+			task.Err = i.raisedError(checkpoint)
+			i.diagnostics.Truncate(checkpoint)
+			i.raised = nil
+		}
+		i.finish(task)
+		i.release()
+	}()
+	return task
+}
+
+func (i *Interpreter) stoppedError(n ast.Node) *runtime.TError {
+	return &runtime.TError{
+		Kind:    "runtime",
+		Message: "Task stopped when its run ended",
+		Tag:     &runtime.TSymbol{Value: "stopped"},
+		Payload: runtime.Nil,
+		Stack:   i.trace(n),
+	}
+}
+
+func (i *Interpreter) Await(na *ast.Await, sc *runtime.Scope) runtime.Data {
+	data := i.Interpreter(na.Task, sc)
+	if data == nil {
+		return nil
+	}
+	task, ok := data.(*runtime.TTask)
+	if !ok {
+		i.interpreterError(na, fmt.Sprintf("AWAIT expects a Task but got '%s'", data.Type()))
+		return nil
+	}
+	if !task.Finished {
+		waiter := &runtime.Waiter{Wake: make(chan struct{})}
+		task.Waiters = append(task.Waiters, waiter)
+		if !i.block(na, waiter) {
+			return nil
+		}
+	}
+	if task.Err != nil {
+		i.raise(na, task.Err)
+		return nil
+	}
+	return task.Result
+}
+
+func (i *Interpreter) finish(task *runtime.TTask) {
+	task.Finished = true
+	for _, waiter := range task.Waiters {
+		i.wake(waiter, 0, runtime.Nil, true)
+	}
+	task.Waiters = nil
+	i.tasks--
+}
+
+// block lets the other tasks run until waiter is woken. It fails with a
+// deadlock when every other task is blocked too, and halts when the context
+// of the run is canceled first.
+func (i *Interpreter) block(n ast.Node, waiter *runtime.Waiter) bool {
+	if i.blocked == i.tasks {
+		waiter.Woken = true
+		i.interpreterError(n, "Deadlock: every task is blocked")
+		return false
+	}
+	i.blocked++
+	ctx, stop := i.ctx, i.group.stop
+	state := i.release()
+	select {
+	case <-waiter.Wake:
+	case <-ctx.Done():
+	case <-stop:
+	}
+	i.acquire(state)
+	if !waiter.Woken {
+		waiter.Woken = true
+		i.blocked--
+		if !i.group.stopped {
+			i.halt(n, ctx.Err())
+		}
+		return false
+	}
+	return true
+}
+
+func (i *Interpreter) wake(waiter *runtime.Waiter, index int, value runtime.Data, ok bool) bool {
+	if waiter.Woken {
+		return false
+	}
+	waiter.Woken, waiter.Case, waiter.Value, waiter.Ok = true, index, value, ok
+	i.blocked--
+	close(waiter.Wake)
+	return true
+}
+
+func (i *Interpreter) channelMethod(n ast.Node, channel *runtime.TChannel, name string) runtime.Data {
+	var fn runtime.TNativeFn
+	switch name {
+	case "send":
+		fn = func(_ context.Context, _ *runtime.Scope, args ...runtime.Data) (runtime.Data, error) {
+			if len(args) != 1 {
+				return nil, rerror.ErrorFmt("Channel.send() expects exactly 1 argument")
+			}
+			_, _, _, err := i.perform(n, []channelOp{{channel: channel, send: true, value: args[0]}}, true)
+			if err != nil {
+				return nil, err
+			}
+			return runtime.Nil, nil
+		}
+	case "receive":
+		fn = func(_ context.Context, _ *runtime.Scope, args ...runtime.Data) (runtime.Data, error) {
+			if len(args) != 0 {
+				return nil, rerror.ErrorFmt("Channel.receive() expects no arguments")
+			}
+			_, value, _, err := i.perform(n, []channelOp{{channel: channel}}, true)
+			if err != nil {
+				return nil, err
+			}
+			return value, nil
+		}
+	case "close":
+		fn = func(_ context.Context, _ *runtime.Scope, args ...runtime.Data) (runtime.Data, error) {
+			if len(args) != 0 {
+				return nil, rerror.ErrorFmt("Channel.close() expects no arguments")
+			}
+			if channel.Closed {
+				return nil, rerror.ErrorFmt("Channel already closed")
+			}
+			i.closeChannel(channel)
+			return runtime.Nil, nil
+		}
+	default:
+		i.interpreterErrorHint(n, fmt.Sprintf("Channel has no method '%s'", name),
+			rerror.Suggest(name, []string{"send", "receive", "close"}))
+		return nil
+	}
+	return &runtime.TNativeFunction{Name: runtime.TTChannel + "." + name, Fn: fn}
+}
+
+type channelOp struct {
+	channel *runtime.TChannel
+	send    bool
+	value   runtime.Data
+}
+
+func (i *Interpreter) perform(n ast.Node, ops []channelOp, wait bool) (int, runtime.Data, bool, error) {
+	for idx, op := range ops {
+		if op.send {
+			if op.channel.Closed {
+				return idx, nil, false, rerror.ErrorFmt("Can't send on a closed channel")
+			}
+			if i.trySend(op.channel, op.value) {
+				return idx, runtime.Nil, true, nil
+			}
+		} else if value, ok, ready := i.tryReceive(op.channel); ready {
+			return idx, value, ok, nil
+		}
+	}
+	if !wait {
+		return -1, nil, false, nil
+	}
+	waiter := &runtime.Waiter{Wake: make(chan struct{})}
+	for idx, op := range ops {
+		wait := runtime.ChannelWait{Waiter: waiter, Case: idx, Value: op.value}
+		if op.send {
+			op.channel.Senders = append(op.channel.Senders, wait)
+		} else {
+			op.channel.Receivers = append(op.channel.Receivers, wait)
+		}
+	}
+	blocked := i.block(n, waiter)
+	for _, op := range ops {
+		op.channel.Senders = unregister(op.channel.Senders, waiter)
+		op.channel.Receivers = unregister(op.channel.Receivers, waiter)
+	}
+	if !blocked {
+		return -1, nil, false, runtime.ErrReported
+	}
+	if ops[waiter.Case].send && !waiter.Ok {
+		return waiter.Case, nil, false, rerror.ErrorFmt("Can't send on a closed channel")
+	}
+	return waiter.Case, waiter.Value, waiter.Ok, nil
+}
+
+func (i *Interpreter) trySend(channel *runtime.TChannel, value runtime.Data) bool {
+	for len(channel.Receivers) > 0 {
+		wait := channel.Receivers[0]
+		channel.Receivers = channel.Receivers[1:]
+		if i.wake(wait.Waiter, wait.Case, value, true) {
+			return true
+		}
+	}
+	if len(channel.Buffer) < channel.Capacity {
+		channel.Buffer = append(channel.Buffer, value)
+		return true
+	}
+	return false
+}
+
+func (i *Interpreter) tryReceive(channel *runtime.TChannel) (value runtime.Data, ok bool, ready bool) {
+	if len(channel.Buffer) > 0 {
+		value = channel.Buffer[0]
+		channel.Buffer = channel.Buffer[1:]
+		if sender, found := i.nextSender(channel); found {
+			channel.Buffer = append(channel.Buffer, sender.Value)
+		}
+		return value, true, true
+	}
+	if sender, found := i.nextSender(channel); found {
+		return sender.Value, true, true
+	}
+	if channel.Closed {
+		return runtime.Nil, false, true
+	}
+	return nil, false, false
+}
+
+func (i *Interpreter) nextSender(channel *runtime.TChannel) (runtime.ChannelWait, bool) {
+	for len(channel.Senders) > 0 {
+		wait := channel.Senders[0]
+		channel.Senders = channel.Senders[1:]
+		if i.wake(wait.Waiter, wait.Case, runtime.Nil, true) {
+			return wait, true
+		}
+	}
+	return runtime.ChannelWait{}, false
+}
+
+func (i *Interpreter) closeChannel(channel *runtime.TChannel) {
+	channel.Closed = true
+	for _, wait := range channel.Receivers {
+		i.wake(wait.Waiter, wait.Case, runtime.Nil, false)
+	}
+	for _, wait := range channel.Senders {
+		i.wake(wait.Waiter, wait.Case, nil, false)
+	}
+	channel.Receivers, channel.Senders = nil, nil
+}
+
+func unregister(waits []runtime.ChannelWait, waiter *runtime.Waiter) []runtime.ChannelWait {
+	kept := waits[:0]
+	for _, wait := range waits {
+		if wait.Waiter != waiter {
+			kept = append(kept, wait)
+		}
+	}
+	return kept
+}
+
+type channelIterator struct {
+	interpreter *Interpreter
+	node        ast.Node
+	channel     *runtime.TChannel
+	err         error
+}
+
+func (c *channelIterator) Next() (runtime.Data, bool) {
+	_, value, ok, err := c.interpreter.perform(c.node, []channelOp{{channel: c.channel}}, true)
+	c.err = err
+	return value, ok
+}
+
+func (c *channelIterator) Stop() {
+}
+
+func (c *channelIterator) Err() error {
+	return c.err
+}
+
+func (i *Interpreter) ForChannel(nr *ast.Repeat, channel *runtime.TChannel, sc *runtime.Scope) runtime.Data {
+	return i.forIterator(nr, "a channel", &channelIterator{interpreter: i, node: nr, channel: channel}, sc)
+}
+
+func (i *Interpreter) Select(ns *ast.Select, sc *runtime.Scope) runtime.Data {
+	ops := make([]channelOp, len(ns.Cases))
+	for idx, c := range ns.Cases {
+		data := i.Interpreter(c.Channel, sc)
+		if data == nil {
+			return nil
+		}
+		channel, ok := data.(*runtime.TChannel)
+		if !ok {
+			i.interpreterError(c, fmt.Sprintf("SELECT WHEN expects a Channel but got '%s'", data.Type()))
+			return nil
+		}
+		ops[idx].channel = channel
+		if c.Value != nil {
+			if ops[idx].value = i.Interpreter(c.Value, sc); ops[idx].value == nil {
+				return nil
+			}
+			ops[idx].send = true
+		}
+	}
+	chosen, value, _, err := i.perform(ns, ops, ns.Else == nil)
+	if err != nil {
+		if err != runtime.ErrReported {
+			i.interpreterError(ns.Cases[chosen], err.Error())
+		}
+		return nil
+	}
+	if chosen < 0 {
+		return i.Interpreter(ns.Else, runtime.NewScopeFrom(sc))
+	}
+	selected := ns.Cases[chosen]
+	scope := runtime.NewScopeFrom(sc)
+	if selected.Name != nil {
+		bind(selected.Name, scope, value, false)
+	}
+	return i.Interpreter(selected.Body, scope)
+}
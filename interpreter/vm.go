@@ -0,0 +1,403 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package interpreter implements functions to run bytecode.
+package interpreter
+
+import (
+	"fmt"
+	"github.com/luiscm/oro/ast"
+	"github.com/luiscm/oro/rerror"
+	"github.com/luiscm/oro/runtime"
+	"strings"
+)
+
+type Engine int
+
+const (
+	EngineTree Engine = iota
+	EngineVM
+)
+
+var defaultEngine = EngineTree
+
+func ParseEngine(name string) (Engine, error) {
+	switch name {
+	case "tree":
+		return EngineTree, nil
+	case "vm":
+		return EngineVM, nil
+	default:
+		return EngineTree, rerror.ErrorFmt("Unknown engine '%s'", name)
+	}
+}
+
+func (i *Interpreter) SetEngine(engine Engine) {
+	i.engine = engine
+}
+
+type cursor struct {
+	count    int64
+	at       func(int64) runtime.Data
+	keys     []runtime.Data
+	index    int64
+	iterator runtime.Iterator
+}
+
+func (c *cursor) next() (runtime.Data, bool) {
+	c.index++
+	if c.iterator != nil {
+		return c.iterator.Next()
+	}
+	if c.index > c.count {
+		return nil, false
+	}
+	return c.at(c.index - 1), true
+}
+
+func (c *cursor) key() runtime.Data {
+	if c.keys != nil {
+		return c.keys[c.index-1]
+	}
+	return &runtime.TInteger{Value: c.index - 1}
+}
+
+func (c *cursor) stop() {
+	if c.iterator != nil {
+		c.iterator.Stop()
+	}
+}
+
+func (c *cursor) err() error {
+	if c.iterator != nil {
+		return c.iterator.Err()
+	}
+	return nil
+}
+
+func (i *Interpreter) cursor(n ast.Node, data runtime.Data) *cursor {
+	switch enum := data.(type) {
+	case *runtime.TString:
+		return i.arrayCursor(i.stringToArray(enum))
+	case *runtime.TSymbol:
+		return i.arrayCursor(i.stringToArray(&runtime.TString{Value: enum.Value}))
+	case *runtime.TArray:
+		return i.arrayCursor(enum)
+	case *runtime.TDictionary:
+		var keys, values []runtime.Data
+		for idx := 0; idx < enum.Len(); idx++ {
+			key, value := enum.At(idx)
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		return &cursor{count: int64(len(values)), keys: keys, at: func(index int64) runtime.Data {
+			return values[index]
+		}}
+	case *runtime.TRange:
+		return &cursor{count: enum.Len(), at: enum.At}
+	case *runtime.TSequence:
+		return &cursor{iterator: enum.Iterate()}
+	case *runtime.TChannel:
+		return &cursor{iterator: &channelIterator{interpreter: i, node: n, channel: enum}}
+	default:
+		i.interpreterError(n, fmt.Sprintf("Type %s is not an enumerable", data.Type()))
+		return nil
+	}
+}
+
+func (i *Interpreter) arrayCursor(array *runtime.TArray) *cursor {
+	return &cursor{count: int64(array.Len()), at: func(index int64) runtime.Data {
+		return array.At(int(index))
+	}}
+}
+
+func operand(code []byte, ip int) int {
+	return int(code[ip])<<8 | int(code[ip+1])
+}
+
+func (i *Interpreter) execute(code *chunk, function *runtime.TFunction, arguments []runtime.Data) runtime.Data {
+	if !i.step(function.Body) {
+		return nil
+	}
+	locals := make([]runtime.Data, code.locals)
+	copy(locals, arguments)
+	return i.run(code, function.Scope, locals, 0)
+}
+
+func (i *Interpreter) runProgram(code *chunk, np *ast.Program, sc *runtime.Scope) runtime.Data {
+	locals := make([]runtime.Data, code.locals)
+	var result runtime.Data
+	for idx, address := range code.statements {
+		statement := np.Statements[idx]
+		result = nil
+		if !i.step(statement) {
+			continue
+		}
+		if value := i.run(code, sc, locals, address); value != nil && i.checkDataSize(statement, value) {
+			result = value
+		}
+	}
+	return result
+}
+
+func (i *Interpreter) run(code *chunk, sc *runtime.Scope, locals []runtime.Data, ip int) runtime.Data {
+	stack := make([]runtime.Data, 0, 16)
+	var cursors []*cursor
+	defer func() {
+		for _, c := range cursors {
+			c.stop()
+		}
+	}()
+	instructions := code.code
+	for {
+		op := opcode(instructions[ip])
+		ip++
+		switch op {
+		case opConstant:
+			stack = append(stack, code.constants[operand(instructions, ip)])
+			ip += 2
+		case opNil:
+			stack = append(stack, runtime.Nil)
+		case opPop:
+			stack = stack[:len(stack)-1]
+		case opGetLocal:
+			stack = append(stack, locals[operand(instructions, ip)])
+			ip += 2
+		case opDefine:
+			value := stack[len(stack)-1]
+			i.nameFunction(value, code.constants[operand(instructions, ip+2)].(*runtime.TString).Value)
+			locals[operand(instructions, ip)] = value
+			ip += 4
+		case opAssignLocal:
+			slot, value := operand(instructions, ip), stack[len(stack)-1]
+			if value.Type() != locals[slot].Type() {
+				i.interpreterError(code.nodes[operand(instructions, ip+2)], fmt.Sprintf("Variable assignment should keep the original data type '%s'", locals[slot].Type()))
+				return nil
+			}
+			locals[slot] = value
+			ip += 4
+		case opGetFree:
+			// The resolver counted the scopes of the blocks the VM keeps in
+			// locals.
+			ni := code.nodes[operand(instructions, ip)].(*ast.Identifier)
+			value := i.identifier(ni, sc, ni.Depth-operand(instructions, ip+2))
+			if value == nil {
+				return nil
+			}
+			stack = append(stack, value)
+			ip += 4
+		case opAssignable:
+			na := code.nodes[operand(instructions, ip)].(*ast.Assign)
+			ni := na.Name.(*ast.Identifier)
+			depth := ni.Depth - operand(instructions, ip+2)
+			if _, ok := read(ni, sc, depth); !ok {
+				i.interpreterError(na, fmt.Sprintf("Identifier '%s' not found in current memory", ni.Value))
+				return nil
+			}
+			if immutable(ni, sc, depth) {
+				i.interpreterError(na, fmt.Sprintf("Identifier '%s' is immutable", ni.Value))
+				return nil
+			}
+			ip += 4
+		case opAssignFree:
+			na := code.nodes[operand(instructions, ip)].(*ast.Assign)
+			ni, value := na.Name.(*ast.Identifier), stack[len(stack)-1]
+			depth := ni.Depth - operand(instructions, ip+2)
+			original, _ := read(ni, sc, depth)
+			if value.Type() != original.Type() {
+				i.interpreterError(na, fmt.Sprintf("Variable assignment should keep the original data type '%s'", original.Type()))
+				return nil
+			}
+			update(ni, sc, depth, value)
+			ip += 4
+		case opAdd, opSubtract, opMultiply, opLess, opLessEqual, opGreater, opGreaterEqual, opEqual, opNotEqual, opInfix:
+			left, right := stack[len(stack)-2], stack[len(stack)-1]
+			stack = stack[:len(stack)-2]
+			var result runtime.Data
+			l, isInteger := left.(*runtime.TInteger)
+			r, ok := right.(*runtime.TInteger)
+			if isInteger && ok && op != opInfix {
+				result = i.integerOp(op, l.Value, r.Value)
+			} else {
+				n := code.nodes[operand(instructions, ip)]
+				if result = i.infix(n.(*ast.InfixExpression), left, right); result == nil || !i.checkDataSize(n, result) {
+					return nil
+				}
+			}
+			stack = append(stack, result)
+			ip += 2
+		case opPrefix:
+			result := i.prefix(code.nodes[operand(instructions, ip)].(*ast.PrefixExpression), stack[len(stack)-1])
+			if result == nil {
+				return nil
+			}
+			stack[len(stack)-1] = result
+			ip += 2
+		case opAnd:
+			if !i.isType(stack[len(stack)-1]) {
+				stack[len(stack)-1] = runtime.No
+				ip = operand(instructions, ip)
+			} else {
+				ip += 2
+			}
+		case opOr:
+			if i.isType(stack[len(stack)-1]) {
+				stack[len(stack)-1] = runtime.Yes
+				ip = operand(instructions, ip)
+			} else {
+				ip += 2
+			}
+		case opJump:
+			ip = operand(instructions, ip)
+		case opJumpIfFalse:
+			condition := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if !i.isType(condition) {
+				ip = operand(instructions, ip)
+			} else {
+				ip += 2
+			}
+		case opLoop:
+			if !i.step(code.nodes[operand(instructions, ip+2)]) {
+				return nil
+			}
+			ip = operand(instructions, ip)
+		case opArray:
+			count, n := operand(instructions, ip), code.nodes[operand(instructions, ip+2)]
+			array := runtime.NewArray(stack[len(stack)-count:])
+			stack = stack[:len(stack)-count]
+			if !i.checkDataSize(n, array) {
+				return nil
+			}
+			stack = append(stack, array)
+			ip += 4
+		case opInterpolate:
+			count, n := operand(instructions, ip), code.nodes[operand(instructions, ip+2)]
+			var out strings.Builder
+			for _, value := range stack[len(stack)-count:] {
+				out.WriteString(value.Check())
+			}
+			stack = stack[:len(stack)-count]
+			str := &runtime.TString{Value: out.String()}
+			if !i.checkDataSize(n, str) {
+				return nil
+			}
+			stack = append(stack, str)
+			ip += 4
+		case opSubscript:
+			left, index := stack[len(stack)-2], stack[len(stack)-1]
+			stack = stack[:len(stack)-2]
+			result := i.subscript(code.nodes[operand(instructions, ip)].(*ast.Subscript), left, index)
+			if result == nil {
+				return nil
+			}
+			stack = append(stack, result)
+			ip += 2
+		case opCall, opRuntimeCall:
+			count, nf := operand(instructions, ip), code.nodes[operand(instructions, ip+2)].(*ast.FunctionCall)
+			var arguments []runtime.Data
+			if count > 0 {
+				arguments = make([]runtime.Data, count)
+				copy(arguments, stack[len(stack)-count:])
+				stack = stack[:len(stack)-count]
+			}
+			var result runtime.Data
+			if op == opRuntimeCall {
+				result = i.runtimeCall(nf, arguments, sc)
+			} else {
+				fn := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if i.callable(nf, fn) {
+					result = i.callData(nf, fn, arguments, sc)
+				}
+			}
+			if result == nil || !i.checkDataSize(nf, result) {
+				return nil
+			}
+			stack = append(stack, result)
+			ip += 4
+		case opIterate:
+			enumerable := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			c := i.cursor(code.nodes[operand(instructions, ip)], enumerable)
+			if c == nil {
+				return nil
+			}
+			cursors = append(cursors, c)
+			ip += 2
+		case opNext:
+			c := cursors[len(cursors)-1]
+			value, ok := c.next()
+			if !ok {
+				ip = operand(instructions, ip)
+				continue
+			}
+			locals[operand(instructions, ip+2)] = value
+			if index := operand(instructions, ip+4); index > 0 {
+				locals[index-1] = c.key()
+			}
+			ip += 6
+		case opEndIterate:
+			c := cursors[len(cursors)-1]
+			cursors = cursors[:len(cursors)-1]
+			c.stop()
+			if c.err() != nil {
+				return nil
+			}
+		case opDeclare:
+			name := code.nodes[operand(instructions, ip)].(*ast.Identifier)
+			if declared(name, sc) {
+				i.interpreterError(code.nodes[operand(instructions, ip+2)], fmt.Sprintf("Identifier '%s' already declared", name.Value))
+				return nil
+			}
+			value := stack[len(stack)-1]
+			i.nameFunction(value, name.Value)
+			bind(name, sc, value, operand(instructions, ip+4) == 1)
+			ip += 6
+		case opTree:
+			value := i.Interpreter(code.nodes[operand(instructions, ip)], sc)
+			if value == nil {
+				return nil
+			}
+			stack = append(stack, value)
+			ip += 2
+		case opReturn:
+			return stack[len(stack)-1]
+		}
+	}
+}
+
+func (i *Interpreter) integerOp(op opcode, left, right int64) runtime.Data {
+	switch op {
+	case opAdd:
+		return &runtime.TInteger{Value: left + right}
+	case opSubtract:
+		return &runtime.TInteger{Value: left - right}
+	case opMultiply:
+		return &runtime.TInteger{Value: left * right}
+	case opLess:
+		return i.nativeToBoolean(left < right)
+	case opLessEqual:
+		return i.nativeToBoolean(left <= right)
+	case opGreater:
+		return i.nativeToBoolean(left > right)
+	case opGreaterEqual:
+		return i.nativeToBoolean(left >= right)
+	case opEqual:
+		return i.nativeToBoolean(left == right)
+	default:
+		return i.nativeToBoolean(left != right)
+	}
+}
+
+func (i *Interpreter) runtimeCall(nf *ast.FunctionCall, arguments []runtime.Data, sc *runtime.Scope) runtime.Data {
+	name := nf.Function.(*ast.Identifier)
+	if _, ok := i.natives[name.Value]; !ok {
+		return i.callRuntime(nf, runtime.FnRuntime[name.Value], arguments)
+	}
+	fn := i.Identifier(name, sc)
+	if fn == nil || !i.callable(nf, fn) {
+		return nil
+	}
+	return i.callData(nf, fn, arguments, sc)
+}
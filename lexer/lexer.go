@@ -12,32 +12,61 @@ import (
 	"github.com/luiscm/oro/token"
 )
 
+type Interpolation struct {
+	Position token.Position
+	Start    int
+	End      int
+}
+
 type Lexer struct {
-	buff    []byte
-	offset  int
-	curr    int
-	nextr   int
-	row     int
-	col     int
-	chr     rune
-	token   token.Token
-	command *cmd.Command
+	name           string
+	interpolations map[token.Position][]Interpolation
+	buff           []byte
+	offset         int
+	curr           int
+	nextr          int
+	row            int
+	col            int
+	chr            rune
+	start          token.Position
+	token          token.Token
+	command        *cmd.Command
+	diagnostics    *rerror.Diagnostics
 }
 
-func New(buffer []byte) *Lexer {
+func New(name string, buffer []byte) *Lexer {
 	l := &Lexer{
-		buff:    buffer,
-		row:     1,
-		col:     1,
-		command: &cmd.Command{},
+		name:           name,
+		interpolations: map[token.Position][]Interpolation{},
+		buff:           buffer,
+		row:            1,
+		col:            0,
+		command:        &cmd.Command{},
+		diagnostics:    rerror.NewDiagnostics(),
 	}
 	l.command.InsertAll()
 	l.next()
 	return l
 }
 
+func NewAt(position token.Position, buffer []byte) *Lexer {
+	l := New(position.File, buffer)
+	l.row = position.Row
+	l.col = position.Col
+	return l
+}
+
+func (l *Lexer) Interpolations(t token.Token) []Interpolation {
+	return l.interpolations[t.Position]
+}
+
+func (l *Lexer) Diagnostics() *rerror.Diagnostics {
+	return l.diagnostics
+}
+
 func (l *Lexer) NextToken() token.Token {
 	l.skipWhiteSpace()
+	l.start = l.position()
 	switch {
 	case l.chr == 0:
 		l.assignToken(token.Eof, "")
@@ -133,6 +162,9 @@ func (l *Lexer) NextToken() token.Token {
 			case '.':
 				l.next()
 				l.assignToken(token.Ellipsis, token.Ellipsis)
+			case '<':
+				l.next()
+				l.assignToken(token.RangeExclusive, token.RangeExclusive)
 			default:
 				l.assignToken(token.Range, token.Range)
 			}
@@ -206,6 +238,10 @@ func (l *Lexer) NextToken() token.Token {
 }
 
 func (l *Lexer) next() rune {
+	if l.chr == '\n' {
+		l.row++
+		l.col = 0
+	}
 	if l.nextr >= len(l.buff) {
 		l.chr = 0
 	} else {
@@ -215,10 +251,6 @@ func (l *Lexer) next() rune {
 	l.offset = l.curr
 	l.nextr++
 	l.col++
-	if l.chr == '\n' {
-		l.row++
-		l.col = 0
-	}
 	return l.chr
 }
 
@@ -230,21 +262,22 @@ func (l *Lexer) peek() rune {
 }
 
 func (l *Lexer) rewind() {
-	if l.nextr >= len(l.buff) {
-		l.chr = 0
-	} else {
-		l.chr = rune(l.buff[l.curr])
-	}
-	l.nextr = l.curr
-	l.offset = l.nextr
+	l.curr--
+	l.nextr = l.curr + 1
+	l.offset = l.curr
+	l.chr = rune(l.buff[l.curr])
 	l.col--
 }
 
+func (l *Lexer) position() token.Position {
+	return token.Position{File: l.name, Row: l.row, Col: l.col}
+}
+
 func (l *Lexer) assignToken(tokenType token.TType, value string) {
 	l.token = token.Token{
 		Type:     tokenType,
 		Literal:  value,
-		Position: token.Position{Row: l.row, Col: l.col},
+		Position: l.start,
 	}
 }
 
@@ -308,6 +341,8 @@ loop:
 				out.WriteRune('"')
 			case '\\':
 				out.WriteRune('\\')
+			case '#':
+				out.WriteRune('#')
 			case 'n', 't', 'r', 'a', 'b', 'f', 'v':
 				out.WriteRune('\\')
 				out.WriteRune(l.chr)
@@ -319,6 +354,18 @@ loop:
 			break loop
 		case '"':
 			break loop
+		case '#':
+			if l.peek() != '{' {
+				out.WriteRune(l.chr)
+				break
+			}
+			interpolation := Interpolation{Position: l.position(), Start: out.Len()}
+			if !l.skipInterpolation(&out) {
+				l.diagnostics.Error(rerror.Parse, interpolation.Position, 2, "Unterminated string interpolation")
+				break loop
+			}
+			interpolation.End = out.Len()
+			l.interpolations[l.start] = append(l.interpolations[l.start], interpolation)
 		default:
 			out.WriteRune(l.chr)
 		}
@@ -327,6 +374,54 @@ loop:
 	l.assignToken(token.String, out.String())
 }
 
+func (l *Lexer) skipInterpolation(out *bytes.Buffer) bool {
+	depth := 0
+	for {
+		out.WriteRune(l.chr)
+		switch l.chr {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return true
+			}
+		case '"':
+			if !l.skipQuoted(out) {
+				return false
+			}
+		}
+		l.next()
+		if l.chr == 0 {
+			return false
+		}
+	}
+}
+
+func (l *Lexer) skipQuoted(out *bytes.Buffer) bool {
+	for {
+		l.next()
+		switch {
+		case l.chr == 0:
+			return false
+		case l.chr == '\\' && l.peek() != 0:
+			out.WriteRune(l.chr)
+			l.next()
+			out.WriteRune(l.chr)
+			continue
+		case l.chr == '#' && l.peek() == '{':
+			if !l.skipInterpolation(out) {
+				return false
+			}
+			continue
+		}
+		out.WriteRune(l.chr)
+		if l.chr == '"' {
+			return true
+		}
+	}
+}
+
 func (l *Lexer) skipNumeric() {
 	var out bytes.Buffer
 	out.WriteRune(l.chr)
@@ -351,8 +446,6 @@ loop:
 		case l.chr == '.' && l.peek() == '.':
 			l.rewind()
 			break loop
-		case l.chr == 0:
-			break loop
 		default:
 			l.rewind()
 			break loop
@@ -429,5 +522,5 @@ loop:
 }
 
 func (l *Lexer) reportError(msg string) {
-	rerror.Error(rerror.Parse, token.Position{l.row, l.col}, msg)
+	l.diagnostics.Error(rerror.Parse, l.position(), 1, msg)
 }
@@ -69,7 +69,7 @@ val c = 10 & 5 >> 1 | 0 & ~1`
 		{token.BitwiseNot, "~"},
 		{token.Integer, "1"},
 	}
-	lex := New([]byte(input))
+	lex := New("", []byte(input))
 	for i, v := range tests {
 		tok := lex.NextToken()
 		if tok.Type != v.Type || tok.Literal != v.Literal {
@@ -92,7 +92,7 @@ func TestDataTypes(t *testing.T) {
 		{token.Boolean, "false"},
 		{token.String, "yes"},
 	}
-	lex := New([]byte(input))
+	lex := New("", []byte(input))
 	for i, v := range tests {
 		tok := lex.NextToken()
 		if tok.Type != v.Type || tok.Literal != v.Literal {
@@ -102,7 +102,7 @@ func TestDataTypes(t *testing.T) {
 }
 
 func TestDelimiters(t *testing.T) {
-	input := `(1, 2, a) ["yes", 5.1, b] [a: b, c: d] a.b a..b`
+	input := `(1, 2, a) ["yes", 5.1, b] [a: b, c: d] a.b a..b a..<b`
 	tests := []struct {
 		Type    token.TType
 		Literal string
@@ -136,8 +136,11 @@ func TestDelimiters(t *testing.T) {
 		{token.Identifier, "a"},
 		{token.Range, ".."},
 		{token.Identifier, "b"},
+		{token.Identifier, "a"},
+		{token.RangeExclusive, "..<"},
+		{token.Identifier, "b"},
 	}
-	lex := New([]byte(input))
+	lex := New("", []byte(input))
 	for i, v := range tests {
 		tok := lex.NextToken()
 		if tok.Type != v.Type || tok.Literal != v.Literal {
@@ -173,7 +176,7 @@ func TestKeywords(t *testing.T) {
 		{token.Module, "module"},
 		{token.Identifier, "yes"},
 	}
-	lex := New([]byte(input))
+	lex := New("", []byte(input))
 	for i, v := range tests {
 		tok := lex.NextToken()
 		if tok.Type != v.Type || tok.Literal != v.Literal {
@@ -254,7 +257,7 @@ end`
 		{token.NewLine, "\n"},
 		{token.End, "end"},
 	}
-	lex := New([]byte(input))
+	lex := New("", []byte(input))
 	for i, v := range tests {
 		tok := lex.NextToken()
 		if tok.Type != v.Type || tok.Literal != v.Literal {
@@ -262,3 +265,83 @@ end`
 		}
 	}
 }
+
+func TestPositions(t *testing.T) {
+	input := `val a = 10
+  a + "b"
+end`
+	tests := []struct {
+		Literal string
+		Row     int
+		Col     int
+	}{
+		{"val", 1, 1},
+		{"a", 1, 5},
+		{"=", 1, 7},
+		{"10", 1, 9},
+		{"\n", 1, 11},
+		{"a", 2, 3},
+		{"+", 2, 5},
+		{"b", 2, 7},
+		{"\n", 2, 10},
+		{"end", 3, 1},
+	}
+	lex := New("main.oro", []byte(input))
+	for _, v := range tests {
+		tok := lex.NextToken()
+		if tok.Literal != v.Literal || tok.Position.Row != v.Row || tok.Position.Col != v.Col {
+			t.Errorf("Expected %q at %d:%d but got %q at %d:%d", v.Literal, v.Row, v.Col, tok.Literal, tok.Position.Row, tok.Position.Col)
+		}
+		if tok.Position.File != "main.oro" {
+			t.Errorf("Expected file %s but got %s", "main.oro", tok.Position.File)
+		}
+	}
+}
+
+func TestInterpolations(t *testing.T) {
+	input := `val s = "a #{x} b #{f("#{y}")}"`
+	lex := New("main.oro", []byte(input))
+	var tok token.Token
+	for tok.Type != token.String {
+		tok = lex.NextToken()
+	}
+	tests := []struct {
+		Text string
+		Col  int
+	}{
+		{"#{x}", 12},
+		{`#{f("#{y}")}`, 19},
+	}
+	interpolations := lex.Interpolations(tok)
+	if len(interpolations) != len(tests) {
+		t.Fatalf("Expected %d interpolations but got %d", len(tests), len(interpolations))
+	}
+	for idx, v := range tests {
+		interpolation := interpolations[idx]
+		if text := tok.Literal[interpolation.Start:interpolation.End]; text != v.Text {
+			t.Errorf("Expected %q but got %q", v.Text, text)
+		}
+		if interpolation.Position.Row != 1 || interpolation.Position.Col != v.Col {
+			t.Errorf("Expected %q at %d:%d but got %d:%d", v.Text, 1, v.Col, interpolation.Position.Row, interpolation.Position.Col)
+		}
+	}
+}
+
+func TestEscapedInterpolation(t *testing.T) {
+	input := `"\#{x} #{y} \#"`
+	lex := New("main.oro", []byte(input))
+	tok := lex.NextToken()
+	if tok.Type != token.String {
+		t.Fatalf("Expected %s but got %s", token.String, tok.Type)
+	}
+	if expected := "#{x} #{y} #"; tok.Literal != expected {
+		t.Errorf("Expected %q but got %q", expected, tok.Literal)
+	}
+	interpolations := lex.Interpolations(tok)
+	if len(interpolations) != 1 {
+		t.Fatalf("Expected %d interpolations but got %d", 1, len(interpolations))
+	}
+	if text := tok.Literal[interpolations[0].Start:interpolations[0].End]; text != "#{y}" {
+		t.Errorf("Expected %q but got %q", "#{y}", text)
+	}
+}
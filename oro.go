@@ -1,118 +1,386 @@
 // Copyright 2011 The LuisCM. All rights reserved.
 // Use of this source code is license that can be found in the LICENSE file.
 
-// Package main implements functions to main application.
-package main
+// Package oro implements functions to embed the language in Go programs.
+package oro
 
 import (
-	"bufio"
+	"context"
 	"fmt"
-	"github.com/fatih/color"
+	"github.com/luiscm/oro/ast"
 	"github.com/luiscm/oro/interpreter"
 	"github.com/luiscm/oro/lexer"
 	"github.com/luiscm/oro/parser"
 	"github.com/luiscm/oro/rerror"
 	"github.com/luiscm/oro/runtime"
-	"github.com/luiscm/oro/util"
-	"github.com/urfave/cli"
+	"github.com/luiscm/oro/token"
 	"io/ioutil"
-	"os"
-	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 )
 
-func main() {
-	app := cli.NewApp()
-	app.Name = util.Name()
-	app.Usage = ""
-	app.Authors = []cli.Author{{
-		Name:  util.AuthorName(),
-		Email: util.AuthorEmail(),
-	}}
-	app.Version = util.Version()
-	app.Compiled = time.Now()
-	app.Copyright = fmt.Sprintf(util.Copyright(), time.Now().Year())
-	app.Commands = []cli.Command{
-		{
-			Name:  util.CliCommandNameRun(),
-			Usage: util.CliCommandUsageRun(),
-			Action: func(c *cli.Context) error {
-				if len(c.Args()) != 1 {
-					color.Red(util.CliCommandActionRunSourceFile())
-					return nil
-				}
-				file := c.Args()[0]
-				ext := filepath.Ext(file)
-				if ext == "" || ext != util.FileExtension() {
-					color.Red(util.CliCommandActionRunExistFile(), file)
-					return nil
-				}
-				source, err := ioutil.ReadFile(file)
-				if err != nil {
-					color.Red(util.CliCommandActionRunReadFile(), file)
-					return nil
-				}
-				lex := lexer.New(source)
-				if rerror.HasErrors() {
-					rerror.PrintErrors()
-					return nil
-				}
-				parse := parser.New(lex)
-				program := parse.Parse()
-				if rerror.HasErrors() {
-					rerror.PrintErrors()
-					return nil
-				}
-				runner := interpreter.New()
-				runner.Interpreter(program, runtime.NewScope())
-				if rerror.HasErrors() {
-					rerror.PrintErrors()
-					return nil
-				}
-				return nil
-			},
-		},
-		{
-			Name:  util.CliCommandNameRepl(),
-			Usage: util.CliCommandUsageRepl(),
-			Action: func(c *cli.Context) error {
-				input := bufio.NewReader(os.Stdin)
-				color.HiGreen(util.NameVersionEnvironment())
-				color.HiBlue(util.CommandExit())
-				sc := runtime.NewScope()
-				for {
-					color.Set(color.FgHiWhite)
-					fmt.Print(util.ReplSignal())
-					color.Unset()
-					source, _ := input.ReadBytes('\n')
-					lex := lexer.New(source)
-					if rerror.HasErrors() {
-						rerror.PrintErrors()
-						continue
-					}
-					parse := parser.New(lex)
-					program := parse.Parse()
-					if rerror.HasErrors() {
-						rerror.PrintErrors()
-						continue
-					}
-					runner := interpreter.New()
-					object := runner.Interpreter(program, sc)
-					if rerror.HasErrors() {
-						rerror.PrintErrors()
-						continue
-					}
-					if object != nil {
-						fmt.Println(object.Check())
-					}
-				}
-			},
-		},
-	}
-	app.CommandNotFound = func(ctx *cli.Context, command string) {
-		color.Set(color.FgHiRed)
-		fmt.Fprintf(ctx.App.Writer, util.CommandNotFound(), command)
-		color.Unset()
-	}
-	app.Run(os.Args)
+const hostFile = "<host>"
+
+type Symbol string
+
+type Pair struct {
+	Key   interface{}
+	Value interface{}
+}
+
+type Error struct {
+	Diagnostics []rerror.Diagnostic
+	Err         error
+}
+
+func (e *Error) Error() string {
+	var messages []string
+	for _, d := range e.Diagnostics {
+		messages = append(messages, d.String())
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type VM struct {
+	runner  *interpreter.Interpreter
+	scope   *runtime.Scope
+	timeout time.Duration
+	limits  interpreter.Limits
+}
+
+func NewVM() *VM {
+	return &VM{
+		runner: interpreter.New(),
+		scope:  runtime.NewScope(),
+	}
+}
+
+func (v *VM) Eval(ctx context.Context, source string) (interface{}, error) {
+	data, err := v.eval(ctx, "", []byte(source))
+	if err != nil {
+		return nil, err
+	}
+	return v.fromData(data)
+}
+
+func (v *VM) RunFile(path string) (interface{}, error) {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := v.eval(context.Background(), path, source)
+	if err != nil {
+		return nil, err
+	}
+	return v.fromData(data)
+}
+
+func (v *VM) Set(name string, value interface{}) error {
+	if v.scope.Immutable(name) {
+		return fmt.Errorf("identifier '%s' is immutable", name)
+	}
+	data, err := ToData(value)
+	if err != nil {
+		return err
+	}
+	if original, ok := v.scope.Read(name); ok && original.Type() != data.Type() {
+		return fmt.Errorf("identifier '%s' should keep the original data type '%s'", name, original.Type())
+	}
+	v.scope.Write(name, data)
+	return nil
+}
+
+func (v *VM) Get(name string) (interface{}, error) {
+	data, ok := v.scope.Read(name)
+	if !ok {
+		return nil, fmt.Errorf("identifier '%s' not found", name)
+	}
+	return v.fromData(data)
+}
+
+func (v *VM) SetLimits(limits interpreter.Limits) {
+	v.limits = limits
+	v.runner.SetLimits(limits)
+}
+
+func (v *VM) SetEngine(engine interpreter.Engine) {
+	v.runner.SetEngine(engine)
+}
+
+func (v *VM) SetTimeout(timeout time.Duration) {
+	v.timeout = timeout
+}
+
+func (v *VM) RegisterFunction(name string, fn runtime.TNativeFn) {
+	v.runner.RegisterFunction(name, fn)
+}
+
+func (v *VM) RegisterModule(name string, members map[string]interface{}) error {
+	results := map[string]runtime.Data{}
+	for member, value := range members {
+		if fn, ok := value.(func(context.Context, *runtime.Scope, ...runtime.Data) (runtime.Data, error)); ok {
+			value = runtime.TNativeFn(fn)
+		}
+		if fn, ok := value.(runtime.TNativeFn); ok {
+			results[member] = &runtime.TNativeFunction{Fn: fn}
+			continue
+		}
+		data, err := ToData(value)
+		if err != nil {
+			return err
+		}
+		results[member] = data
+	}
+	return v.runner.RegisterModule(name, results)
+}
+
+func (v *VM) Call(fnName string, args ...interface{}) (interface{}, error) {
+	var arguments []runtime.Data
+	for _, arg := range args {
+		data, err := ToData(arg)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, data)
+	}
+	cancel := v.start(context.Background())
+	defer cancel()
+	if runtimeFn, ok := runtime.FnRuntime[fnName]; ok && v.runner.Native(fnName) == nil {
+		data, err := runtimeFn(arguments...)
+		if err != nil {
+			return nil, &Error{Diagnostics: []rerror.Diagnostic{{Kind: rerror.Runtime, Message: err.Error()}}}
+		}
+		return v.fromData(data)
+	}
+	fn, err := v.lookup(fnName)
+	if err != nil {
+		return nil, err
+	}
+	node := &ast.FunctionCall{
+		Token:     token.Token{Type: token.Identifier, Literal: fnName, Position: token.Position{File: hostFile}},
+		Arguments: &ast.ExpressionList{},
+	}
+	var result runtime.Data
+	switch function := fn.(type) {
+	case *runtime.TFunction:
+		result = v.runner.Call(node, function, arguments, function.Scope)
+	case *runtime.TNativeFunction:
+		result = v.runner.NativeFunction(node, function, arguments, v.scope)
+	default:
+		return nil, fmt.Errorf("'%s' is not a function", fnName)
+	}
+	if err := v.collectErrors(v.runner.Diagnostics()); err != nil {
+		return nil, err
+	}
+	return v.fromData(result)
+}
+
+func (v *VM) lookup(name string) (runtime.Data, error) {
+	parts := strings.Split(name, ".")
+	switch len(parts) {
+	case 1:
+		if data, ok := v.scope.Read(name); ok {
+			return data, nil
+		}
+		if data := v.runner.Native(name); data != nil {
+			return data, nil
+		}
+		return nil, fmt.Errorf("identifier '%s' not found", name)
+	case 2:
+		access := &ast.ModuleAccess{
+			Token:     token.Token{Type: token.Dot, Literal: token.Dot},
+			Object:    &ast.Identifier{Value: parts[0]},
+			Parameter: &ast.Identifier{Value: parts[1]},
+		}
+		data := v.runner.Interpreter(access, v.scope)
+		if err := v.collectErrors(v.runner.Diagnostics()); err != nil {
+			return nil, err
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("invalid function name '%s'", name)
+	}
+}
+
+func (v *VM) eval(ctx context.Context, name string, source []byte) (runtime.Data, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cancel := v.start(ctx)
+	defer cancel()
+	lex := lexer.New(name, source)
+	parse := parser.New(lex)
+	program := parse.Parse()
+	if err := v.collectErrors(parse.Diagnostics()); err != nil {
+		return nil, err
+	}
+	result := v.runner.Interpreter(program, v.scope)
+	if err := v.collectErrors(v.runner.Diagnostics()); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (v *VM) start(ctx context.Context) context.CancelFunc {
+	cancel := func() {}
+	if v.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, v.timeout)
+	}
+	v.runner.SetContext(ctx)
+	v.runner.ResetLimits()
+	return cancel
+}
+
+func (v *VM) collectErrors(diagnostics *rerror.Diagnostics) error {
+	if !diagnostics.HasErrors() {
+		return nil
+	}
+	list := append([]rerror.Diagnostic{}, diagnostics.Errors()...)
+	diagnostics.Clear()
+	return &Error{Diagnostics: list, Err: v.runner.Halted()}
+}
+
+func ToData(value interface{}) (runtime.Data, error) {
+	switch v := value.(type) {
+	case nil:
+		return runtime.Nil, nil
+	case runtime.Data:
+		return v, nil
+	case bool:
+		if v {
+			return runtime.Yes, nil
+		}
+		return runtime.No, nil
+	case string:
+		return &runtime.TString{Value: v}, nil
+	case Symbol:
+		return &runtime.TSymbol{Value: string(v)}, nil
+	case []Pair:
+		pairs := runtime.NewDictionary()
+		for _, pair := range v {
+			key, err := ToData(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			element, err := ToData(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			pairs = pairs.Set(key, element)
+		}
+		return pairs, nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &runtime.TInteger{Value: rv.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &runtime.TInteger{Value: int64(rv.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &runtime.TFloat{Value: rv.Float()}, nil
+	case reflect.Slice, reflect.Array:
+		elements := []runtime.Data{}
+		for idx := 0; idx < rv.Len(); idx++ {
+			element, err := ToData(rv.Index(idx).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
+		}
+		return runtime.NewArray(elements), nil
+	case reflect.Map:
+		// Go maps have no order, so the pairs are set in the order of
+		// their keys.
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(a, b int) bool {
+			return fmt.Sprint(keys[a].Interface()) < fmt.Sprint(keys[b].Interface())
+		})
+		pairs := runtime.NewDictionary()
+		for _, k := range keys {
+			key, err := ToData(k.Interface())
+			if err != nil {
+				return nil, err
+			}
+			element, err := ToData(rv.MapIndex(k).Interface())
+			if err != nil {
+				return nil, err
+			}
+			pairs = pairs.Set(key, element)
+		}
+		return pairs, nil
+	default:
+		return nil, fmt.Errorf("can't convert Go type %T to an Oro value", value)
+	}
+}
+
+func FromData(data runtime.Data) (interface{}, error) {
+	return fromData(data, 0)
+}
+
+func (v *VM) fromData(data runtime.Data) (interface{}, error) {
+	return fromData(data, v.limits.MaxCollectionSize)
+}
+
+func fromData(data runtime.Data, maxSize int) (interface{}, error) {
+	switch d := data.(type) {
+	case nil, *runtime.TNil:
+		return nil, nil
+	case *runtime.TBoolean:
+		return d.Value, nil
+	case *runtime.TString:
+		return d.Value, nil
+	case *runtime.TSymbol:
+		return Symbol(d.Value), nil
+	case *runtime.TInteger:
+		return d.Value, nil
+	case *runtime.TFloat:
+		return d.Value, nil
+	case *runtime.TArray:
+		return fromElements(d.Len(), func(idx int) runtime.Data { return d.At(idx) }, maxSize)
+	case *runtime.TRange:
+		if maxSize > 0 && d.Len() > int64(maxSize) {
+			return nil, &Error{
+				Diagnostics: []rerror.Diagnostic{{Kind: rerror.Limit, Message: interpreter.ErrCollectionSize.Error()}},
+				Err:         interpreter.ErrCollectionSize,
+			}
+		}
+		return fromElements(int(d.Len()), func(idx int) runtime.Data { return d.At(int64(idx)) }, maxSize)
+	case *runtime.TDictionary:
+		pairs := make([]Pair, d.Len())
+		for idx := range pairs {
+			key, element := d.At(idx)
+			goKey, err := fromData(key, maxSize)
+			if err != nil {
+				return nil, err
+			}
+			goElement, err := fromData(element, maxSize)
+			if err != nil {
+				return nil, err
+			}
+			pairs[idx] = Pair{Key: goKey, Value: goElement}
+		}
+		return pairs, nil
+	case *runtime.TSequence:
+		return nil, fmt.Errorf("can't convert a Sequence to a Go value, convert it to an Array first")
+	default:
+		return data, nil
+	}
+}
+
+func fromElements(count int, at func(int) runtime.Data, maxSize int) (interface{}, error) {
+	elements := make([]interface{}, count)
+	for idx := range elements {
+		element, err := fromData(at(idx), maxSize)
+		if err != nil {
+			return nil, err
+		}
+		elements[idx] = element
+	}
+	return elements, nil
 }
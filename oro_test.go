@@ -0,0 +1,293 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+package oro
+
+import (
+	"context"
+	"errors"
+	"github.com/luiscm/oro/interpreter"
+	"github.com/luiscm/oro/runtime"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVMEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`1 + 2`, int64(3)},
+		{`"hello" + " " + "world"`, "hello world"},
+		{`2.5 * 2`, 5.0},
+		{`[1, "a", true]`, []interface{}{int64(1), "a", true}},
+		{`[:a => 1]`, []Pair{{Symbol("a"), int64(1)}}},
+		{`[1 => :a, "1" => :b]`, []Pair{{int64(1), Symbol("a")}, {"1", Symbol("b")}}},
+		{`:done`, Symbol("done")},
+		{`Enum.size([1, 2, 3])`, int64(3)},
+		{`1..3`, []interface{}{int64(1), int64(2), int64(3)}},
+		{`[0..<2 => 3..2]`, []Pair{{[]interface{}{int64(0), int64(1)}, []interface{}{int64(3), int64(2)}}}},
+	}
+	for _, test := range tests {
+		vm := NewVM()
+		actual, err := vm.Eval(context.Background(), test.input)
+		if err != nil {
+			t.Errorf("Expected no error but got %s", err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Expected %#v but got %#v", test.expected, actual)
+		}
+	}
+}
+
+func TestVMEvalErrors(t *testing.T) {
+	vm := NewVM()
+	if _, err := vm.Eval(context.Background(), `val a = `); err == nil {
+		t.Errorf("Expected a parse error but got nothing")
+	}
+	if _, err := vm.Eval(context.Background(), `missing + 1`); err == nil {
+		t.Errorf("Expected a runtime error but got nothing")
+	}
+	if _, err := vm.Eval(context.Background(), `1 + 1`); err != nil {
+		t.Errorf("Expected errors to be cleared but got %s", err)
+	}
+	if _, err := vm.Eval(context.Background(), "val a = 1 / 0\nval b = 2"); err == nil {
+		t.Errorf("Expected a runtime error but got nothing")
+	}
+	if actual, err := vm.Eval(context.Background(), `val a = b + 1
+a`); err != nil || actual != int64(3) {
+		t.Errorf("Expected %d but got %v (%v)", 3, actual, err)
+	}
+}
+
+func TestVMSetGet(t *testing.T) {
+	vm := NewVM()
+	if err := vm.Set("names", []string{"Luis", "Carlos"}); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if _, err := vm.Eval(context.Background(), `val count = Enum.size(names)`); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	count, err := vm.Get("count")
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if count != int64(2) {
+		t.Errorf("Expected %d but got %v", 2, count)
+	}
+	if _, err := vm.Get("unknown"); err == nil {
+		t.Errorf("Expected an error for an unknown identifier")
+	}
+	if err := vm.Set("channel", make(chan int)); err == nil {
+		t.Errorf("Expected an error for an unsupported Go type")
+	}
+	if err := vm.Set("count", 3); err == nil {
+		t.Errorf("Expected an error for an immutable identifier")
+	}
+	if count, _ := vm.Get("count"); count != int64(2) {
+		t.Errorf("Expected %d but got %v", 2, count)
+	}
+	if err := vm.Set("names", []string{}); err != nil {
+		t.Errorf("Expected no error but got %s", err)
+	}
+	if _, err := vm.Eval(context.Background(), `var x = 1`); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if err := vm.Set("x", "str"); err == nil {
+		t.Errorf("Expected an error for a type change")
+	}
+	if err := vm.Set("x", 2); err != nil {
+		t.Errorf("Expected no error but got %s", err)
+	}
+	if x, _ := vm.Get("x"); x != int64(2) {
+		t.Errorf("Expected %d but got %v", 2, x)
+	}
+}
+
+func TestVMSetMapOrder(t *testing.T) {
+	vm := NewVM()
+	if err := vm.Set("config", map[string]interface{}{"port": 80, "host": "oro", "debug": true}); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	actual, err := vm.Eval(context.Background(), `"#{config}"`)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if expected := "[debug => true, host => oro, port => 80]"; actual != expected {
+		t.Errorf("Expected %s but got %v", expected, actual)
+	}
+}
+
+func TestVMSetPairs(t *testing.T) {
+	vm := NewVM()
+	pairs := []Pair{{"1", "text"}, {int64(1), "number"}}
+	if err := vm.Set("pairs", pairs); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	actual, err := vm.Eval(context.Background(), `[pairs[1], pairs["1"], pairs]`)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	expected := []interface{}{"number", "text", pairs}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %#v but got %#v", expected, actual)
+	}
+}
+
+func TestVMCall(t *testing.T) {
+	vm := NewVM()
+	if _, err := vm.Eval(context.Background(), `val add = fn (x: Integer, y: Integer) -> Integer
+  x + y
+end`); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	tests := []struct {
+		name     string
+		args     []interface{}
+		expected interface{}
+	}{
+		{"add", []interface{}{2, 3}, int64(5)},
+		{"String.upper", []interface{}{"oro"}, "ORO"},
+		{"typeof", []interface{}{1.5}, "Float"},
+	}
+	for _, test := range tests {
+		actual, err := vm.Call(test.name, test.args...)
+		if err != nil {
+			t.Errorf("Expected no error but got %s", err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("Expected %v but got %v", test.expected, actual)
+		}
+	}
+	_, err := vm.Call("add", 1, "two")
+	if err == nil {
+		t.Fatalf("Expected a type mismatch error but got nothing")
+	}
+	if expected := "<host>: Type Error: Function asks for type 'Integer' but got 'String'"; err.Error() != expected {
+		t.Errorf("Expected %q but got %q", expected, err.Error())
+	}
+}
+
+func TestVMRegister(t *testing.T) {
+	vm := NewVM()
+	vm.RegisterFunction("greet", func(ctx context.Context, sc *runtime.Scope, args ...runtime.Data) (runtime.Data, error) {
+		return &runtime.TString{Value: "hello " + args[0].Check()}, nil
+	})
+	err := vm.RegisterModule("Config", map[string]interface{}{
+		"name": "oro",
+		"limit": func(ctx context.Context, sc *runtime.Scope, args ...runtime.Data) (runtime.Data, error) {
+			return &runtime.TInteger{Value: 10}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`greet("world")`, "hello world"},
+		{`Config.name`, "oro"},
+		{`Config.limit() + 1`, int64(11)},
+	}
+	for _, test := range tests {
+		actual, err := vm.Eval(context.Background(), test.input)
+		if err != nil {
+			t.Errorf("Expected no error but got %s", err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("Expected %v but got %v", test.expected, actual)
+		}
+	}
+	actual, err := vm.Call("greet", "there")
+	if err != nil || actual != "hello there" {
+		t.Errorf("Expected %s but got %v (%v)", "hello there", actual, err)
+	}
+	if _, err := NewVM().Eval(context.Background(), `greet("world")`); err == nil {
+		t.Errorf("Expected registrations to be local to a VM")
+	}
+}
+
+func TestVMLimits(t *testing.T) {
+	vm := NewVM()
+	vm.SetTimeout(50 * time.Millisecond)
+	_, err := vm.Eval(context.Background(), `repeat
+  1
+end`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+	vm.SetTimeout(0)
+	vm.SetLimits(interpreter.Limits{MaxSteps: 10000})
+	_, err = vm.Eval(context.Background(), `repeat
+  1
+end`)
+	if !errors.Is(err, interpreter.ErrStepLimit) {
+		t.Errorf("Expected %v but got %v", interpreter.ErrStepLimit, err)
+	}
+	if _, err := vm.Eval(context.Background(), `1 + 1`); err != nil {
+		t.Errorf("Expected the step count to be reset but got %s", err)
+	}
+	vm.SetLimits(interpreter.Limits{MaxCollectionSize: 100})
+	_, err = vm.Eval(context.Background(), `1..1_000_000_000`)
+	if !errors.Is(err, interpreter.ErrCollectionSize) {
+		t.Errorf("Expected %v but got %v", interpreter.ErrCollectionSize, err)
+	}
+}
+
+func TestVMSequence(t *testing.T) {
+	vm := NewVM()
+	_, err := vm.Eval(context.Background(), `val count = fn
+  yield 1
+end
+count()`)
+	if err == nil {
+		t.Errorf("Expected an error for a Sequence but got nothing")
+	}
+	actual, err := vm.Eval(context.Background(), `count() as Array`)
+	if err != nil || !reflect.DeepEqual(actual, []interface{}{int64(1)}) {
+		t.Errorf("Expected %v but got %v (%v)", []interface{}{int64(1)}, actual, err)
+	}
+}
+
+func TestVMStopsTasks(t *testing.T) {
+	vm := NewVM()
+	_, err := vm.Eval(context.Background(), `val ch = Channel(1)
+var log = []
+val task = spawn fn
+  ch.receive()
+  log = log + [:late]
+  missing()
+end
+:started`)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	actual, err := vm.Eval(context.Background(), `ch.send(1)
+repeat i in 1..2000
+  i
+end
+val other = spawn fn
+  :other
+end
+[await other, log]`)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	expected := []interface{}{Symbol("other"), []interface{}{}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %#v but got %#v", expected, actual)
+	}
+	actual, err = vm.Eval(context.Background(), `try
+  await task
+rescue err
+  err[:tag]
+end`)
+	if err != nil || actual != Symbol("stopped") {
+		t.Errorf("Expected %v but got %v (%v)", Symbol("stopped"), actual, err)
+	}
+}
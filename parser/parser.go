@@ -24,21 +24,37 @@ type Parser struct {
 	lexer          *lexer.Lexer
 	token          token.Token
 	peekToken      token.Token
+	previousToken  token.Token
+	pending        []token.Token
+	indent         int
+	open           int
+	recovering     bool
+	patterns       int
+	functions      int
+	yielded        bool
 	prefixFunction map[token.TType]prefixParseFn
 	infixFunction  map[token.TType]infixParseFn
+	diagnostics    *rerror.Diagnostics
 }
 
 func New(l *lexer.Lexer) *Parser {
-	parser := &Parser{lexer: l}
+	parser := &Parser{lexer: l, diagnostics: rerror.NewDiagnostics()}
 	parser.prefixFunction = make(map[token.TType]prefixParseFn)
 	parser.infixFunction = make(map[token.TType]infixParseFn)
 	parser.prefix(token.Val, parser.parseVal)
 	parser.prefix(token.Var, parser.parseVar)
 	parser.prefix(token.Module, parser.parseModule)
+	parser.prefix(token.Struct, parser.parseStruct)
+	parser.prefix(token.Enum, parser.parseEnum)
 	parser.prefix(token.If, parser.parseIf)
 	parser.prefix(token.Match, parser.parseMatch)
+	parser.prefix(token.Try, parser.parseTry)
 	parser.prefix(token.Repeat, parser.parseRepeat)
 	parser.prefix(token.Function, parser.parseFunction)
+	parser.prefix(token.Yield, parser.parseYield)
+	parser.prefix(token.Spawn, parser.parseSpawn)
+	parser.prefix(token.Await, parser.parseAwait)
+	parser.prefix(token.Select, parser.parseSelect)
 	parser.prefix(token.Use, parser.parseUse)
 	parser.prefix(token.LeftBracket, parser.parseArrayOrDictionary)
 	parser.prefix(token.Identifier, parser.parseIdentifier)
@@ -48,6 +64,7 @@ func New(l *lexer.Lexer) *Parser {
 	parser.prefix(token.Boolean, parser.parseBoolean)
 	parser.prefix(token.Nil, parser.parseNil)
 	parser.prefix(token.Underscore, parser.parsePlaceHolder)
+	parser.prefix(token.Ellipsis, parser.parseRestPattern)
 	parser.prefix(token.Colon, parser.parseSymbol)
 	parser.prefix(token.Not, parser.parsePrefix)
 	parser.prefix(token.BitwiseNot, parser.parsePrefix)
@@ -67,6 +84,9 @@ func New(l *lexer.Lexer) *Parser {
 	parser.infix(token.Is, parser.parseIs)
 	parser.infix(token.As, parser.parseAs)
 	parser.infix(token.Range, parser.parseInfix)
+	parser.infix(token.RangeExclusive, parser.parseInfix)
+	parser.infix(token.Step, parser.parseInfix)
+	parser.infix(token.In, parser.parseInfix)
 	parser.infix(token.Plus, parser.parseInfix)
 	parser.infix(token.Minus, parser.parseInfix)
 	parser.infix(token.Divide, parser.parseInfix)
@@ -90,6 +110,13 @@ func New(l *lexer.Lexer) *Parser {
 	return parser
 }
 
+func (p *Parser) Diagnostics() *rerror.Diagnostics {
+	diagnostics := rerror.NewDiagnostics()
+	diagnostics.Merge(p.lexer.Diagnostics())
+	diagnostics.Merge(p.diagnostics)
+	return diagnostics.Sorted()
+}
+
 func (p *Parser) prefix(tokenType token.TType, fn prefixParseFn) {
 	p.prefixFunction[tokenType] = fn
 }
@@ -113,8 +140,23 @@ func (p *Parser) peekPrecedence() int {
 }
 
 func (p *Parser) nextToken() {
+	p.previousToken = p.token
 	p.token = p.peekToken
-	p.peekToken = p.lexer.NextToken()
+	if len(p.pending) > 0 {
+		p.peekToken = p.pending[len(p.pending)-1]
+		p.pending = p.pending[:len(p.pending)-1]
+	} else {
+		p.peekToken = p.lexer.NextToken()
+	}
+	if p.previousToken.Type == "" || p.previousToken.Type == token.NewLine {
+		p.indent = p.token.Position.Col
+	}
+}
+
+func (p *Parser) unread() {
+	p.pending = append(p.pending, p.peekToken)
+	p.peekToken = p.token
+	p.token = p.previousToken
 }
 
 func (p *Parser) matchToken(tokenType ...token.TType) bool {
@@ -149,9 +191,23 @@ func (p *Parser) Parse() *ast.Program {
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	open, recovering := p.open, p.recovering
+	p.recovering = false
+	statement := p.parseStatementKind()
+	if p.recovering {
+		p.recover(open)
+	}
+	p.recovering = recovering
+	return statement
+}
+
+func (p *Parser) parseStatementKind() ast.Statement {
 	switch p.token.Type {
 	case token.Comment, token.NewLine:
 		return nil
+	case token.End:
+		p.parserError("END without a matching block")
+		return nil
 	case token.Break:
 		return p.parseBreak()
 	case token.Continue:
@@ -165,12 +221,19 @@ func (p *Parser) parseStatement() ast.Statement {
 
 func (p *Parser) parseVal() ast.Expression {
 	expression := &ast.Val{Token: p.token}
-	if !p.peekTokenMatch(token.Identifier) {
+	switch {
+	case p.peekTokenMatch(token.Identifier):
+		p.nextToken()
+		expression.Name = &ast.Identifier{Token: p.token, Value: p.token.Literal}
+	case p.peekTokenMatch(token.LeftBracket):
+		p.nextToken()
+		if expression.Pattern = p.parseDestructuring(); expression.Pattern == nil {
+			return nil
+		}
+	default:
 		p.parserError("VAL expects an identifier")
 		return nil
 	}
-	p.nextToken()
-	expression.Name = &ast.Identifier{Token: p.token, Value: p.token.Literal}
 	if !p.peekTokenMatch(token.Assign) {
 		p.parserError("Missing assignment in VAL")
 		return nil
@@ -183,12 +246,19 @@ func (p *Parser) parseVal() ast.Expression {
 
 func (p *Parser) parseVar() ast.Expression {
 	expression := &ast.Var{Token: p.token}
-	if !p.peekTokenMatch(token.Identifier) {
+	switch {
+	case p.peekTokenMatch(token.Identifier):
+		p.nextToken()
+		expression.Name = &ast.Identifier{Token: p.token, Value: p.token.Literal}
+	case p.peekTokenMatch(token.LeftBracket):
+		p.nextToken()
+		if expression.Pattern = p.parseDestructuring(); expression.Pattern == nil {
+			return nil
+		}
+	default:
 		p.parserError("VAR expects an identifier")
 		return nil
 	}
-	p.nextToken()
-	expression.Name = &ast.Identifier{Token: p.token, Value: p.token.Literal}
 	if !p.peekTokenMatch(token.Assign) {
 		p.parserError("Missing assignment in VAR")
 		return nil
@@ -199,8 +269,15 @@ func (p *Parser) parseVar() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseDestructuring() ast.Expression {
+	p.patterns++
+	defer func() { p.patterns-- }()
+	return p.parseArrayOrDictionary()
+}
+
 func (p *Parser) parseModule() ast.Expression {
 	expression := &ast.Module{Token: p.token}
+	indent := p.openBlock()
 	if !p.peekTokenMatch(token.Identifier) {
 		p.parserError("Expecting an identifier as MODULE name")
 		return nil
@@ -211,30 +288,161 @@ func (p *Parser) parseModule() ast.Expression {
 		p.nextToken()
 	}
 	expression.Body = p.parseBlockBody()
-	if !p.matchToken(token.End) {
-		p.parserError("Missing END closing statement in MODULE")
+	if !p.closeBlock(expression.Token, indent, "Missing END closing statement in MODULE") {
 		return nil
 	}
 	return expression
 }
 
-func (p *Parser) parseModuleAccess(left ast.Expression) ast.Expression {
-	switch object := left.(type) {
-	case *ast.Identifier:
-		expression := &ast.ModuleAccess{Token: p.token, Object: object}
-		if p.peekTokenMatch(token.Identifier) {
-			p.nextToken()
-			expression.Parameter = &ast.Identifier{Token: p.token, Value: p.token.Literal}
-			return expression
+func (p *Parser) parseStruct() ast.Expression {
+	expression := &ast.Struct{Token: p.token}
+	indent := p.openBlock()
+	if !p.peekTokenMatch(token.Identifier) {
+		p.parserError("STRUCT expects an identifier")
+		return nil
+	}
+	p.nextToken()
+	expression.Name = &ast.Identifier{Token: p.token, Value: p.token.Literal}
+	declared := map[string]bool{}
+	valid := true
+	p.nextToken()
+	for !p.matchToken(token.End, token.Eof) {
+		switch p.token.Type {
+		case token.Comma, token.NewLine, token.Comment:
+		case token.Identifier:
+			field, ok := p.parseField("STRUCT", "Struct", declared)
+			if !ok {
+				valid = false
+				break
+			}
+			expression.Fields = append(expression.Fields, field)
+		default:
+			p.parserError(fmt.Sprintf("Unexpected token '%s' as struct field", p.token.Literal))
+			valid = false
 		}
-	default:
-		p.parserError(fmt.Sprintf("Cannot use '%s' as MODULE caller", object.TokenLiteral()))
+		p.nextToken()
+	}
+	if len(expression.Fields) == 0 && valid {
+		p.parserError("Empty STRUCT")
+		valid = false
+	}
+	if !p.closeBlock(expression.Token, indent, "Missing END closing statement in STRUCT") || !valid {
+		return nil
+	}
+	return expression
+}
+
+func (p *Parser) parseField(block, kind string, declared map[string]bool) (*ast.StructField, bool) {
+	field := &ast.StructField{Token: p.token, Name: &ast.Identifier{Token: p.token, Value: p.token.Literal}}
+	valid := true
+	if declared[field.Name.Value] {
+		p.parserError(fmt.Sprintf("Field '%s' declared twice in %s", field.Name.Value, block))
+		valid = false
+	}
+	declared[field.Name.Value] = true
+	if p.peekTokenMatch(token.Colon) {
+		p.nextToken()
+		if !p.peekTokenMatch(token.Identifier) {
+			p.parserError(fmt.Sprintf("%s field '%s' expecting a types", kind, field.Name.Value))
+			return nil, false
+		}
+		p.nextToken()
+		field.Type = &ast.Identifier{Token: p.token, Value: p.token.Literal}
+	}
+	return field, valid
+}
+
+func (p *Parser) parseEnum() ast.Expression {
+	expression := &ast.Enum{Token: p.token}
+	indent := p.openBlock()
+	if !p.peekTokenMatch(token.Identifier) {
+		p.parserError("ENUM expects an identifier")
+		return nil
+	}
+	p.nextToken()
+	expression.Name = &ast.Identifier{Token: p.token, Value: p.token.Literal}
+	declared := map[string]bool{}
+	valid := true
+	p.nextToken()
+	for !p.matchToken(token.End, token.Eof) {
+		switch p.token.Type {
+		case token.Comma, token.NewLine, token.Comment:
+		case token.Identifier:
+			variant := &ast.EnumVariant{Token: p.token, Name: &ast.Identifier{Token: p.token, Value: p.token.Literal}}
+			if declared[variant.Name.Value] {
+				p.parserError(fmt.Sprintf("Variant '%s' declared twice in ENUM", variant.Name.Value))
+				valid = false
+			}
+			declared[variant.Name.Value] = true
+			if p.peekTokenMatch(token.LeftParenthesis) {
+				p.nextToken()
+				if !p.parsePayload(variant) {
+					valid = false
+				}
+			}
+			expression.Variants = append(expression.Variants, variant)
+		default:
+			p.parserError(fmt.Sprintf("Unexpected token '%s' as enum variant", p.token.Literal))
+			valid = false
+		}
+		p.nextToken()
+	}
+	if len(expression.Variants) == 0 && valid {
+		p.parserError("Empty ENUM")
+		valid = false
+	}
+	if !p.closeBlock(expression.Token, indent, "Missing END closing statement in ENUM") || !valid {
+		return nil
+	}
+	return expression
+}
+
+func (p *Parser) parsePayload(variant *ast.EnumVariant) bool {
+	declared := map[string]bool{}
+	valid := true
+	p.nextToken()
+	for !p.matchToken(token.RightParenthesis) {
+		switch p.token.Type {
+		case token.Comma:
+		case token.Identifier:
+			field, ok := p.parseField("variant "+variant.Name.Value, "Variant", declared)
+			if !ok {
+				valid = false
+				break
+			}
+			variant.Fields = append(variant.Fields, field)
+		case token.NewLine, token.Eof:
+			p.parserError(fmt.Sprintf("Missing ')' closing the payload of variant '%s'", variant.Name.Value))
+			return false
+		default:
+			p.parserError(fmt.Sprintf("Unexpected token '%s' as variant field", p.token.Literal))
+			valid = false
+		}
+		p.nextToken()
+	}
+	if len(variant.Fields) == 0 && valid {
+		p.parserError(fmt.Sprintf("Empty payload in variant '%s'", variant.Name.Value))
+		valid = false
+	}
+	return valid
+}
+
+func (p *Parser) parseModuleAccess(left ast.Expression) ast.Expression {
+	if !p.peekTokenMatch(token.Identifier) {
+		p.parserError("MODULE access expects an identifier")
+		return nil
 	}
-	return nil
+	dot := p.token
+	p.nextToken()
+	member := &ast.Identifier{Token: p.token, Value: p.token.Literal}
+	if object, ok := left.(*ast.Identifier); ok {
+		return &ast.ModuleAccess{Token: dot, Object: object, Parameter: member}
+	}
+	return &ast.FieldAccess{Token: dot, Object: left, Field: member}
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Token: p.token, Value: p.token.Literal}
+	return p.parseTypePattern(&ast.Identifier{Token: p.token, Value: p.token.Literal})
 }
 
 func (p *Parser) parseInteger() ast.Expression {
@@ -272,7 +480,38 @@ func (p *Parser) parseFloat() ast.Expression {
 }
 
 func (p *Parser) parseString() ast.Expression {
-	return &ast.String{Token: p.token, Value: p.token.Literal}
+	expression := &ast.String{Token: p.token, Value: p.token.Literal}
+	interpolations := p.lexer.Interpolations(p.token)
+	if len(interpolations) == 0 {
+		return expression
+	}
+	expression.Interpolated = map[string]ast.Expression{}
+	for _, interpolation := range interpolations {
+		text := expression.Value[interpolation.Start:interpolation.End]
+		source := strings.TrimSpace(text[2 : len(text)-1])
+		if source == "" {
+			p.diagnostics.Error(rerror.Parse, interpolation.Position, len(text), "Empty expression in string interpolation")
+			continue
+		}
+		position := interpolation.Position
+		position.Col += 2
+		parse := New(lexer.NewAt(position, []byte(text[2:len(text)-1])))
+		for parse.matchToken(token.NewLine) {
+			parse.nextToken()
+		}
+		value := parse.parseExpression(Lowest)
+		parse.nextToken()
+		for parse.matchToken(token.NewLine) {
+			parse.nextToken()
+		}
+		if !parse.matchToken(token.Eof) {
+			parse.parserError(fmt.Sprintf("Unexpected '%s' in string interpolation", parse.token.Literal))
+		}
+		p.diagnostics.Merge(parse.Diagnostics())
+		expression.Interpolated[text] = value
+		expression.Starts = append(expression.Starts, interpolation.Start)
+	}
+	return expression
 }
 
 func (p *Parser) parseBoolean() ast.Expression {
@@ -285,6 +524,7 @@ func (p *Parser) parseNil() ast.Expression {
 
 func (p *Parser) parseIf() ast.Expression {
 	expression := &ast.If{Token: p.token}
+	indent := p.openBlock()
 	p.nextToken()
 	expression.Condition = p.parseExpression(Lowest)
 	if expression.Condition == nil {
@@ -295,6 +535,7 @@ func (p *Parser) parseIf() ast.Expression {
 	if p.matchToken(token.Then, token.Do) {
 		p.nextToken()
 	}
+	valid := true
 	block := &ast.BlockStatement{Token: p.token}
 	block.Statements = []ast.Statement{}
 	for !p.matchToken(token.End, token.Else, token.Eof) {
@@ -306,19 +547,47 @@ func (p *Parser) parseIf() ast.Expression {
 	}
 	if len(block.Statements) == 0 {
 		p.parserError("Empty body in IF")
-		return nil
+		valid = false
 	}
 	expression.Then = block
 	if p.matchToken(token.Else) {
 		elseBody := p.parseBlockBody()
-		if len(elseBody.Statements) == 0 {
+		if len(elseBody.Statements) == 0 && valid {
 			p.parserError("Empty ELSE body in IF")
-			return nil
+			valid = false
 		}
 		expression.Else = elseBody
 	}
-	if !p.matchToken(token.End) {
-		p.parserError("Missing END closing statement in IF")
+	if !p.closeBlock(expression.Token, indent, "Missing END closing statement in IF") || !valid {
+		return nil
+	}
+	return expression
+}
+
+func (p *Parser) parseTry() ast.Expression {
+	expression := &ast.Try{Token: p.token}
+	indent := p.openBlock()
+	valid := true
+	expression.Body = p.parseBlockUntil(token.Rescue, token.Ensure, token.End, token.Eof)
+	if len(expression.Body.Statements) == 0 {
+		p.parserError("Empty body in TRY")
+		valid = false
+	}
+	if p.matchToken(token.Rescue) {
+		if p.peekTokenMatch(token.Identifier) {
+			p.nextToken()
+			expression.Error = &ast.Identifier{Token: p.token, Value: p.token.Literal}
+		}
+		expression.Rescue = p.parseBlockUntil(token.Ensure, token.End, token.Eof)
+	}
+	if p.matchToken(token.Ensure) {
+		expression.Ensure = p.parseBlockBody()
+	}
+	if expression.Rescue == nil && expression.Ensure == nil && valid {
+		p.parserError("Missing RESCUE or ENSURE in TRY")
+		valid = false
+	}
+	if !p.closeBlock(expression.Token, indent, "Missing END closing statement in TRY") || !valid {
 		return nil
 	}
 	return expression
@@ -326,6 +595,7 @@ func (p *Parser) parseIf() ast.Expression {
 
 func (p *Parser) parseMatch() ast.Expression {
 	expression := &ast.Match{Token: p.token}
+	indent := p.openBlock()
 	p.nextToken()
 	expression.Control = p.parseExpression(Lowest)
 	if expression.Control != nil {
@@ -342,12 +612,23 @@ func (p *Parser) parseMatch() ast.Expression {
 			matchWhen := &ast.MatchWhen{Token: p.token}
 			list := &ast.ExpressionList{Token: p.token}
 			p.nextToken()
-			list.Elements = p.parseDelimited(token.Comma, token.NewLine, token.Then)
+			list.Elements = p.parsePatterns()
 			if len(list.Elements) == 0 {
 				p.parserError("Missing expression in MATCH WHEN")
 				break
 			}
 			matchWhen.Values = list
+			if p.matchToken(token.If) {
+				p.nextToken()
+				if matchWhen.Guard = p.parseExpression(Lowest); matchWhen.Guard == nil {
+					break
+				}
+				p.nextToken()
+				if !p.matchToken(token.Then, token.NewLine) {
+					p.parserError("Missing THEN after the guard of MATCH WHEN")
+					break
+				}
+			}
 			matchWhen.Body = p.parseMatchWhen()
 			whens = append(whens, matchWhen)
 		case token.Else:
@@ -365,8 +646,7 @@ func (p *Parser) parseMatch() ast.Expression {
 		p.nextToken()
 	}
 	expression.Whens = whens
-	if !p.matchToken(token.End) {
-		p.parserError("Missing END closing statement in MATCH")
+	if !p.closeBlock(expression.Token, indent, "Missing END closing statement in MATCH") {
 		return nil
 	}
 	return expression
@@ -385,8 +665,93 @@ func (p *Parser) parseMatchWhen() *ast.BlockStatement {
 	return block
 }
 
+func (p *Parser) parseSelect() ast.Expression {
+	expression := &ast.Select{Token: p.token}
+	indent := p.openBlock()
+	if !p.peekTokenMatch(token.NewLine) {
+		p.parserError("SELECT expects its WHEN on the next lines")
+		return nil
+	}
+	p.nextToken()
+	for !p.matchToken(token.End, token.Eof) {
+		switch p.token.Type {
+		case token.When:
+			selectCase := p.parseSelectCase()
+			if selectCase == nil {
+				return nil
+			}
+			expression.Cases = append(expression.Cases, selectCase)
+		case token.Else:
+			if !p.peekTokenMatch(token.Then, token.NewLine) {
+				p.parserError("ELSE in SELECT can't have parameters")
+				return nil
+			}
+			p.nextToken()
+			expression.Else = p.parseMatchWhen()
+			if len(expression.Else.Statements) == 0 {
+				p.parserError("Missing ELSE body in SELECT")
+				return nil
+			}
+		}
+		p.nextToken()
+	}
+	if !p.closeBlock(expression.Token, indent, "Missing END closing statement in SELECT") {
+		return nil
+	}
+	if len(expression.Cases) == 0 {
+		p.parserError("SELECT expects at least one WHEN")
+		return nil
+	}
+	return expression
+}
+
+func (p *Parser) parseSelectCase() *ast.SelectCase {
+	selectCase := &ast.SelectCase{Token: p.token}
+	p.nextToken()
+	operation := p.parseExpression(Lowest)
+	if operation == nil {
+		return nil
+	}
+	if assign, ok := operation.(*ast.Assign); ok && assign.Operator == token.Assign {
+		if name, ok := assign.Name.(*ast.Identifier); ok {
+			selectCase.Name = name
+			operation = assign.Right
+		}
+	}
+	method := ""
+	call, ok := operation.(*ast.FunctionCall)
+	if ok {
+		switch function := call.Function.(type) {
+		case *ast.ModuleAccess:
+			selectCase.Channel, method = function.Object, function.Parameter.Value
+		case *ast.FieldAccess:
+			selectCase.Channel, method = function.Object, function.Field.Value
+		}
+	}
+	switch {
+	case method == "receive" && len(call.Arguments.Elements) == 0:
+	case method == "send" && selectCase.Name == nil && len(call.Arguments.Elements) == 1:
+		selectCase.Value = call.Arguments.Elements[0]
+	default:
+		p.parserError("SELECT WHEN expects a receive() or a send(value) on a channel")
+		return nil
+	}
+	p.nextToken()
+	if !p.matchToken(token.Then, token.NewLine) {
+		p.parserError("Missing THEN in SELECT WHEN")
+		return nil
+	}
+	selectCase.Body = p.parseMatchWhen()
+	if len(selectCase.Body.Statements) == 0 {
+		p.parserError("Missing body in SELECT WHEN")
+		return nil
+	}
+	return selectCase
+}
+
 func (p *Parser) parseRepeat() ast.Expression {
 	expression := &ast.Repeat{Token: p.token}
+	indent := p.openBlock()
 	expression.Arguments = &ast.IdentifierList{}
 	var arguments []*ast.Identifier
 	p.nextToken()
@@ -403,6 +768,14 @@ loop:
 				return nil
 			}
 			break loop
+		case token.LeftBracket:
+			if expression.Pattern = p.parseDestructuring(); expression.Pattern == nil {
+				return nil
+			}
+			if !p.peekTokenMatch(token.In) {
+				p.parserError("Destructuring pattern in REPEAT loop should be the last argument")
+				return nil
+			}
 		default:
 			arguments = append(arguments, &ast.Identifier{Token: p.token, Value: p.token.Literal})
 		}
@@ -414,10 +787,8 @@ loop:
 	expression.Body = p.parseBlockBody()
 	if len(expression.Body.Statements) == 0 {
 		p.parserError("Empty body in REPEAT loop")
-		return nil
 	}
-	if !p.matchToken(token.End) {
-		p.parserError("Missing END closing statement in REPEAT loop")
+	if !p.closeBlock(expression.Token, indent, "Missing END closing statement in REPEAT loop") || len(expression.Body.Statements) == 0 {
 		return nil
 	}
 	return expression
@@ -426,6 +797,7 @@ loop:
 func (p *Parser) parseFunction() ast.Expression {
 	expression := &ast.Function{Token: p.token, Variadic: false}
 	expression.Parameters = []*ast.FunctionParameter{}
+	indent := p.openBlock()
 	p.nextToken()
 	for !p.matchToken(token.Do, token.NewLine) {
 		switch p.token.Type {
@@ -486,13 +858,13 @@ func (p *Parser) parseFunction() ast.Expression {
 		}
 		p.nextToken()
 	}
-	expression.Body = p.parseBlockBody()
+	expression.Body, expression.Generator = p.parseFunctionBody(func() *ast.BlockStatement {
+		return p.parseBlockBody()
+	})
 	if len(expression.Body.Statements) == 0 {
 		p.parserError("Empty body in function")
-		return nil
 	}
-	if !p.matchToken(token.End) {
-		p.parserError("Missing END statement in function")
+	if !p.closeBlock(expression.Token, indent, "Missing END statement in function") || len(expression.Body.Statements) == 0 {
 		return nil
 	}
 	return expression
@@ -558,6 +930,7 @@ func (p *Parser) parseArrayOrDictionary() ast.Expression {
 				return nil
 			}
 			expression.Pairs[v] = list[i+1]
+			expression.Keys = append(expression.Keys, v)
 		}
 	}
 	return expression
@@ -636,10 +1009,101 @@ func (p *Parser) parseArrowFunction(left ast.Expression) ast.Expression {
 		return nil
 	}
 	p.nextToken()
-	expression.Body = &ast.BlockStatement{
-		Statements: []ast.Statement{
-			p.parseExpressionStatement(),
-		},
+	expression.Body, expression.Generator = p.parseFunctionBody(func() *ast.BlockStatement {
+		return &ast.BlockStatement{
+			Statements: []ast.Statement{
+				p.parseExpressionStatement(),
+			},
+		}
+	})
+	return expression
+}
+
+func (p *Parser) parseFunctionBody(parse func() *ast.BlockStatement) (*ast.BlockStatement, bool) {
+	yielded := p.yielded
+	p.yielded = false
+	p.functions++
+	body := parse()
+	generator := p.yielded
+	p.functions--
+	p.yielded = yielded
+	if body != nil && !generator {
+		p.markTailCalls(body, true)
+	}
+	return body, generator
+}
+
+// markTailCalls marks the calls in tail position of a function body: the
+// last expression of the body, of the branches of an if, a match or a select
+// in tail position, and the value of a return. Nothing in a try is marked,
+// as its rescue and ensure must run after the call.
+func (p *Parser) markTailCalls(node ast.Node, tail bool) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		for idx, statement := range node.Statements {
+			p.markTailCalls(statement, tail && idx == len(node.Statements)-1)
+		}
+	case *ast.ExpressionStatement:
+		p.markTailCalls(node.Expression, tail)
+	case *ast.Return:
+		p.markTailCalls(node.Value, true)
+	case *ast.FunctionCall:
+		node.Tail = tail
+	case *ast.If:
+		p.markTailCalls(node.Then, tail)
+		if node.Else != nil {
+			p.markTailCalls(node.Else, tail)
+		}
+	case *ast.Match:
+		for _, when := range node.Whens {
+			p.markTailCalls(when.Body, tail)
+		}
+		if node.Else != nil {
+			p.markTailCalls(node.Else, tail)
+		}
+	case *ast.Select:
+		for _, selectCase := range node.Cases {
+			p.markTailCalls(selectCase.Body, tail)
+		}
+		if node.Else != nil {
+			p.markTailCalls(node.Else, tail)
+		}
+	case *ast.Repeat:
+		p.markTailCalls(node.Body, false)
+	}
+}
+
+func (p *Parser) parseSpawn() ast.Expression {
+	expression := &ast.Spawn{Token: p.token}
+	p.nextToken()
+	if expression.Function = p.parseExpression(Lowest); expression.Function == nil {
+		return nil
+	}
+	return expression
+}
+
+func (p *Parser) parseAwait() ast.Expression {
+	expression := &ast.Await{Token: p.token}
+	p.nextToken()
+	if expression.Task = p.parseExpression(Prefix); expression.Task == nil {
+		return nil
+	}
+	return expression
+}
+
+func (p *Parser) parseYield() ast.Expression {
+	expression := &ast.Yield{Token: p.token}
+	if p.functions == 0 {
+		p.parserError("YIELD outside of a function")
+		return nil
+	}
+	p.yielded = true
+	if p.peekTokenMatch(token.NewLine, token.Eof, token.End) {
+		return expression
+	}
+	p.nextToken()
+	if expression.Value = p.parseExpression(Lowest); expression.Value == nil {
+		return nil
 	}
 	return expression
 }
@@ -650,7 +1114,7 @@ func (p *Parser) parseAssign(left ast.Expression) ast.Expression {
 		Operator: p.token.Literal,
 	}
 	switch identifier := left.(type) {
-	case *ast.Identifier:
+	case *ast.Identifier, *ast.ModuleAccess, *ast.FieldAccess:
 		expression.Name = identifier
 	case *ast.Subscript:
 		switch identifier.Left.(type) {
@@ -743,7 +1207,57 @@ func (p *Parser) parseAs(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parsePlaceHolder() ast.Expression {
-	return &ast.PlaceHolder{Token: p.token}
+	return p.parseTypePattern(&ast.PlaceHolder{Token: p.token})
+}
+
+func (p *Parser) parseTypePattern(name ast.Expression) ast.Expression {
+	if p.patterns == 0 || !p.peekTokenMatch(token.Colon) {
+		return name
+	}
+	p.nextToken()
+	expression := &ast.TypePattern{Token: p.token, Name: name}
+	if !p.peekTokenMatch(token.Identifier) {
+		p.parserError("Type pattern expects a type")
+		return nil
+	}
+	p.nextToken()
+	expression.Type = &ast.Identifier{Token: p.token, Value: p.token.Literal}
+	return expression
+}
+
+func (p *Parser) parseRestPattern() ast.Expression {
+	if p.patterns == 0 {
+		p.parserError(fmt.Sprintf("Unexpected expression '%s'", p.token.Literal))
+		return nil
+	}
+	expression := &ast.RestPattern{Token: p.token}
+	switch p.peekToken.Type {
+	case token.Identifier:
+		p.nextToken()
+		expression.Name = &ast.Identifier{Token: p.token, Value: p.token.Literal}
+	case token.Underscore:
+		p.nextToken()
+		expression.Name = &ast.PlaceHolder{Token: p.token}
+	}
+	return expression
+}
+
+func (p *Parser) parsePatterns() []ast.Expression {
+	p.patterns++
+	defer func() { p.patterns-- }()
+	var list []ast.Expression
+	for !p.matchToken(token.Then, token.If, token.NewLine, token.Eof) {
+		if !p.matchToken(token.Comma) {
+			elem := p.parseExpression(Lowest)
+			if elem == nil {
+				p.parserError(fmt.Sprintf("Unexpected '%s' in expression list", p.token.Literal))
+				return list
+			}
+			list = append(list, elem)
+		}
+		p.nextToken()
+	}
+	return list
 }
 
 func (p *Parser) parseSymbol() ast.Expression {
@@ -763,7 +1277,7 @@ func (p *Parser) parseDelimited(delimiter token.TType, end ...token.TType) []ast
 		switch p.token.Type {
 		case delimiter:
 		case token.NewLine, token.Eof:
-			p.parserError(fmt.Sprintf("Missing closing '%s' in parameter list", end))
+			p.parserError(fmt.Sprintf("Missing closing '%s' in parameter list", end[0]))
 			return list
 		default:
 			elem := p.parseExpression(Lowest)
@@ -781,13 +1295,23 @@ func (p *Parser) parseDelimited(delimiter token.TType, end ...token.TType) []ast
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	statement := &ast.ExpressionStatement{Token: p.token}
 	statement.Expression = p.parseExpression(Lowest)
+	if statement.Expression == nil {
+		statement.Expression = &ast.BadExpression{Token: statement.Token}
+	}
 	return statement
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixFunction[p.token.Type]
 	if prefix == nil {
-		p.parserError(fmt.Sprintf("Unexpected expression '%s'", p.token.Literal))
+		switch p.token.Type {
+		case token.NewLine:
+			p.parserError("Unexpected end of line, expecting an expression")
+		case token.Eof:
+			p.parserError("Unexpected end of file, expecting an expression")
+		default:
+			p.parserError(fmt.Sprintf("Unexpected expression '%s'", p.token.Literal))
+		}
 		return nil
 	}
 	left := prefix()
@@ -870,18 +1394,95 @@ func (p *Parser) parseBlockBody() *ast.BlockStatement {
 	return block
 }
 
-func (p *Parser) synchronize() {
-	for !p.matchToken(token.Eof) {
-		switch p.token.Type {
-		case token.Val, token.If, token.Repeat, token.Match, token.When,
-			token.Else, token.Return, token.Function, token.Module:
+func (p *Parser) parseBlockUntil(tokenType ...token.TType) *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.token}
+	block.Statements = []ast.Statement{}
+	p.nextToken()
+	for !p.matchToken(tokenType...) {
+		if statement := p.parseStatement(); statement != nil {
+			block.Statements = append(block.Statements, statement)
+		}
+		p.nextToken()
+	}
+	return block
+}
+
+func (p *Parser) openBlock() int {
+	p.open++
+	return p.indent
+}
+
+func (p *Parser) closeBlock(opener token.Token, indent int, msg string) bool {
+	p.open--
+	if p.matchToken(token.End) && (p.open == 0 || p.token.Position.Col >= indent) {
+		return true
+	}
+	diagnostic := rerror.Diagnostic{
+		Kind:    rerror.Parse,
+		File:    opener.Position.File,
+		Row:     opener.Position.Row,
+		Col:     opener.Position.Col,
+		Span:    len(opener.Literal),
+		Message: msg,
+	}
+	if p.matchToken(token.End) {
+		diagnostic.Related = &rerror.Note{
+			File:    p.token.Position.File,
+			Row:     p.token.Position.Row,
+			Col:     p.token.Position.Col,
+			Message: "This END is indented as closing an enclosing block",
+		}
+		p.unread()
+	}
+	p.report(diagnostic)
+	return false
+}
+
+func (p *Parser) recover(open int) {
+	depth := p.open - open
+	p.open = open
+	if depth == 0 {
+		switch {
+		case p.matchToken(token.NewLine, token.Eof):
+			return
+		case p.matchToken(token.End) && open > 0:
+			p.unread()
 			return
 		}
+	}
+	for !p.peekTokenMatch(token.Eof) {
+		switch p.peekToken.Type {
+		case token.NewLine:
+			if depth == 0 {
+				return
+			}
+		case token.If, token.Match, token.Repeat, token.Function, token.Module, token.Struct, token.Enum, token.Try, token.Select:
+			depth++
+		case token.End:
+			if depth == 0 {
+				return
+			}
+			depth--
+		}
 		p.nextToken()
 	}
 }
 
 func (p *Parser) parserError(msg string) {
-	rerror.Error(rerror.Parse, p.token.Position, msg)
-	p.synchronize()
+	p.report(rerror.Diagnostic{
+		Kind:    rerror.Parse,
+		File:    p.token.Position.File,
+		Row:     p.token.Position.Row,
+		Col:     p.token.Position.Col,
+		Span:    len(p.token.Literal),
+		Message: msg,
+	})
+}
+
+func (p *Parser) report(diagnostic rerror.Diagnostic) {
+	if p.recovering {
+		return
+	}
+	p.recovering = true
+	p.diagnostics.Add(diagnostic)
 }
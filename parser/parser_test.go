@@ -4,9 +4,11 @@
 package parser
 
 import (
+	"fmt"
 	"github.com/luiscm/oro/ast"
 	"github.com/luiscm/oro/lexer"
 	"github.com/luiscm/oro/rerror"
+	"strings"
 	"testing"
 )
 
@@ -19,10 +21,10 @@ func TestString(t *testing.T) {
 		{`"second test"`, "second test"},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := New(lex)
 		program := parse.Parse()
-		checkParserErrors(t)
+		checkParserErrors(t, parse)
 		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 		if !ok {
 			t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -46,10 +48,10 @@ func TestInteger(t *testing.T) {
 		{`12345`, 12345},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := New(lex)
 		program := parse.Parse()
-		checkParserErrors(t)
+		checkParserErrors(t, parse)
 		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 		if !ok {
 			t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -73,10 +75,10 @@ func TestFloat(t *testing.T) {
 		{`1050.23488`, 1050.23488},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := New(lex)
 		program := parse.Parse()
-		checkParserErrors(t)
+		checkParserErrors(t, parse)
 		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 		if !ok {
 			t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -100,10 +102,10 @@ func TestBoolean(t *testing.T) {
 		{`false`, false},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := New(lex)
 		program := parse.Parse()
-		checkParserErrors(t)
+		checkParserErrors(t, parse)
 		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 		if !ok {
 			t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -128,10 +130,10 @@ func TestArray(t *testing.T) {
 		{`[]`, 0},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := New(lex)
 		program := parse.Parse()
-		checkParserErrors(t)
+		checkParserErrors(t, parse)
 		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 		if !ok {
 			t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -155,10 +157,10 @@ func TestDictionary(t *testing.T) {
 		{`["a" => "b", "c" => 2, "d" => 10]`, 3},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := New(lex)
 		program := parse.Parse()
-		checkParserErrors(t)
+		checkParserErrors(t, parse)
 		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 		if !ok {
 			t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -182,10 +184,10 @@ func TestVar(t *testing.T) {
 		{`var two = 2`, 2},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := New(lex)
 		program := parse.Parse()
-		checkParserErrors(t)
+		checkParserErrors(t, parse)
 		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 		if !ok {
 			t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -209,10 +211,10 @@ func TestVal(t *testing.T) {
 		{`val second = 10 + 2`, "second"},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := New(lex)
 		program := parse.Parse()
-		checkParserErrors(t)
+		checkParserErrors(t, parse)
 		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 		if !ok {
 			t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -227,16 +229,38 @@ func TestVal(t *testing.T) {
 	}
 }
 
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`val [a, b, ...rest] = arr`, "val Array(a, b, ...rest) = arr"},
+		{`var [first, [x, _]] = arr`, "var Array(first, Array(x, )) = arr"},
+		{`val [:name => n: String] = user`, "val [:name => n: String] = user"},
+		{"repeat [k, v] in pairs\n  k\nend", "repeat (Array(k, v) in pairs) -> k"},
+		{"repeat i, [k, v] in pairs\n  k\nend", "repeat (i, Array(k, v) in pairs) -> k"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := New(lex)
+		program := parse.Parse()
+		checkParserErrors(t, parse)
+		if actual := program.Statements[0].Check(); actual != test.expected {
+			t.Errorf("Expected %s but got %s", test.expected, actual)
+		}
+	}
+}
+
 func TestIf(t *testing.T) {
 	input := `if a == 1
   a + 2
 else
   a + 3
 end`
-	lex := lexer.New([]byte(input))
+	lex := lexer.New("", []byte(input))
 	parse := New(lex)
 	program := parse.Parse()
-	checkParserErrors(t)
+	checkParserErrors(t, parse)
 	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
 		t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -260,10 +284,10 @@ func TestRepeat(t *testing.T) {
 	input := `repeat a, b in arr
   a + 1
 end`
-	lex := lexer.New([]byte(input))
+	lex := lexer.New("", []byte(input))
 	parse := New(lex)
 	program := parse.Parse()
-	checkParserErrors(t)
+	checkParserErrors(t, parse)
 	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
 		t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -283,6 +307,40 @@ end`
 	}
 }
 
+func TestTry(t *testing.T) {
+	input := `try
+  a + 1
+rescue err
+  err
+ensure
+  b
+end`
+	lex := lexer.New("", []byte(input))
+	parse := New(lex)
+	program := parse.Parse()
+	checkParserErrors(t, parse)
+	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
+	}
+	literal, ok := statement.Expression.(*ast.Try)
+	if !ok {
+		t.Fatalf("Expected an ast.Try but got %T", statement.Expression)
+	}
+	if len(literal.Body.Statements) != 1 {
+		t.Errorf("Expected %d statement in body but got %d", 1, len(literal.Body.Statements))
+	}
+	if literal.Error == nil || literal.Error.Value != "err" {
+		t.Errorf("Expected the error to be bound to %s but got %v", "err", literal.Error)
+	}
+	if len(literal.Rescue.Statements) != 1 {
+		t.Errorf("Expected %d statement in RESCUE block but got %d", 1, len(literal.Rescue.Statements))
+	}
+	if len(literal.Ensure.Statements) != 1 {
+		t.Errorf("Expected %d statement in ENSURE block but got %d", 1, len(literal.Ensure.Statements))
+	}
+}
+
 func TestMatch(t *testing.T) {
 	input := `match a
 when 1
@@ -292,10 +350,10 @@ when 2
 else
   a + 3
 end`
-	lex := lexer.New([]byte(input))
+	lex := lexer.New("", []byte(input))
 	parse := New(lex)
 	program := parse.Parse()
-	checkParserErrors(t)
+	checkParserErrors(t, parse)
 	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
 		t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -327,10 +385,10 @@ func TestModule(t *testing.T) {
     x + y
   end
 end`
-	lex := lexer.New([]byte(input))
+	lex := lexer.New("", []byte(input))
 	parse := New(lex)
 	program := parse.Parse()
-	checkParserErrors(t)
+	checkParserErrors(t, parse)
 	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
 		t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -352,10 +410,10 @@ func TestFunction(t *testing.T) {
   x + y
   z + x
 end`
-	lex := lexer.New([]byte(input))
+	lex := lexer.New("", []byte(input))
 	parse := New(lex)
 	program := parse.Parse()
-	checkParserErrors(t)
+	checkParserErrors(t, parse)
 	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
 		t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -372,12 +430,225 @@ end`
 	}
 }
 
+func TestGenerator(t *testing.T) {
+	tests := []struct {
+		input     string
+		generator bool
+		expected  string
+	}{
+		{"fn n\n  yield n\n  yield\nend", true, "yield n"},
+		{"(x) -> yield x * 2", true, "yield (x * 2)"},
+		{"fn n\n  val f = fn\n    yield n\n  end\nend", false, "val f = fn () yield n"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := New(lex)
+		program := parse.Parse()
+		checkParserErrors(t, parse)
+		literal, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.Function)
+		if !ok {
+			t.Errorf("Expected an ast.Function but got %T", program.Statements[0])
+			continue
+		}
+		if literal.Generator != test.generator {
+			t.Errorf("Expected generator %t but got %t", test.generator, literal.Generator)
+		}
+		if actual := literal.Body.Statements[0].Check(); actual != test.expected {
+			t.Errorf("Expected %s but got %s", test.expected, actual)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []bool
+	}{
+		{"fn n\n  f(n)\nend", []bool{true}},
+		{"fn n\n  f(n)\n  g(n)\nend", []bool{false, true}},
+		{"(x) -> f(x)", []bool{true}},
+		{"fn n\n  1 + f(n)\nend", []bool{false}},
+		{"fn n\n  return f(n)\n  g(n)\nend", []bool{true, true}},
+		{"fn n\n  if n then f(n) else g(n) end\n  h(n)\nend", []bool{false, false, true}},
+		{"fn n\n  if n\n    return f(n)\n  end\n  g(n)\nend", []bool{true, true}},
+		{"fn n\n  try\n    return f(n)\n  rescue e\n    g(n)\n  end\nend", []bool{false, false}},
+		{"fn n\n  yield f(n)\nend", []bool{false}},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := New(lex)
+		program := parse.Parse()
+		checkParserErrors(t, parse)
+		literal := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.Function)
+		actual := tailCalls(literal.Body)
+		if fmt.Sprint(actual) != fmt.Sprint(test.expected) {
+			t.Errorf("Expected tail calls %v but got %v in %q", test.expected, actual, test.input)
+		}
+	}
+}
+
+// tailCalls lists in order whether the calls of a function body are tail
+// calls.
+func tailCalls(node ast.Node) []bool {
+	var calls []bool
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			calls = append(calls, tailCalls(statement)...)
+		}
+	case *ast.ExpressionStatement:
+		calls = tailCalls(node.Expression)
+	case *ast.Return:
+		calls = tailCalls(node.Value)
+	case *ast.Yield:
+		calls = tailCalls(node.Value)
+	case *ast.InfixExpression:
+		calls = append(tailCalls(node.Left), tailCalls(node.Right)...)
+	case *ast.If:
+		calls = tailCalls(node.Then)
+		if node.Else != nil {
+			calls = append(calls, tailCalls(node.Else)...)
+		}
+	case *ast.Try:
+		calls = append(tailCalls(node.Body), tailCalls(node.Rescue)...)
+	case *ast.FunctionCall:
+		calls = []bool{node.Tail}
+	}
+	return calls
+}
+
+func TestTasks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"spawn fn\n  1\nend", "spawn fn () 1"},
+		{"await task", "await task"},
+		{"await spawn work", "await spawn work"},
+		{"val v = await task + 1", "val v = (await task + 1)"},
+		{"select\n  when v = jobs.receive() then v\n  when done.receive() then 0\n  when out.send(x * 2) then 1\n  else then 2\nend",
+			"select when v = jobs.receive() then v when done.receive() then 0 when out.send((x * 2)) then 1 else then 2"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := New(lex)
+		program := parse.Parse()
+		checkParserErrors(t, parse)
+		if actual := program.Statements[0].Check(); actual != test.expected {
+			t.Errorf("Expected %s but got %s", test.expected, actual)
+		}
+	}
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		input  string
+		fields string
+	}{
+		{"struct Point x: Float, y: Float end", "x: Float, y: Float"},
+		{"struct User\n  name: String\n  tags\nend", "name: String, tags"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := New(lex)
+		program := parse.Parse()
+		checkParserErrors(t, parse)
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := statement.Expression.(*ast.Struct)
+		if !ok {
+			t.Fatalf("Expected an ast.Struct but got %T", statement.Expression)
+		}
+		var fields []string
+		for _, field := range literal.Fields {
+			fields = append(fields, field.Check())
+		}
+		if actual := strings.Join(fields, ", "); actual != test.fields {
+			t.Errorf("Expected fields %s but got %s", test.fields, actual)
+		}
+	}
+}
+
+func TestEnum(t *testing.T) {
+	tests := []struct {
+		input    string
+		variants string
+	}{
+		{"enum Color Red, Green, Blue end", "Red, Green, Blue"},
+		{"enum Shape\n  Circle(r: Float)\n  Rect(w, h)\n  Empty\nend", "Circle(r: Float), Rect(w, h), Empty"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := New(lex)
+		program := parse.Parse()
+		checkParserErrors(t, parse)
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := statement.Expression.(*ast.Enum)
+		if !ok {
+			t.Fatalf("Expected an ast.Enum but got %T", statement.Expression)
+		}
+		var variants []string
+		for _, variant := range literal.Variants {
+			variants = append(variants, variant.Check())
+		}
+		if actual := strings.Join(variants, ", "); actual != test.variants {
+			t.Errorf("Expected variants %s but got %s", test.variants, actual)
+		}
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match x\nwhen [first, ...rest] then first\nend", "when Array(first, ...rest) then first"},
+		{"match x\nwhen [[a, _], ...] then a\nend", "when Array(Array(a, ), ...) then a"},
+		{"match x\nwhen n: Integer, s: String then 1\nend", "when n: Integer, s: String then 1"},
+		{"match x\nwhen n: Integer if n > 0 then n\nend", "when n: Integer if (n > 0) then n"},
+		{"match x\nwhen 1..9\n  x\nend", "when (1 .. 9) then x"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := New(lex)
+		program := parse.Parse()
+		checkParserErrors(t, parse)
+		statement := program.Statements[0].(*ast.ExpressionStatement)
+		match, ok := statement.Expression.(*ast.Match)
+		if !ok {
+			t.Fatalf("Expected an ast.Match but got %T", statement.Expression)
+		}
+		if actual := match.Whens[0].Check(); actual != test.expected {
+			t.Errorf("Expected %s but got %s", test.expected, actual)
+		}
+	}
+}
+
+func TestFieldAccess(t *testing.T) {
+	input := `line.start.x = 1`
+	lex := lexer.New("", []byte(input))
+	parse := New(lex)
+	program := parse.Parse()
+	checkParserErrors(t, parse)
+	statement := program.Statements[0].(*ast.ExpressionStatement)
+	assign, ok := statement.Expression.(*ast.Assign)
+	if !ok {
+		t.Fatalf("Expected an ast.Assign but got %T", statement.Expression)
+	}
+	field, ok := assign.Name.(*ast.FieldAccess)
+	if !ok {
+		t.Fatalf("Expected an ast.FieldAccess but got %T", assign.Name)
+	}
+	if _, ok := field.Object.(*ast.ModuleAccess); !ok || field.Field.Value != "x" {
+		t.Errorf("Expected %s but got %s", "line.start.x", field.Check())
+	}
+}
+
 func TestModuleAccess(t *testing.T) {
 	input := `Math.pi`
-	lex := lexer.New([]byte(input))
+	lex := lexer.New("", []byte(input))
 	parse := New(lex)
 	program := parse.Parse()
-	checkParserErrors(t)
+	checkParserErrors(t, parse)
 	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
 		t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -396,10 +667,10 @@ func TestModuleAccess(t *testing.T) {
 
 func TestFunctionCall(t *testing.T) {
 	input := `myfn (1, 2)`
-	lex := lexer.New([]byte(input))
+	lex := lexer.New("", []byte(input))
 	parse := New(lex)
 	program := parse.Parse()
-	checkParserErrors(t)
+	checkParserErrors(t, parse)
 	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
 		t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -422,10 +693,10 @@ func TestFunctionCall(t *testing.T) {
 
 func TestSubscript(t *testing.T) {
 	input := `arr[1]`
-	lex := lexer.New([]byte(input))
+	lex := lexer.New("", []byte(input))
 	parse := New(lex)
 	program := parse.Parse()
-	checkParserErrors(t)
+	checkParserErrors(t, parse)
 	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
 	if !ok {
 		t.Errorf("Expected an ast.ExpressionStatement but got %T", program.Statements[0])
@@ -579,12 +850,20 @@ func TestOperatorPrecedence(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"0..<n - 1 step k * 2",
+			"((0 ..< (n - 1)) step (k * 2))",
+		},
+		{
+			"x in 1..10 == true",
+			"((x in (1 .. 10)) == true)",
+		},
 	}
 	for _, test := range tests {
-		lex := lexer.New([]byte(test.input))
+		lex := lexer.New("", []byte(test.input))
 		parse := New(lex)
 		program := parse.Parse()
-		checkParserErrors(t)
+		checkParserErrors(t, parse)
 		actual := program.Check()
 		if actual != test.expected {
 			t.Errorf("Expected %s but got %s", test.expected, actual)
@@ -592,11 +871,160 @@ func TestOperatorPrecedence(t *testing.T) {
 	}
 }
 
-func checkParserErrors(t *testing.T) {
-	if rerror.HasErrors() {
-		t.Errorf(rerror.ParseErrors)
-		for _, e := range rerror.GetErrors() {
-			t.Errorf(e)
+func TestStringInterpolation(t *testing.T) {
+	input := `"Hello #{user[:name]}, you are #{age + 1}"`
+	lex := lexer.New("", []byte(input))
+	parse := New(lex)
+	program := parse.Parse()
+	checkParserErrors(t, parse)
+	statement := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := statement.Expression.(*ast.String)
+	if !ok {
+		t.Fatalf("Expected an ast.String but got %T", statement.Expression)
+	}
+	if _, ok := literal.Interpolated["#{user[:name]}"].(*ast.Subscript); !ok {
+		t.Errorf("Expected an ast.Subscript but got %T", literal.Interpolated["#{user[:name]}"])
+	}
+	infix, ok := literal.Interpolated["#{age + 1}"].(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("Expected an ast.InfixExpression but got %T", literal.Interpolated["#{age + 1}"])
+	}
+	if position := infix.Left.TokenPosition(); position.Row != 1 || position.Col != 34 {
+		t.Errorf("Expected %s at %d:%d but got %d:%d", "age", 1, 34, position.Row, position.Col)
+	}
+}
+
+func TestStringInterpolationErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		col     int
+		message string
+	}{
+		{`"a #{}"`, 4, "Empty expression in string interpolation"},
+		{`"a #{b c}"`, 8, "Unexpected 'c' in string interpolation"},
+		{`"a #{b +}"`, 9, "Unexpected end of file, expecting an expression"},
+		{`"a #{b"`, 4, "Unterminated string interpolation"},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := New(lex)
+		parse.Parse()
+		errors := parse.Diagnostics().Errors()
+		if len(errors) == 0 {
+			t.Errorf("Expected %q but got no errors", test.message)
+			continue
+		}
+		if errors[0].Col != test.col || errors[0].Message != test.message {
+			t.Errorf("Expected %q at %d but got %q at %d", test.message, test.col, errors[0].Message, errors[0].Col)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	type position struct {
+		row     int
+		col     int
+		message string
+	}
+	tests := []struct {
+		input    string
+		expected []position
+	}{
+		{"val = 1\nval b = 2\nval = 3", []position{
+			{1, 1, "VAL expects an identifier"},
+			{3, 1, "VAL expects an identifier"},
+		}},
+		{"val f = fn (1)\n  if true\n    1\n  end\nend\nval = 2", []position{
+			{1, 13, "Unexpected token 'INTEGER' as function parameter"},
+			{6, 1, "VAL expects an identifier"},
+		}},
+		{"module A\n  val f = fn x\n    if x\n      1\n  end\nend\nval x = [1", []position{
+			{3, 5, "Missing END closing statement in IF"},
+			{7, 11, "Missing closing ']' in enumerable"},
+		}},
+		{"repeat i in 1..2\n  val = i\n  val b = (i\nend\nend", []position{
+			{2, 3, "VAL expects an identifier"},
+			{3, 12, "Missing closing ')' for grouped expression"},
+			{5, 1, "END without a matching block"},
+		}},
+		{"struct P x, x end\nstruct Q\n  y: \nend", []position{
+			{1, 13, "Field 'x' declared twice in STRUCT"},
+			{3, 4, "Struct field 'y' expecting a types"},
+		}},
+		{"enum E A, A(x) end\nenum F\n  B(y, y)\nend\nenum G C() end\nenum H D(z end", []position{
+			{1, 11, "Variant 'A' declared twice in ENUM"},
+			{3, 8, "Field 'y' declared twice in variant B"},
+			{5, 10, "Empty payload in variant 'C'"},
+			{6, 12, "Unexpected token 'end' as variant field"},
+		}},
+		{"match x\nwhen n: 1 then n\nwhen y if then y\nend\nval r = [...rest]", []position{
+			{2, 7, "Type pattern expects a type"},
+			{5, 10, "Unexpected expression '...'"},
+		}},
+		{"val [a, b\nrepeat [k], v in b\n  k\nend", []position{
+			{1, 10, "Missing closing ']' in enumerable"},
+			{2, 10, "Destructuring pattern in REPEAT loop should be the last argument"},
+		}},
+		{"select\n  when ch.close() then 1\nend\nval a = select\n  when v = ch.receive() v\nend", []position{
+			{2, 17, "SELECT WHEN expects a receive() or a send(value) on a channel"},
+			{5, 25, "Missing THEN in SELECT WHEN"},
+		}},
+		{"yield 1\nval f = fn x\n  yield x +\nend", []position{
+			{1, 1, "YIELD outside of a function"},
+			{3, 12, "Unexpected end of line, expecting an expression"},
+		}},
+		{"val a = 1 +\nval f = fn x\n  x", []position{
+			{1, 12, "Unexpected end of line, expecting an expression"},
+			{2, 9, "Missing END statement in function"},
+		}},
+	}
+	for _, test := range tests {
+		lex := lexer.New("", []byte(test.input))
+		parse := New(lex)
+		parse.Parse()
+		errors := parse.Diagnostics().Errors()
+		if len(errors) != len(test.expected) {
+			t.Errorf("Expected %d errors but got %v", len(test.expected), errors)
+			continue
+		}
+		for idx, expected := range test.expected {
+			if errors[idx].Row != expected.row || errors[idx].Col != expected.col || errors[idx].Message != expected.message {
+				t.Errorf("Expected %q at %d:%d but got %q at %d:%d", expected.message, expected.row, expected.col,
+					errors[idx].Message, errors[idx].Row, errors[idx].Col)
+			}
+		}
+	}
+}
+
+func TestPartialProgram(t *testing.T) {
+	input := "val a = 1\nval = 2\nval b = 3"
+	lex := lexer.New("", []byte(input))
+	program := New(lex).Parse()
+	if len(program.Statements) != 3 {
+		t.Fatalf("Expected %d statements but got %d", 3, len(program.Statements))
+	}
+	statement, ok := program.Statements[1].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Expected an ast.ExpressionStatement but got %T", program.Statements[1])
+	}
+	if _, ok := statement.Expression.(*ast.BadExpression); !ok {
+		t.Errorf("Expected an ast.BadExpression but got %T", statement.Expression)
+	}
+	statement, ok = program.Statements[2].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Expected an ast.ExpressionStatement but got %T", program.Statements[2])
+	}
+	if val, ok := statement.Expression.(*ast.Val); !ok || val.Name.Value != "b" {
+		t.Errorf("Expected VAL %s but got %s", "b", statement.Expression.Check())
+	}
+}
+
+func checkParserErrors(t *testing.T, parse *Parser) {
+	diagnostics := parse.Diagnostics()
+	if diagnostics.HasErrors() {
+		t.Errorf("%s", rerror.ParseErrors)
+		for _, e := range diagnostics.Errors() {
+			t.Errorf("%s", e)
 		}
 	}
 }
@@ -18,6 +18,7 @@ const (
 	Boolean
 	Bitwise
 	Comparison
+	Step
 	Range
 	BitShift
 	Sum
@@ -58,6 +59,9 @@ var precedences = map[token.TType]int{
 	token.BitShiftLeft:    BitShift,
 	token.BitShiftRight:   BitShift,
 	token.Range:           Range,
+	token.RangeExclusive:  Range,
+	token.Step:            Step,
+	token.In:              Comparison,
 	token.Pipe:            Pipe,
 	token.Arrow:           Arrow,
 	token.QuestionMark:    Ternary,
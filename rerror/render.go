@@ -0,0 +1,164 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package rerror implements functions to render errors.
+package rerror
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+type SourceLoader func(file string) ([]byte, bool)
+
+func FileLoader(file string) ([]byte, bool) {
+	if file == "" {
+		return nil, false
+	}
+	source, err := ioutil.ReadFile(file)
+	return source, err == nil
+}
+
+type Renderer interface {
+	Render(w io.Writer, diagnostics []Diagnostic) error
+}
+
+type printer func(io.Writer, string, ...interface{}) (int, error)
+
+type TextRenderer struct {
+	Source SourceLoader
+}
+
+func (r TextRenderer) Render(w io.Writer, diagnostics []Diagnostic) error {
+	for _, d := range diagnostics {
+		if _, err := fmt.Fprintln(w, d.String()); err != nil {
+			return err
+		}
+		if err := renderDetails(w, d, r.Source, fmt.Fprintf, fmt.Fprintf, fmt.Fprintf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type ColorRenderer struct {
+	Source SourceLoader
+}
+
+func (r ColorRenderer) Render(w io.Writer, diagnostics []Diagnostic) error {
+	if _, err := color.New(color.FgWhite).Fprintln(w, FoundErrors); err != nil {
+		return err
+	}
+	red := color.New(color.FgRed)
+	for _, d := range diagnostics {
+		if _, err := red.Fprintln(w, d.String()); err != nil {
+			return err
+		}
+		if err := renderDetails(w, d, r.Source, red.Fprintf, color.New(color.FgYellow).Fprintf, color.New(color.FgHiBlack).Fprintf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type JSONRenderer struct{}
+
+func (r JSONRenderer) Render(w io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
+
+func renderDetails(w io.Writer, d Diagnostic, source SourceLoader, caret, note, trace printer) error {
+	if err := renderSnippet(w, d, source, caret); err != nil {
+		return err
+	}
+	if d.Hint != "" {
+		if _, err := note(w, HintLine+"\n", d.Hint); err != nil {
+			return err
+		}
+	}
+	if d.Related != nil {
+		if _, err := note(w, "%s\n", d.Related.String()); err != nil {
+			return err
+		}
+	}
+	return renderTrace(w, d.Trace, trace)
+}
+
+func renderSnippet(w io.Writer, d Diagnostic, source SourceLoader, printf printer) error {
+	line, ok := sourceLine(d, source)
+	if !ok {
+		return nil
+	}
+	col := d.Col
+	if col < 1 {
+		col = 1
+	}
+	if col > len(line)+1 {
+		col = len(line) + 1
+	}
+	span := d.Span
+	if span < 1 {
+		span = 1
+	}
+	if rest := len(line) - col + 1; span > rest && rest > 0 {
+		span = rest
+	}
+	var padding strings.Builder
+	for _, chr := range line[:col-1] {
+		if chr == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+	gutter := fmt.Sprintf("%d", d.Row)
+	if _, err := fmt.Fprintf(w, "  %s | %s\n", gutter, line); err != nil {
+		return err
+	}
+	_, err := printf(w, "  %s | %s%s\n", strings.Repeat(" ", len(gutter)), padding.String(), strings.Repeat("^", span))
+	return err
+}
+
+func sourceLine(d Diagnostic, source SourceLoader) (string, bool) {
+	if source == nil || d.Row < 1 {
+		return "", false
+	}
+	buffer, ok := source(d.File)
+	if !ok {
+		return "", false
+	}
+	lines := strings.Split(string(buffer), "\n")
+	if d.Row > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[d.Row-1], "\r"), true
+}
+
+func renderTrace(w io.Writer, trace []Frame, printf printer) error {
+	if len(trace) < 2 {
+		return nil
+	}
+	if _, err := printf(w, TraceHeader+"\n"); err != nil {
+		return err
+	}
+	for _, f := range trace {
+		if _, err := printf(w, TraceLine+"\n", f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func PrintErrors(diagnostics []Diagnostic, source SourceLoader) {
+	ColorRenderer{Source: source}.Render(color.Output, diagnostics)
+}
@@ -6,46 +6,197 @@ package rerror
 
 import (
 	"fmt"
-	"github.com/fatih/color"
 	"github.com/luiscm/oro/token"
+	"sort"
 )
 
 type TError string
 
 const (
-	FoundErrors        = "Found Errors:"
-	ErrorLine          = "%s [Line %d:%d]: %s"
-	ParseErrors        = "Parse Errors: "
-	Parse       TError = "Parse Error"
-	Runtime     TError = "Runtime Error"
+	FoundErrors          = "Found Errors:"
+	ErrorLine            = "%s [Line %d:%d]: %s"
+	FileErrorLine        = "%s: %s: %s"
+	BareErrorLine        = "%s: %s"
+	NoteLine             = "  Note [Line %d:%d]: %s"
+	FileNoteLine         = "  Note %s: %s"
+	TraceHeader          = "  Traceback, most recent call first:"
+	TraceLine            = "    at %s"
+	HintLine             = "  Hint: %s"
+	SuggestHint          = "did you mean `%s`?"
+	ParseErrors          = "Parse Errors: "
+	Parse         TError = "Parse Error"
+	Runtime       TError = "Runtime Error"
+	Type          TError = "Type Error"
+	Limit         TError = "Limit Error"
+	Resolve       TError = "Resolve Error"
 )
 
-var errors []string
+type Note struct {
+	File    string `json:"file"`
+	Row     int    `json:"line"`
+	Col     int    `json:"column"`
+	Message string `json:"message"`
+}
 
-func Error(terror TError, location token.Position, msg string) {
-	errors = append(errors, fmt.Sprintf(ErrorLine, terror, location.Row, location.Col, msg))
+type Frame struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Row  int    `json:"line"`
+	Col  int    `json:"column"`
 }
 
-func ErrorFmt(msg string, a ...interface{}) error {
-	return fmt.Errorf(msg, a...)
+func (f Frame) String() string {
+	switch {
+	case f.Row == 0 && f.File == "":
+		return f.Name
+	case f.Row == 0:
+		return fmt.Sprintf("%s (%s)", f.Name, f.File)
+	case f.File == "":
+		return fmt.Sprintf("%s [Line %d:%d]", f.Name, f.Row, f.Col)
+	}
+	return fmt.Sprintf("%s (%s)", f.Name, Location(f.File, f.Row, f.Col))
+}
+
+type Diagnostic struct {
+	Kind    TError  `json:"kind"`
+	File    string  `json:"file"`
+	Row     int     `json:"line"`
+	Col     int     `json:"column"`
+	Span    int     `json:"span"`
+	Message string  `json:"message"`
+	Hint    string  `json:"hint,omitempty"`
+	Related *Note   `json:"related,omitempty"`
+	Trace   []Frame `json:"trace,omitempty"`
 }
 
-func PrintErrors() {
-	color.White(FoundErrors)
-	for _, e := range GetErrors() {
-		color.Red(e)
+func (d Diagnostic) String() string {
+	switch {
+	case d.Row == 0 && d.File == "":
+		return fmt.Sprintf(BareErrorLine, d.Kind, d.Message)
+	case d.Row == 0:
+		return fmt.Sprintf(FileErrorLine, d.File, d.Kind, d.Message)
+	case d.File == "":
+		return fmt.Sprintf(ErrorLine, d.Kind, d.Row, d.Col, d.Message)
 	}
-	ClearErrors()
+	return fmt.Sprintf(FileErrorLine, Location(d.File, d.Row, d.Col), d.Kind, d.Message)
+}
+
+func (n Note) String() string {
+	if n.File == "" {
+		return fmt.Sprintf(NoteLine, n.Row, n.Col, n.Message)
+	}
+	return fmt.Sprintf(FileNoteLine, Location(n.File, n.Row, n.Col), n.Message)
+}
+
+func Location(file string, row, col int) string {
+	return fmt.Sprintf("%s:%d:%d", file, row, col)
 }
 
-func HasErrors() bool {
-	return len(errors) > 0
+type Diagnostics struct {
+	list []Diagnostic
 }
 
-func GetErrors() []string {
-	return errors
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{}
 }
 
-func ClearErrors() {
-	errors = []string{}
+func (d *Diagnostics) Error(terror TError, location token.Position, span int, msg string) {
+	d.Add(Diagnostic{
+		Kind:    terror,
+		File:    location.File,
+		Row:     location.Row,
+		Col:     location.Col,
+		Span:    span,
+		Message: msg,
+	})
+}
+
+func (d *Diagnostics) Add(diagnostic Diagnostic) {
+	if diagnostic.Span < 1 {
+		diagnostic.Span = 1
+	}
+	d.list = append(d.list, diagnostic)
+}
+
+func (d *Diagnostics) Merge(other *Diagnostics) {
+	d.list = append(d.list, other.list...)
+}
+
+func (d *Diagnostics) HasErrors() bool {
+	return len(d.list) > 0
+}
+
+func (d *Diagnostics) Len() int {
+	return len(d.list)
+}
+
+func (d *Diagnostics) Errors() []Diagnostic {
+	return d.list
+}
+
+func (d *Diagnostics) Clear() {
+	d.list = nil
+}
+
+func (d *Diagnostics) Truncate(n int) {
+	if n < len(d.list) {
+		d.list = d.list[:n]
+	}
+}
+
+func (d *Diagnostics) Sorted() *Diagnostics {
+	list := append([]Diagnostic{}, d.list...)
+	sort.SliceStable(list, func(a, b int) bool {
+		if list[a].File != list[b].File {
+			return list[a].File < list[b].File
+		}
+		if list[a].Row != list[b].Row {
+			return list[a].Row < list[b].Row
+		}
+		return list[a].Col < list[b].Col
+	})
+	return &Diagnostics{list: list}
+}
+
+func Suggest(name string, candidates []string) string {
+	best := ""
+	bestDistance := len(name)/3 + 2
+	for _, candidate := range candidates {
+		distance := levenshtein(name, candidate)
+		if distance == 0 || distance >= len(name) {
+			continue
+		}
+		if distance < bestDistance || (distance == bestDistance && candidate < best) {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(SuggestHint, best)
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func ErrorFmt(msg string, a ...interface{}) error {
+	return fmt.Errorf(msg, a...)
 }
@@ -4,41 +4,209 @@
 package rerror
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/luiscm/oro/token"
+	"reflect"
 	"testing"
 )
 
 func TestError(t *testing.T) {
-	errors = []string{}
-	Error(Parse, token.Position{1, 1}, "Test error 1")
-	Error(Parse, token.Position{1, 1}, "Test error 2")
-	if len(errors) != 2 {
-		t.Errorf("Expected %d but got %d", 2, len(errors))
+	diagnostics := NewDiagnostics()
+	diagnostics.Error(Parse, token.Position{Row: 1, Col: 1}, 1, "Test error 1")
+	diagnostics.Error(Parse, token.Position{Row: 1, Col: 1}, 1, "Test error 2")
+	if diagnostics.Len() != 2 {
+		t.Errorf("Expected %d but got %d", 2, diagnostics.Len())
 	}
 }
 
 func TestGetErrors(t *testing.T) {
-	errors = []string{}
-	Error(Parse, token.Position{1, 1}, "Test error 1")
-	Error(Runtime, token.Position{2, 1}, "Test error 2")
+	diagnostics := NewDiagnostics()
+	diagnostics.Error(Parse, token.Position{Row: 1, Col: 1}, 1, "Test error 1")
+	diagnostics.Error(Runtime, token.Position{Row: 2, Col: 1}, 1, "Test error 2")
 	expected := []string{
 		fmt.Sprintf("%s [Line %d:%d]: %s", Parse, 1, 1, "Test error 1"),
 		fmt.Sprintf("%s [Line %d:%d]: %s", Runtime, 2, 1, "Test error 2"),
 	}
-	for i, k := range errors {
-		if k != expected[i] {
+	for i, k := range diagnostics.Errors() {
+		if k.String() != expected[i] {
 			t.Errorf("Expected %s but got %s", expected[i], k)
 		}
 	}
 }
 
 func TestClearErrors(t *testing.T) {
-	errors = []string{}
-	Error(Parse, token.Position{1, 1}, "Test error 1")
-	Error(Parse, token.Position{1, 1}, "Test error 2")
-	ClearErrors()
-	if len(errors) != 0 {
-		t.Errorf("Expected %d but got %d", 0, len(errors))
+	diagnostics := NewDiagnostics()
+	diagnostics.Error(Parse, token.Position{Row: 1, Col: 1}, 1, "Test error 1")
+	diagnostics.Error(Parse, token.Position{Row: 1, Col: 1}, 1, "Test error 2")
+	diagnostics.Clear()
+	if diagnostics.HasErrors() {
+		t.Errorf("Expected %d but got %d", 0, diagnostics.Len())
+	}
+}
+
+func TestSortedErrors(t *testing.T) {
+	diagnostics := NewDiagnostics()
+	diagnostics.Error(Runtime, token.Position{Row: 3, Col: 2}, 1, "Third")
+	diagnostics.Error(Parse, token.Position{Row: 1, Col: 5}, 0, "First")
+	diagnostics.Error(Parse, token.Position{Row: 3, Col: 1}, 2, "Second")
+	expected := []string{"First", "Second", "Third"}
+	for i, k := range diagnostics.Sorted().Errors() {
+		if k.Message != expected[i] {
+			t.Errorf("Expected %s but got %s", expected[i], k.Message)
+		}
+		if k.Span < 1 {
+			t.Errorf("Expected a span of at least %d but got %d", 1, k.Span)
+		}
+	}
+}
+
+func TestTextRenderer(t *testing.T) {
+	diagnostics := NewDiagnostics()
+	diagnostics.Add(Diagnostic{
+		Kind:    Runtime,
+		Row:     4,
+		Col:     1,
+		Message: "Module 'A' redeclared",
+		Related: &Note{Row: 1, Col: 1, Message: "First declared here"},
+	})
+	var out bytes.Buffer
+	if err := (TextRenderer{}).Render(&out, diagnostics.Errors()); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	expected := "Runtime Error [Line 4:1]: Module 'A' redeclared\n  Note [Line 1:1]: First declared here\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q but got %q", expected, out.String())
+	}
+}
+
+func TestTextRendererTrace(t *testing.T) {
+	diagnostics := NewDiagnostics()
+	diagnostics.Add(Diagnostic{
+		Kind:    Runtime,
+		File:    "<stdlib:Enum>",
+		Row:     2,
+		Col:     3,
+		Message: "Failed",
+		Trace: []Frame{
+			{Name: "Enum.map", File: "<stdlib:Enum>", Row: 2, Col: 3},
+			{Name: "<main>", File: "main.oro", Row: 5, Col: 1},
+		},
+	})
+	var out bytes.Buffer
+	if err := (TextRenderer{}).Render(&out, diagnostics.Errors()); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	expected := "<stdlib:Enum>:2:3: Runtime Error: Failed\n" +
+		"  Traceback, most recent call first:\n" +
+		"    at Enum.map (<stdlib:Enum>:2:3)\n" +
+		"    at <main> (main.oro:5:1)\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q but got %q", expected, out.String())
+	}
+}
+
+func TestTextRendererNoPosition(t *testing.T) {
+	diagnostics := NewDiagnostics()
+	diagnostics.Add(Diagnostic{Kind: Runtime, Message: "Failed"})
+	diagnostics.Add(Diagnostic{
+		Kind:    Runtime,
+		File:    "<host>",
+		Message: "Failed",
+		Trace: []Frame{
+			{Name: "check", File: "main.oro", Row: 2, Col: 3},
+			{Name: "<main>", File: "<host>"},
+		},
+	})
+	var out bytes.Buffer
+	if err := (TextRenderer{}).Render(&out, diagnostics.Errors()); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	expected := "Runtime Error: Failed\n" +
+		"<host>: Runtime Error: Failed\n" +
+		"  Traceback, most recent call first:\n" +
+		"    at check (main.oro:2:3)\n" +
+		"    at <main> (<host>)\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q but got %q", expected, out.String())
+	}
+}
+
+func TestTextRendererSnippet(t *testing.T) {
+	diagnostics := NewDiagnostics()
+	diagnostics.Add(Diagnostic{
+		Kind:    Runtime,
+		File:    "main.oro",
+		Row:     2,
+		Col:     10,
+		Span:    9,
+		Message: "Member 'sise' in module 'Enum' not found",
+		Hint:    "did you mean `Enum.size`?",
+	})
+	source := func(file string) ([]byte, bool) {
+		return []byte("val xs = [1]\n\tval n = Enum.sise(xs)\n"), file == "main.oro"
+	}
+	var out bytes.Buffer
+	if err := (TextRenderer{Source: source}).Render(&out, diagnostics.Errors()); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	expected := "main.oro:2:10: Runtime Error: Member 'sise' in module 'Enum' not found\n" +
+		"  2 | \tval n = Enum.sise(xs)\n" +
+		"    | \t        ^^^^^^^^^\n" +
+		"  Hint: did you mean `Enum.size`?\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q but got %q", expected, out.String())
+	}
+}
+
+func TestJSONRenderer(t *testing.T) {
+	diagnostics := NewDiagnostics()
+	var out bytes.Buffer
+	if err := (JSONRenderer{}).Render(&out, diagnostics.Errors()); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("Expected %q but got %q", "[]\n", out.String())
+	}
+	diagnostics.Error(Parse, token.Position{File: "main.oro", Row: 1, Col: 5}, 3, "Unexpected <end>")
+	out.Reset()
+	if err := (JSONRenderer{}).Render(&out, diagnostics.Errors()); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Expected valid JSON but got %s", err)
+	}
+	expected := map[string]interface{}{
+		"kind":    "Parse Error",
+		"file":    "main.oro",
+		"line":    float64(1),
+		"column":  float64(5),
+		"span":    float64(3),
+		"message": "Unexpected <end>",
+	}
+	if !reflect.DeepEqual(decoded, []map[string]interface{}{expected}) {
+		t.Errorf("Expected %v but got %v", expected, decoded)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"Enum.size", "Enum.map", "Enum.filter", "value"}
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"Enum.sise", "did you mean `Enum.size`?"},
+		{"Enum.mpa", "did you mean `Enum.map`?"},
+		{"valeu", "did you mean `value`?"},
+		{"value", ""},
+		{"x", ""},
+		{"Enum.reduce", ""},
+	}
+	for _, test := range tests {
+		if actual := Suggest(test.name, candidates); actual != test.expected {
+			t.Errorf("Expected %q but got %q", test.expected, actual)
+		}
 	}
 }
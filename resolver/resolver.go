@@ -0,0 +1,518 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package resolver implements functions to resolve identifiers.
+package resolver
+
+import (
+	"fmt"
+	"github.com/luiscm/oro/ast"
+	"github.com/luiscm/oro/rerror"
+	"github.com/luiscm/oro/runtime"
+)
+
+// Resolver annotates each identifier of a program with the depth and slot of
+// its binding, mirroring the scopes the interpreter opens for blocks, calls
+// and iterations, and each declared name with its slot. Names read where the
+// program runs, outside function bodies, must be declared before, and a block
+// can't declare a name twice.
+//
+// Function bodies are resolved after the program, as they see the names
+// declared after them. Some blocks take names at runtime: the ones running a
+// use, module bodies, the defaults of parameters, and the blocks whose
+// pattern calls a value that may or may not be a struct or an enum, so its
+// names may or may not be bound. Identifiers bound through them are left for
+// the interpreter to look up by name.
+type Resolver struct {
+	scope       *runtime.Scope
+	natives     map[string]bool
+	block       *block
+	deferred    []func()
+	lenient     bool
+	diagnostics *rerror.Diagnostics
+}
+
+type block struct {
+	slots   map[string]int
+	names   []string
+	types   map[string]bool
+	dynamic bool
+	outer   *block
+}
+
+func New(sc *runtime.Scope, natives []string) *Resolver {
+	resolver := &Resolver{scope: sc, natives: map[string]bool{}, diagnostics: rerror.NewDiagnostics()}
+	for _, name := range natives {
+		resolver.natives[name] = true
+	}
+	return resolver
+}
+
+func (r *Resolver) Diagnostics() *rerror.Diagnostics {
+	return r.diagnostics
+}
+
+func (r *Resolver) Resolve(np *ast.Program) {
+	var scopes []*runtime.Scope
+	for scope := r.scope; scope != nil; scope = scope.Parent() {
+		scopes = append(scopes, scope)
+	}
+	r.block = nil
+	for index := len(scopes) - 1; index >= 0; index-- {
+		r.open()
+		for _, name := range scopes[index].Bound() {
+			if name == "" {
+				// A declaration that failed left its slot empty.
+				r.block.names = append(r.block.names, name)
+				continue
+			}
+			r.bind(name)
+		}
+	}
+	r.block.dynamic = uses(np.Statements)
+	r.lenient = false
+	r.statements(np.Statements)
+	r.lenient = true
+	for len(r.deferred) > 0 {
+		body := r.deferred[0]
+		r.deferred = r.deferred[1:]
+		body()
+	}
+}
+
+func (r *Resolver) open() {
+	r.block = &block{slots: map[string]int{}, outer: r.block}
+}
+
+func (r *Resolver) close() {
+	r.block = r.block.outer
+}
+
+func (r *Resolver) scoped(nb *ast.BlockStatement, names ...*ast.Identifier) {
+	if nb == nil {
+		return
+	}
+	r.open()
+	r.block.dynamic = uses(nb.Statements)
+	for _, name := range names {
+		if name != nil {
+			r.define(name)
+		}
+	}
+	r.statements(nb.Statements)
+	r.close()
+}
+
+func (r *Resolver) bind(name string) int {
+	slot, ok := r.block.slots[name]
+	if !ok {
+		slot = len(r.block.names)
+		r.block.slots[name] = slot
+		r.block.names = append(r.block.names, name)
+	}
+	return slot
+}
+
+func (r *Resolver) define(name *ast.Identifier) {
+	slot := r.bind(name.Value)
+	name.Resolved, name.Depth, name.Slot = !r.block.dynamic, 0, slot
+}
+
+func (r *Resolver) declare(name *ast.Identifier) {
+	if _, ok := r.block.slots[name.Value]; ok && !r.block.dynamic {
+		r.diagnostics.Error(rerror.Resolve, name.TokenPosition(), len(name.TokenLiteral()),
+			fmt.Sprintf("Identifier '%s' already declared", name.Value))
+		return
+	}
+	r.define(name)
+}
+
+func (r *Resolver) lookup(name string) (depth, slot int, found, dynamic bool) {
+	for b := r.block; b != nil; b = b.outer {
+		dynamic = dynamic || b.dynamic
+		if slot, ok := b.slots[name]; ok {
+			return depth, slot, true, dynamic
+		}
+		depth++
+	}
+	return 0, 0, false, dynamic
+}
+
+func (r *Resolver) reference(ni *ast.Identifier) {
+	depth, slot, found, dynamic := r.lookup(ni.Value)
+	ni.Resolved, ni.Depth, ni.Slot = found && !dynamic, depth, slot
+	if found || dynamic || r.lenient || r.natives[ni.Value] {
+		return
+	}
+	var names []string
+	for b := r.block; b != nil; b = b.outer {
+		names = append(names, b.names...)
+	}
+	for name := range r.natives {
+		names = append(names, name)
+	}
+	for name := range runtime.FnRuntime {
+		names = append(names, name)
+	}
+	r.diagnostics.Add(rerror.Diagnostic{
+		Kind:    rerror.Resolve,
+		File:    ni.TokenPosition().File,
+		Row:     ni.TokenPosition().Row,
+		Col:     ni.TokenPosition().Col,
+		Span:    len(ni.TokenLiteral()),
+		Message: fmt.Sprintf("Identifier '%s' not found in current memory", ni.Value),
+		Hint:    rerror.Suggest(ni.Value, names),
+	})
+}
+
+func (r *Resolver) annotate(ni *ast.Identifier) {
+	depth, slot, found, dynamic := r.lookup(ni.Value)
+	ni.Resolved, ni.Depth, ni.Slot = found && !dynamic, depth, slot
+}
+
+func (r *Resolver) statements(statements []ast.Statement) {
+	for _, statement := range statements {
+		r.node(statement)
+	}
+}
+
+func (r *Resolver) node(n ast.Node) {
+	switch node := n.(type) {
+	case *ast.ExpressionStatement:
+		r.node(node.Expression)
+	case *ast.BlockStatement:
+		r.statements(node.Statements)
+	case *ast.Identifier:
+		r.reference(node)
+	case *ast.String:
+		for _, expression := range node.Interpolated {
+			r.node(expression)
+		}
+	case *ast.Array:
+		r.expressions(node.List)
+	case *ast.Dictionary:
+		for _, key := range node.Keys {
+			r.node(key)
+			r.node(node.Pairs[key])
+		}
+	case *ast.Val:
+		r.node(node.Value)
+		r.declaration(node.Name, node.Pattern)
+	case *ast.Var:
+		r.node(node.Value)
+		r.declaration(node.Name, node.Pattern)
+	case *ast.Is:
+		r.node(node.Left)
+	case *ast.As:
+		r.node(node.Left)
+	case *ast.If:
+		r.node(node.Condition)
+		r.scoped(node.Then)
+		r.scoped(node.Else)
+	case *ast.Repeat:
+		r.repeat(node)
+	case *ast.Match:
+		r.match(node)
+	case *ast.Try:
+		r.scoped(node.Body)
+		r.scoped(node.Rescue, node.Error)
+		r.scoped(node.Ensure)
+	case *ast.Return:
+		r.optional(node.Value)
+	case *ast.Yield:
+		r.optional(node.Value)
+	case *ast.Spawn:
+		r.node(node.Function)
+	case *ast.Await:
+		r.node(node.Task)
+	case *ast.Select:
+		for _, c := range node.Cases {
+			r.node(c.Channel)
+			r.optional(c.Value)
+			r.scoped(c.Body, c.Name)
+		}
+		r.scoped(node.Else)
+	case *ast.Pipe:
+		r.node(node.Left)
+		r.node(node.Right)
+	case *ast.Function:
+		r.function(node)
+	case *ast.FunctionCall:
+		r.call(node)
+	case *ast.Module:
+		r.module(node)
+	case *ast.ModuleAccess:
+		r.annotate(node.Object)
+	case *ast.Struct:
+		r.declareType(node.Name)
+	case *ast.Enum:
+		r.declareType(node.Name)
+	case *ast.FieldAccess:
+		r.node(node.Object)
+	case *ast.Subscript:
+		r.node(node.Left)
+		r.node(node.Index)
+	case *ast.Assign:
+		r.node(node.Name)
+		r.node(node.Right)
+	case *ast.PrefixExpression:
+		r.node(node.Right)
+	case *ast.InfixExpression:
+		r.node(node.Left)
+		r.node(node.Right)
+	}
+}
+
+func (r *Resolver) optional(expression ast.Expression) {
+	if expression != nil {
+		r.node(expression)
+	}
+}
+
+func (r *Resolver) expressions(list *ast.ExpressionList) {
+	if list == nil {
+		return
+	}
+	for _, element := range list.Elements {
+		r.node(element)
+	}
+}
+
+func (r *Resolver) declareType(name *ast.Identifier) {
+	if _, _, found, dynamic := r.lookup(name.Value); found && !dynamic && r.calleeKind(name) != typeCallee {
+		r.diagnostics.Error(rerror.Resolve, name.TokenPosition(), len(name.TokenLiteral()),
+			fmt.Sprintf("Identifier '%s' already declared", name.Value))
+		return
+	}
+	r.define(name)
+	if r.block.types == nil {
+		r.block.types = map[string]bool{}
+	}
+	r.block.types[name.Value] = true
+}
+
+func (r *Resolver) declaration(name *ast.Identifier, pattern ast.Expression) {
+	if pattern == nil {
+		r.declare(name)
+		return
+	}
+	bindings := r.pattern(pattern, true, nil)
+	r.block.dynamic = r.block.dynamic || !certain(bindings)
+	seen := map[string]bool{}
+	for _, binding := range bindings {
+		if seen[binding.name.Value] {
+			// The interpreter reports the name bound twice.
+			for _, binding := range bindings {
+				r.define(binding.name)
+			}
+			return
+		}
+		seen[binding.name.Value] = true
+	}
+	for _, binding := range bindings {
+		if binding.certain {
+			r.declare(binding.name)
+		} else {
+			r.define(binding.name)
+		}
+	}
+}
+
+func (r *Resolver) call(nf *ast.FunctionCall) {
+	r.callee(nf.Function)
+	r.expressions(nf.Arguments)
+}
+
+func (r *Resolver) callee(function ast.Expression) {
+	if callee, ok := function.(*ast.Identifier); ok {
+		if _, builtin := runtime.FnRuntime[callee.Value]; builtin && !r.natives[callee.Value] {
+			callee.Resolved = false
+			return
+		}
+	}
+	r.node(function)
+}
+
+func (r *Resolver) function(nf *ast.Function) {
+	around := r.block
+	for _, param := range nf.Parameters {
+		if param.Default != nil {
+			r.block = &block{dynamic: true}
+			r.node(param.Default)
+			r.block = around
+		}
+	}
+	r.deferred = append(r.deferred, func() {
+		r.block = &block{outer: around}
+		r.open()
+		if nf.Body != nil {
+			r.block.dynamic = uses(nf.Body.Statements)
+		}
+		for _, param := range nf.Parameters {
+			r.define(param.Name)
+		}
+		if nf.Body != nil {
+			r.statements(nf.Body.Statements)
+		}
+	})
+}
+
+func (r *Resolver) module(nm *ast.Module) {
+	r.deferred = append(r.deferred, func() {
+		r.block = &block{dynamic: true}
+		r.open()
+		if nm.Body != nil {
+			r.statements(nm.Body.Statements)
+		}
+	})
+}
+
+func (r *Resolver) repeat(nr *ast.Repeat) {
+	r.optional(nr.Enumerable)
+	var bindings []binding
+	if nr.Pattern != nil {
+		bindings = r.pattern(nr.Pattern, true, nil)
+	}
+	r.open()
+	r.block.dynamic = !certain(bindings) || nr.Body != nil && uses(nr.Body.Statements)
+	if nr.Arguments != nil {
+		for _, argument := range nr.Arguments.Elements {
+			r.define(argument)
+		}
+	}
+	for _, binding := range bindings {
+		r.define(binding.name)
+	}
+	if nr.Body != nil {
+		r.statements(nr.Body.Statements)
+	}
+	r.close()
+}
+
+func (r *Resolver) match(nm *ast.Match) {
+	r.optional(nm.Control)
+	for _, when := range nm.Whens {
+		var bindings []binding
+		if when.Values != nil {
+			for _, element := range when.Values.Elements {
+				bindings = r.pattern(element, true, bindings)
+			}
+		}
+		r.open()
+		r.block.dynamic = !certain(bindings) || when.Body != nil && uses(when.Body.Statements)
+		for _, binding := range bindings {
+			r.define(binding.name)
+		}
+		r.optional(when.Guard)
+		if when.Body != nil {
+			r.statements(when.Body.Statements)
+		}
+		r.close()
+	}
+	r.scoped(nm.Else)
+}
+
+type binding struct {
+	name    *ast.Identifier
+	certain bool
+}
+
+func certain(bindings []binding) bool {
+	for _, binding := range bindings {
+		if !binding.certain {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Resolver) pattern(pattern ast.Expression, top bool, bindings []binding) []binding {
+	return r.bindings(pattern, top, true, bindings)
+}
+
+func (r *Resolver) bindings(pattern ast.Expression, top, certain bool, bindings []binding) []binding {
+	switch pattern := pattern.(type) {
+	case *ast.PlaceHolder:
+	case *ast.Identifier:
+		if top {
+			r.reference(pattern)
+			break
+		}
+		bindings = append(bindings, binding{name: pattern, certain: certain})
+	case *ast.Array:
+		for _, element := range pattern.List.Elements {
+			bindings = r.bindings(element, false, certain, bindings)
+		}
+	case *ast.Dictionary:
+		for _, key := range pattern.Keys {
+			r.node(key)
+			bindings = r.bindings(pattern.Pairs[key], false, certain, bindings)
+		}
+	case *ast.TypePattern:
+		if name, ok := pattern.Name.(*ast.Identifier); ok {
+			bindings = append(bindings, binding{name: name, certain: certain})
+		}
+	case *ast.RestPattern:
+		if name, ok := pattern.Name.(*ast.Identifier); ok {
+			bindings = append(bindings, binding{name: name, certain: certain})
+		}
+	case *ast.FunctionCall:
+		switch kind := r.calleeKind(pattern.Function); kind {
+		case typeCallee, unknownCallee:
+			r.callee(pattern.Function)
+			for _, argument := range pattern.Arguments.Elements {
+				bindings = r.bindings(argument, false, certain && kind == typeCallee, bindings)
+			}
+		default:
+			r.node(pattern)
+		}
+	default:
+		r.node(pattern)
+	}
+	return bindings
+}
+
+const (
+	valueCallee = iota
+	typeCallee
+	unknownCallee
+)
+
+func (r *Resolver) calleeKind(callee ast.Expression) int {
+	var name string
+	switch callee := callee.(type) {
+	case *ast.Identifier:
+		if _, builtin := runtime.FnRuntime[callee.Value]; builtin || r.natives[callee.Value] {
+			return valueCallee
+		}
+		name = callee.Value
+	case *ast.ModuleAccess:
+		name = callee.Object.Value
+	default:
+		return valueCallee
+	}
+	for b := r.block; b != nil; b = b.outer {
+		if b.dynamic {
+			return unknownCallee
+		}
+		if _, ok := b.slots[name]; ok {
+			if b.types[name] {
+				return typeCallee
+			}
+			return unknownCallee
+		}
+	}
+	// Names that aren't bound are modules, or are reported as not found.
+	return valueCallee
+}
+
+func uses(statements []ast.Statement) bool {
+	for _, statement := range statements {
+		if es, ok := statement.(*ast.ExpressionStatement); ok {
+			if _, ok := es.Expression.(*ast.Use); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
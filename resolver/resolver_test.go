@@ -0,0 +1,168 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+package resolver
+
+import (
+	"github.com/luiscm/oro/ast"
+	"github.com/luiscm/oro/lexer"
+	"github.com/luiscm/oro/parser"
+	"github.com/luiscm/oro/runtime"
+	"testing"
+)
+
+func TestResolveSlots(t *testing.T) {
+	tests := []struct {
+		input    string
+		resolved bool
+		depth    int
+		slot     int
+	}{
+		{"val a = 1\nval x = 2\nx", true, 0, 1},
+		{"val x = 1\nif true\n  x\nend", true, 1, 0},
+		{"val x = 1\nval f = fn (a, b)\n  x\nend", true, 2, 0},
+		{"val f = fn (a, x)\n  x\nend", true, 0, 1},
+		{"val f = fn\n  x\nend\nval x = 1", true, 2, 1},
+		{"repeat i, x in [1]\n  x\nend", true, 0, 1},
+		{"val y = 1\nval f = fn\n  val x = 1\n  x\nend", true, 0, 0},
+		{"use \"lib.oro\"\nval x = 1\nx", false, 0, 0},
+		{"val x = 1\nval f = fn\n  use \"lib.oro\"\n  x\nend", false, 0, 0},
+		{"struct P a, b end\nmatch P(1, 2)\nwhen P(x, _) then x\nend", true, 0, 0},
+		{"val P = (a) -> a\nmatch 1\nwhen P(x) then x\nend", false, 0, 0},
+		{"val x = 1\nmatch 1\nwhen len(x) then x\nend", true, 1, 0},
+	}
+	for _, test := range tests {
+		program := parse(t, test.input)
+		resolve := New(runtime.NewScope(), nil)
+		resolve.Resolve(program)
+		if resolve.Diagnostics().HasErrors() {
+			t.Errorf("Expected no errors for %q but got %v", test.input, resolve.Diagnostics().Errors())
+			continue
+		}
+		identifier := find(program.Statements, "x")
+		if identifier == nil {
+			t.Errorf("Expected a reference to x in %q", test.input)
+			continue
+		}
+		if identifier.Resolved != test.resolved || test.resolved && (identifier.Depth != test.depth || identifier.Slot != test.slot) {
+			t.Errorf("Expected x in %q resolved %t at %d:%d but got %t at %d:%d", test.input, test.resolved, test.depth, test.slot,
+				identifier.Resolved, identifier.Depth, identifier.Slot)
+		}
+	}
+}
+
+func TestResolveDeclarations(t *testing.T) {
+	program := parse(t, "val a = 1\nval [b, c] = [2, 3]\nrepeat i, d in [4]\n  d\nend")
+	resolve := New(runtime.NewScope(), nil)
+	resolve.Resolve(program)
+	declaration := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.Val)
+	c := declaration.Pattern.(*ast.Array).List.Elements[1].(*ast.Identifier)
+	if !c.Resolved || c.Depth != 0 || c.Slot != 2 {
+		t.Errorf("Expected c declared at 0:2 but got %t at %d:%d", c.Resolved, c.Depth, c.Slot)
+	}
+	loop := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.Repeat)
+	d := loop.Arguments.Elements[1]
+	if !d.Resolved || d.Depth != 0 || d.Slot != 1 {
+		t.Errorf("Expected d declared at 0:1 but got %t at %d:%d", d.Resolved, d.Depth, d.Slot)
+	}
+}
+
+func TestResolveScope(t *testing.T) {
+	sc := runtime.NewScope()
+	sc.Write("a", runtime.Nil)
+	sc.Write("x", runtime.Nil)
+	program := parse(t, "x")
+	resolve := New(sc, nil)
+	resolve.Resolve(program)
+	identifier := find(program.Statements, "x")
+	if !identifier.Resolved || identifier.Depth != 0 || identifier.Slot != 1 {
+		t.Errorf("Expected x resolved at 0:1 but got %t at %d:%d", identifier.Resolved, identifier.Depth, identifier.Slot)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"missing + 1", "Identifier 'missing' not found in current memory"},
+		{"x\nval x = 1", "Identifier 'x' not found in current memory"},
+		{"repeat i in [1]\n  i\nend\ni", "Identifier 'i' not found in current memory"},
+		{"val a = 1\nval a = 2", "Identifier 'a' already declared"},
+		{"val [a, b] = [1, 2]\nvar b = 3", "Identifier 'b' already declared"},
+		{"val f = fn (a)\n  val a = 1\nend", "Identifier 'a' already declared"},
+		{"val f = fn\n  missing\nend", ""},
+		{"println(1)", ""},
+		{"double(1)", ""},
+		{"Enum.size([1])", ""},
+		{"use \"lib.oro\"\nhelper()", ""},
+		{"match 1\nwhen n: Integer then n\nend", ""},
+		{"match [1, 2]\nwhen [a, ...rest] then rest\nend", ""},
+		{"try\n  1\nrescue err\n  err\nend", ""},
+		{"val [a, a] = [1, 2]", ""},
+	}
+	for _, test := range tests {
+		program := parse(t, test.input)
+		resolve := New(runtime.NewScope(), []string{"double"})
+		resolve.Resolve(program)
+		errors := resolve.Diagnostics().Errors()
+		if test.expected == "" {
+			if len(errors) > 0 {
+				t.Errorf("Expected no errors for %q but got %v", test.input, errors)
+			}
+			continue
+		}
+		if len(errors) != 1 || errors[0].Message != test.expected {
+			t.Errorf("Expected %q for %q but got %v", test.expected, test.input, errors)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	parse := parser.New(lexer.New("", []byte(input)))
+	program := parse.Parse()
+	if parse.Diagnostics().HasErrors() {
+		t.Fatalf("Expected no parse errors for %q but got %v", input, parse.Diagnostics().Errors())
+	}
+	return program
+}
+
+// find returns the last reference to name in the statements, looking into
+// the blocks and functions the tests use.
+func find(statements []ast.Statement, name string) *ast.Identifier {
+	var found *ast.Identifier
+	for _, statement := range statements {
+		if identifier := findIn(statement, name); identifier != nil {
+			found = identifier
+		}
+	}
+	return found
+}
+
+func findIn(n ast.Node, name string) *ast.Identifier {
+	switch node := n.(type) {
+	case *ast.ExpressionStatement:
+		return findIn(node.Expression, name)
+	case *ast.Identifier:
+		if node.Value == name {
+			return node
+		}
+	case *ast.Val:
+		return findIn(node.Value, name)
+	case *ast.Function:
+		return find(node.Body.Statements, name)
+	case *ast.If:
+		return find(node.Then.Statements, name)
+	case *ast.Repeat:
+		return find(node.Body.Statements, name)
+	case *ast.Match:
+		var found *ast.Identifier
+		for _, when := range node.Whens {
+			if identifier := find(when.Body.Statements, name); identifier != nil {
+				found = identifier
+			}
+		}
+		return found
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package runtime implements functions to arrays.
+package runtime
+
+import (
+	"bytes"
+	"github.com/luiscm/oro/token"
+	"strings"
+)
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+type TArray struct {
+	elements vector
+}
+
+func NewArray(elements []Data) *TArray {
+	return &TArray{elements: newVector(elements)}
+}
+
+func (t *TArray) Type() string {
+	return TTArray
+}
+
+func (t *TArray) Check() string {
+	var out bytes.Buffer
+	var elements []string
+	for idx := 0; idx < t.Len(); idx++ {
+		elements = append(elements, t.At(idx).Check())
+	}
+	out.WriteString(token.LeftBracket)
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString(token.RightBracket)
+	return out.String()
+}
+
+func (t *TArray) Len() int {
+	return t.elements.count
+}
+
+func (t *TArray) At(index int) Data {
+	return t.elements.at(index)
+}
+
+func (t *TArray) Elements() []Data {
+	return t.elements.slice()
+}
+
+func (t *TArray) Set(index int, value Data) *TArray {
+	return &TArray{elements: t.elements.set(index, value)}
+}
+
+func (t *TArray) Append(values ...Data) *TArray {
+	elements := t.elements
+	for _, value := range values {
+		elements = elements.push(value)
+	}
+	return &TArray{elements: elements}
+}
+
+func (t *TArray) Concat(other *TArray) *TArray {
+	elements := t.elements
+	for idx := 0; idx < other.Len(); idx++ {
+		elements = elements.push(other.At(idx))
+	}
+	return &TArray{elements: elements}
+}
+
+// vector is a persistent vector: a trie of nodes with vectorWidth children
+// and the last, partly filled, leaf kept apart as the tail. Its nodes are
+// never changed once built, so vectors share them freely.
+type vector struct {
+	count int
+	shift uint
+	root  *vectorNode
+	tail  []Data
+}
+
+type vectorNode struct {
+	children []*vectorNode
+	values   []Data
+}
+
+func newVector(elements []Data) vector {
+	v := vector{shift: vectorBits, root: &vectorNode{}}
+	full := len(elements) / vectorWidth * vectorWidth
+	for offset := 0; offset < full; offset += vectorWidth {
+		leaf := &vectorNode{values: append([]Data(nil), elements[offset:offset+vectorWidth]...)}
+		v = v.pushLeaf(leaf, offset)
+	}
+	v.count = len(elements)
+	v.tail = append([]Data(nil), elements[full:]...)
+	return v
+}
+
+func (v vector) tailOffset() int {
+	return v.count - len(v.tail)
+}
+
+func (v vector) at(index int) Data {
+	if index >= v.tailOffset() {
+		return v.tail[index-v.tailOffset()]
+	}
+	node := v.root
+	for level := v.shift; level > 0; level -= vectorBits {
+		node = node.children[(index>>level)&vectorMask]
+	}
+	return node.values[index&vectorMask]
+}
+
+func (v vector) slice() []Data {
+	elements := make([]Data, v.count)
+	for idx := range elements {
+		elements[idx] = v.at(idx)
+	}
+	return elements
+}
+
+func (v vector) set(index int, value Data) vector {
+	if index >= v.tailOffset() {
+		tail := append([]Data(nil), v.tail...)
+		tail[index-v.tailOffset()] = value
+		v.tail = tail
+		return v
+	}
+	v.root = setNode(v.root, v.shift, index, value)
+	return v
+}
+
+func setNode(node *vectorNode, level uint, index int, value Data) *vectorNode {
+	if level == 0 {
+		values := append([]Data(nil), node.values...)
+		values[index&vectorMask] = value
+		return &vectorNode{values: values}
+	}
+	children := append([]*vectorNode(nil), node.children...)
+	sub := (index >> level) & vectorMask
+	children[sub] = setNode(children[sub], level-vectorBits, index, value)
+	return &vectorNode{children: children}
+}
+
+func (v vector) push(value Data) vector {
+	if v.root == nil {
+		v.shift, v.root = vectorBits, &vectorNode{}
+	}
+	if len(v.tail) == vectorWidth {
+		v = v.pushLeaf(&vectorNode{values: v.tail}, v.tailOffset())
+		v.tail = nil
+	}
+	tail := make([]Data, len(v.tail)+1)
+	copy(tail, v.tail)
+	tail[len(v.tail)] = value
+	v.tail = tail
+	v.count++
+	return v
+}
+
+func (v vector) pushLeaf(leaf *vectorNode, offset int) vector {
+	if offset>>vectorBits >= 1<<v.shift {
+		v.root = &vectorNode{children: []*vectorNode{v.root, newPath(v.shift, leaf)}}
+		v.shift += vectorBits
+		return v
+	}
+	v.root = pushNode(v.root, v.shift, leaf, offset)
+	return v
+}
+
+func pushNode(parent *vectorNode, level uint, leaf *vectorNode, offset int) *vectorNode {
+	sub := (offset >> level) & vectorMask
+	children := append([]*vectorNode(nil), parent.children...)
+	var child *vectorNode
+	switch {
+	case level == vectorBits:
+		child = leaf
+	case sub < len(children):
+		child = pushNode(children[sub], level-vectorBits, leaf, offset)
+	default:
+		child = newPath(level-vectorBits, leaf)
+	}
+	if sub < len(children) {
+		children[sub] = child
+	} else {
+		children = append(children, child)
+	}
+	return &vectorNode{children: children}
+}
+
+func newPath(level uint, leaf *vectorNode) *vectorNode {
+	if level == 0 {
+		return leaf
+	}
+	return &vectorNode{children: []*vectorNode{newPath(level-vectorBits, leaf)}}
+}
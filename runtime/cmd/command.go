@@ -29,6 +29,7 @@ func (s *Command) InsertAll() {
 	table[token.Else] = token.Else
 	table[token.Repeat] = token.Repeat
 	table[token.In] = token.In
+	table[token.Step] = token.Step
 	table[token.Is] = token.Is
 	table[token.As] = token.As
 	table[token.Return] = token.Return
@@ -39,7 +40,16 @@ func (s *Command) InsertAll() {
 	table[token.Break] = token.Break
 	table[token.Continue] = token.Continue
 	table[token.Module] = token.Module
+	table[token.Struct] = token.Struct
+	table[token.Enum] = token.Enum
+	table[token.Yield] = token.Yield
+	table[token.Spawn] = token.Spawn
+	table[token.Await] = token.Await
+	table[token.Select] = token.Select
 	table[token.Use] = token.Use
+	table[token.Try] = token.Try
+	table[token.Rescue] = token.Rescue
+	table[token.Ensure] = token.Ensure
 }
 
 func (s *Command) Lookup(name string) (token.TType, bool) {
@@ -0,0 +1,145 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package runtime implements functions to dictionaries.
+package runtime
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/luiscm/oro/token"
+	"math/bits"
+	"strings"
+)
+
+type TDictionary struct {
+	keys   vector
+	values vector
+	index  *trieNode
+}
+
+func NewDictionary() *TDictionary {
+	return &TDictionary{}
+}
+
+func (t *TDictionary) Type() string {
+	return TTDictionary
+}
+
+func (t *TDictionary) Check() string {
+	var out bytes.Buffer
+	var pairs []string
+	for idx := 0; idx < t.Len(); idx++ {
+		key, value := t.At(idx)
+		pairs = append(pairs, fmt.Sprintf("%s => %s", key.Check(), value.Check()))
+	}
+	out.WriteString(token.LeftBracket)
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString(token.RightBracket)
+	return out.String()
+}
+
+func (t *TDictionary) Len() int {
+	return t.keys.count
+}
+
+func (t *TDictionary) At(index int) (Data, Data) {
+	return t.keys.at(index), t.values.at(index)
+}
+
+func (t *TDictionary) Get(key Data) (Data, bool) {
+	if idx, ok := t.find(key, Hash(key)); ok {
+		return t.values.at(idx), true
+	}
+	return nil, false
+}
+
+func (t *TDictionary) Has(key Data) bool {
+	_, ok := t.find(key, Hash(key))
+	return ok
+}
+
+func (t *TDictionary) Set(key, value Data) *TDictionary {
+	hash := Hash(key)
+	if idx, ok := t.find(key, hash); ok {
+		return &TDictionary{keys: t.keys, values: t.values.set(idx, value), index: t.index}
+	}
+	indices := append(append([]int(nil), t.index.get(hash, 0)...), t.Len())
+	return &TDictionary{
+		keys:   t.keys.push(key),
+		values: t.values.push(value),
+		index:  t.index.put(&trieLeaf{hash: hash, indices: indices}, 0),
+	}
+}
+
+func (t *TDictionary) find(key Data, hash uint64) (int, bool) {
+	for _, idx := range t.index.get(hash, 0) {
+		if Equal(t.keys.at(idx), key) {
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+// trieNode is a node of a persistent hash trie, which maps the hash of a key
+// to the indices of the pairs whose keys have that hash. Each level takes
+// vectorBits bits of the hash and a bitmap tells which entries are present,
+// so only those are stored. Nodes are never changed once built.
+type trieNode struct {
+	bitmap  uint32
+	entries []trieEntry
+}
+
+type trieEntry struct {
+	node *trieNode
+	leaf *trieLeaf
+}
+
+type trieLeaf struct {
+	hash    uint64
+	indices []int
+}
+
+func (n *trieNode) get(hash uint64, shift uint) []int {
+	for n != nil {
+		bit := uint32(1) << ((hash >> shift) & vectorMask)
+		if n.bitmap&bit == 0 {
+			return nil
+		}
+		entry := n.entries[bits.OnesCount32(n.bitmap&(bit-1))]
+		if entry.leaf != nil {
+			if entry.leaf.hash == hash {
+				return entry.leaf.indices
+			}
+			return nil
+		}
+		n, shift = entry.node, shift+vectorBits
+	}
+	return nil
+}
+
+func (n *trieNode) put(leaf *trieLeaf, shift uint) *trieNode {
+	if n == nil {
+		n = &trieNode{}
+	}
+	bit := uint32(1) << ((leaf.hash >> shift) & vectorMask)
+	pos := bits.OnesCount32(n.bitmap & (bit - 1))
+	if n.bitmap&bit == 0 {
+		entries := make([]trieEntry, len(n.entries)+1)
+		copy(entries, n.entries[:pos])
+		entries[pos] = trieEntry{leaf: leaf}
+		copy(entries[pos+1:], n.entries[pos:])
+		return &trieNode{bitmap: n.bitmap | bit, entries: entries}
+	}
+	entries := append([]trieEntry(nil), n.entries...)
+	switch entry := entries[pos]; {
+	case entry.node != nil:
+		entries[pos] = trieEntry{node: entry.node.put(leaf, shift+vectorBits)}
+	case entry.leaf.hash == leaf.hash:
+		entries[pos] = trieEntry{leaf: leaf}
+	default:
+		node := new(trieNode).put(entry.leaf, shift+vectorBits)
+		entries[pos] = trieEntry{node: node.put(leaf, shift+vectorBits)}
+	}
+	return &trieNode{bitmap: n.bitmap, entries: entries}
+}
@@ -0,0 +1,206 @@
+// Copyright 2011 The LuisCM. All rights reserved.
+// Use of this source code is license that can be found in the LICENSE file.
+
+// Package runtime implements functions to hash values.
+package runtime
+
+import (
+	"github.com/luiscm/oro/token"
+	"hash/fnv"
+	"math"
+)
+
+type Hashable interface {
+	Hash() uint64
+	Equals(other Data) bool
+}
+
+func Hash(key Data) uint64 {
+	if hashable, ok := key.(Hashable); ok {
+		return hashable.Hash()
+	}
+	return hashOf(key.Type(), nil)
+}
+
+func Equal(left, right Data) bool {
+	if hashable, ok := left.(Hashable); ok {
+		return hashable.Equals(right)
+	}
+	return left == right
+}
+
+func hashOf(kind string, value []byte) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(kind))
+	hash.Write([]byte{0})
+	hash.Write(value)
+	return hash.Sum64()
+}
+
+func hashBits(kind string, bits uint64) uint64 {
+	var value [8]byte
+	for idx := range value {
+		value[idx] = byte(bits >> (8 * idx))
+	}
+	return hashOf(kind, value[:])
+}
+
+func hashElements(hash uint64, elements []Data) uint64 {
+	for _, element := range elements {
+		hash = hash*31 + Hash(element)
+	}
+	return hash
+}
+
+func equalElements(left, right []Data) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for idx := range left {
+		if !Equal(left[idx], right[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *TBoolean) Hash() uint64 {
+	if t.Value {
+		return hashBits(TTBoolean, 1)
+	}
+	return hashBits(TTBoolean, 0)
+}
+
+func (t *TBoolean) Equals(other Data) bool {
+	value, ok := other.(*TBoolean)
+	return ok && value.Value == t.Value
+}
+
+func (t *TString) Hash() uint64 {
+	return hashOf(TTString, []byte(t.Value))
+}
+
+func (t *TString) Equals(other Data) bool {
+	value, ok := other.(*TString)
+	return ok && value.Value == t.Value
+}
+
+func (t *TInteger) Hash() uint64 {
+	return hashBits(TTInteger, uint64(t.Value))
+}
+
+func (t *TInteger) Equals(other Data) bool {
+	value, ok := other.(*TInteger)
+	return ok && value.Value == t.Value
+}
+
+func (t *TFloat) Hash() uint64 {
+	if t.Value == 0 {
+		return hashBits(TTFloat, 0)
+	}
+	return hashBits(TTFloat, math.Float64bits(t.Value))
+}
+
+func (t *TFloat) Equals(other Data) bool {
+	value, ok := other.(*TFloat)
+	return ok && value.Value == t.Value
+}
+
+func (t *TSymbol) Hash() uint64 {
+	return hashOf(TTSymbol, []byte(t.Value))
+}
+
+func (t *TSymbol) Equals(other Data) bool {
+	value, ok := other.(*TSymbol)
+	return ok && value.Value == t.Value
+}
+
+func (t *TNil) Hash() uint64 {
+	return hashOf(TTNil, nil)
+}
+
+func (t *TNil) Equals(other Data) bool {
+	_, ok := other.(*TNil)
+	return ok
+}
+
+func (t *TArray) Hash() uint64 {
+	hash := hashOf(TTArray, nil)
+	for idx := 0; idx < t.Len(); idx++ {
+		hash = hash*31 + Hash(t.At(idx))
+	}
+	return hash
+}
+
+func (t *TArray) Equals(other Data) bool {
+	value, ok := other.(*TArray)
+	if !ok || value.Len() != t.Len() {
+		return false
+	}
+	for idx := 0; idx < t.Len(); idx++ {
+		if !Equal(t.At(idx), value.At(idx)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *TDictionary) Hash() uint64 {
+	hash := hashOf(TTDictionary, nil)
+	for idx := 0; idx < t.Len(); idx++ {
+		key, value := t.At(idx)
+		hash += Hash(key)*31 ^ Hash(value)
+	}
+	return hash
+}
+
+func (t *TDictionary) Equals(other Data) bool {
+	value, ok := other.(*TDictionary)
+	if !ok || value.Len() != t.Len() {
+		return false
+	}
+	for idx := 0; idx < t.Len(); idx++ {
+		key, data := t.At(idx)
+		found, ok := value.Get(key)
+		if !ok || !Equal(data, found) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *TRange) Hash() uint64 {
+	hash := hashBits(TTRange, uint64(t.Start))
+	hash = hash*31 + uint64(t.End)
+	hash = hash*31 + uint64(t.Step)
+	hash = hash*31 + math.Float64bits(t.StartFloat)
+	hash = hash*31 + math.Float64bits(t.EndFloat)
+	hash = hash*31 + math.Float64bits(t.StepFloat)
+	if t.Exclusive {
+		hash++
+	}
+	return hash
+}
+
+func (t *TRange) Equals(other Data) bool {
+	value, ok := other.(*TRange)
+	return ok && *value == *t
+}
+
+func (t *TStruct) Hash() uint64 {
+	return hashElements(hashOf(t.Definition.Name, nil), t.Values)
+}
+
+func (t *TStruct) Equals(other Data) bool {
+	value, ok := other.(*TStruct)
+	return ok && value.Definition == t.Definition && equalElements(t.Values, value.Values)
+}
+
+func (t *TVariant) Hash() uint64 {
+	return hashElements(hashOf(t.Variant.Enum.Name+token.Dot+t.Variant.Name, nil), t.Values)
+}
+
+func (t *TVariant) Equals(other Data) bool {
+	value, ok := other.(*TVariant)
+	return ok && value.Variant == t.Variant && equalElements(t.Values, value.Values)
+}
@@ -6,6 +6,7 @@ package runtime
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"github.com/luiscm/oro/rerror"
 	"github.com/luiscm/oro/util"
@@ -19,6 +20,8 @@ import (
 
 type TRuntimeFn func(args ...Data) (Data, error)
 
+type TNativeFn func(ctx context.Context, sc *Scope, args ...Data) (Data, error)
+
 var FnRuntime = map[string]TRuntimeFn{
 
 	"echo": func(args ...Data) (Data, error) {
@@ -87,9 +90,12 @@ var FnRuntime = map[string]TRuntimeFn{
 	"panic": func(args ...Data) (Data, error) {
 		var message string
 		if len(args) > 0 {
+			if err, ok := args[0].(*TError); ok {
+				return nil, err
+			}
 			message = args[0].Check()
 		}
-		return nil, rerror.ErrorFmt(message)
+		return nil, rerror.ErrorFmt("%s", message)
 	},
 
 	"typeof": func(args ...Data) (Data, error) {
@@ -105,9 +111,11 @@ var FnRuntime = map[string]TRuntimeFn{
 		}
 		switch object := args[0].(type) {
 		case *TArray:
-			return &TInteger{Value: int64(len(object.Elements))}, nil
+			return &TInteger{Value: int64(object.Len())}, nil
 		case *TString:
 			return &TInteger{Value: int64(len(object.Value))}, nil
+		case *TRange:
+			return &TInteger{Value: object.Len()}, nil
 		default:
 			return nil, rerror.ErrorFmt("argument to `len` not supported, got %s", object.Type())
 		}
@@ -121,8 +129,8 @@ var FnRuntime = map[string]TRuntimeFn{
 			return nil, rerror.ErrorFmt("argument to `first` must be ARRAY, got %s", args[0].Type())
 		}
 		arr := args[0].(*TArray)
-		if len(arr.Elements) > 0 {
-			return arr.Elements[0], nil
+		if arr.Len() > 0 {
+			return arr.At(0), nil
 		}
 		return nil, nil
 	},
@@ -135,9 +143,9 @@ var FnRuntime = map[string]TRuntimeFn{
 			return nil, rerror.ErrorFmt("argument to `last` must be ARRAY, got %s", args[0].Type())
 		}
 		arr := args[0].(*TArray)
-		length := len(arr.Elements)
+		length := arr.Len()
 		if length > 0 {
-			return arr.Elements[length-1], nil
+			return arr.At(length - 1), nil
 		}
 		return nil, nil
 	},
@@ -150,11 +158,8 @@ var FnRuntime = map[string]TRuntimeFn{
 			return nil, rerror.ErrorFmt("argument to `rest` must be ARRAY, got %s", args[0].Type())
 		}
 		arr := args[0].(*TArray)
-		length := len(arr.Elements)
-		if length > 0 {
-			newElements := make([]Data, length-1, length-1)
-			copy(newElements, arr.Elements[1:length])
-			return &TArray{Elements: newElements}, nil
+		if arr.Len() > 0 {
+			return NewArray(arr.Elements()[1:]), nil
 		}
 		return nil, nil
 	},
@@ -167,11 +172,29 @@ var FnRuntime = map[string]TRuntimeFn{
 			return nil, rerror.ErrorFmt("argument to `push` must be ARRAY, got %s", args[0].Type())
 		}
 		arr := args[0].(*TArray)
-		length := len(arr.Elements)
-		newElements := make([]Data, length+1, length+1)
-		copy(newElements, arr.Elements)
-		newElements[length] = args[1]
-		return &TArray{Elements: newElements}, nil
+		return arr.Append(args[1]), nil
+	},
+
+	"Error": func(args ...Data) (Data, error) {
+		if len(args) < 1 || len(args) > 3 {
+			return nil, rerror.ErrorFmt("Error() expects a message, an optional tag and an optional payload")
+		}
+		message, ok := args[0].(*TString)
+		if !ok {
+			return nil, rerror.ErrorFmt("Error() expects a String message but got '%s'", args[0].Type())
+		}
+		err := &TError{Kind: "error", Message: message.Value, Payload: Nil}
+		if len(args) > 1 {
+			tag, ok := args[1].(*TSymbol)
+			if !ok {
+				return nil, rerror.ErrorFmt("Error() expects a Symbol tag but got '%s'", args[1].Type())
+			}
+			err.Tag = tag
+		}
+		if len(args) > 2 {
+			err.Payload = args[2]
+		}
+		return err, nil
 	},
 
 	"String": func(args ...Data) (Data, error) {
@@ -251,9 +274,28 @@ var FnRuntime = map[string]TRuntimeFn{
 		switch object := args[0].(type) {
 		case *TArray:
 			return object, nil
+		case *TSequence:
+			return object.Collect()
+		case *TRange:
+			return NewArray(object.Elements()), nil
 		default:
-			return &TArray{Elements: []Data{object}}, nil
+			return NewArray([]Data{object}), nil
+		}
+	},
+
+	"Channel": func(args ...Data) (Data, error) {
+		if len(args) > 1 {
+			return nil, rerror.ErrorFmt("Channel() expects an optional capacity")
+		}
+		capacity := int64(0)
+		if len(args) == 1 {
+			size, ok := args[0].(*TInteger)
+			if !ok || size.Value < 0 {
+				return nil, rerror.ErrorFmt("Channel() expects a capacity as a positive Integer but got '%s'", args[0].Check())
+			}
+			capacity = size.Value
 		}
+		return &TChannel{Capacity: int(capacity)}, nil
 	},
 
 	"runtime_rand": func(args ...Data) (Data, error) {
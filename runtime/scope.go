@@ -4,53 +4,159 @@
 // Package runtime implements functions to scope.
 package runtime
 
+// Scope holds the bindings of a block in slots, which the resolver gives to
+// the names the block declares. Bindings are read and written by slot; names
+// are only looked up in the blocks that take names at runtime, such as the
+// ones running a use, and by the host. Each binding knows if it was declared
+// immutable, so an inner scope can shadow it with its own.
 type Scope struct {
-	store  map[string]Data
-	parent *Scope
+	names     []string
+	values    []Data
+	immutable []bool
+	parent    *Scope
 }
 
 func NewScope() *Scope {
-	return &Scope{
-		store: make(map[string]Data),
-	}
+	return &Scope{}
 }
 
 func NewScopeFrom(parent *Scope) *Scope {
-	return &Scope{
-		store:  make(map[string]Data),
-		parent: parent,
-	}
+	return &Scope{parent: parent}
 }
 
 func (s *Scope) Read(name string) (Data, bool) {
-	value, ok := s.store[name]
-	if !ok && s.parent != nil {
-		value, ok = s.parent.Read(name)
+	if scope, slot := s.owner(name); scope != nil {
+		return scope.values[slot], true
+	}
+	return nil, false
+}
+
+func (s *Scope) ReadAt(depth, slot int) (Data, bool) {
+	if scope := s.at(depth, slot); scope != nil {
+		return scope.values[slot], true
+	}
+	return nil, false
+}
+
+func (s *Scope) Parent() *Scope {
+	return s.parent
+}
+
+func (s *Scope) Bound() []string {
+	return append([]string(nil), s.names...)
+}
+
+func (s *Scope) Names() []string {
+	var names []string
+	for scope := s; scope != nil; scope = scope.parent {
+		for slot, name := range scope.names {
+			if scope.values[slot] != nil {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func (s *Scope) Copy() *Scope {
+	return &Scope{
+		names:     append([]string(nil), s.names...),
+		values:    append([]Data(nil), s.values...),
+		immutable: append([]bool(nil), s.immutable...),
+		parent:    s.parent,
 	}
-	return value, ok
 }
 
 func (s *Scope) Write(name string, value Data) {
-	s.store[name] = value
+	s.Declare(name, value, false)
+}
+
+func (s *Scope) Declare(name string, value Data, immutable bool) {
+	slot := s.slot(name)
+	if slot < 0 {
+		slot = len(s.names)
+	}
+	s.DeclareAt(slot, name, value, immutable)
+}
+
+func (s *Scope) DeclareAt(slot int, name string, value Data, immutable bool) {
+	for len(s.names) <= slot {
+		s.names = append(s.names, "")
+		s.values = append(s.values, nil)
+		s.immutable = append(s.immutable, false)
+	}
+	s.names[slot] = name
+	s.values[slot] = value
+	s.immutable[slot] = immutable
+}
+
+func (s *Scope) Declared(name string) bool {
+	return s.slot(name) >= 0
+}
+
+func (s *Scope) DeclaredAt(slot int) bool {
+	return slot < len(s.values) && s.values[slot] != nil
+}
+
+func (s *Scope) Immutable(name string) bool {
+	if scope, slot := s.owner(name); scope != nil {
+		return scope.immutable[slot]
+	}
+	return false
+}
+
+func (s *Scope) ImmutableAt(depth, slot int) bool {
+	if scope := s.at(depth, slot); scope != nil {
+		return scope.immutable[slot]
+	}
+	return false
 }
 
 func (s *Scope) Update(name string, value Data) {
-	s.updateParents(s, name, value)
+	if scope, slot := s.owner(name); scope != nil {
+		scope.values[slot] = value
+	}
+}
+
+func (s *Scope) UpdateAt(depth, slot int, value Data) {
+	if scope := s.at(depth, slot); scope != nil {
+		scope.values[slot] = value
+	}
+}
+
+func (s *Scope) slot(name string) int {
+	for slot := len(s.names) - 1; slot >= 0; slot-- {
+		if s.names[slot] == name && s.values[slot] != nil {
+			return slot
+		}
+	}
+	return -1
+}
+
+func (s *Scope) owner(name string) (*Scope, int) {
+	for scope := s; scope != nil; scope = scope.parent {
+		if slot := scope.slot(name); slot >= 0 {
+			return scope, slot
+		}
+	}
+	return nil, 0
 }
 
-func (s *Scope) updateParents(scope *Scope, name string, value Data) {
-	if _, ok := scope.Read(name); ok {
-		scope.Write(name, value)
+func (s *Scope) at(depth, slot int) *Scope {
+	scope := s
+	for ; depth > 0 && scope != nil; depth-- {
+		scope = scope.parent
 	}
-	if scope.parent != nil {
-		s.updateParents(scope.parent, name, value)
+	if scope == nil || !scope.DeclaredAt(slot) {
+		return nil
 	}
+	return scope
 }
 
 func (s *Scope) Merge(scope *Scope) {
-	for k, v := range scope.store {
-		if _, ok := s.store[k]; !ok {
-			s.store[k] = v
+	for slot, name := range scope.names {
+		if scope.values[slot] != nil && !s.Declared(name) {
+			s.Declare(name, scope.values[slot], scope.immutable[slot])
 		}
 	}
 }
@@ -78,3 +78,49 @@ func TestScopeMerge(t *testing.T) {
 		t.Errorf("Expected %d but got %d", 20, value.Value)
 	}
 }
+
+func TestScopeShadowing(t *testing.T) {
+	sp := NewScope()
+	sp.Declare("num", &TInteger{Value: 20}, true)
+	s := NewScopeFrom(sp)
+	if !s.Immutable("num") || s.Declared("num") {
+		t.Errorf("Expected an immutable binding from the parent scope")
+	}
+	s.Write("num", &TInteger{Value: 30})
+	s.Update("num", &TInteger{Value: 40})
+	if s.Immutable("num") || !sp.Immutable("num") {
+		t.Errorf("Expected the shadowing binding to be mutable and the parent to keep its own")
+	}
+	val, _ := s.Read("num")
+	valP, _ := sp.Read("num")
+	if val.(*TInteger).Value != 40 || valP.(*TInteger).Value != 20 {
+		t.Errorf("Expected %d and %d but got %s and %s", 40, 20, val.Check(), valP.Check())
+	}
+}
+
+func TestScopeSlots(t *testing.T) {
+	sp := NewScope()
+	sp.DeclareAt(1, "num", &TInteger{Value: 20}, true)
+	s := NewScopeFrom(sp)
+	s.DeclareAt(0, "str", &TString{Value: "test"}, false)
+	if val, ok := s.ReadAt(1, 1); !ok || val.(*TInteger).Value != 20 {
+		t.Errorf("Expected %d but got %v", 20, val)
+	}
+	if _, ok := s.ReadAt(1, 0); ok || sp.DeclaredAt(0) {
+		t.Errorf("Expected the slot that wasn't declared to be empty")
+	}
+	if !s.ImmutableAt(1, 1) || s.ImmutableAt(0, 0) {
+		t.Errorf("Expected only the binding of the parent scope to be immutable")
+	}
+	s.UpdateAt(0, 0, &TString{Value: "other"})
+	if val, _ := s.Read("str"); val.(*TString).Value != "other" {
+		t.Errorf("Expected %s but got %s", "other", val.Check())
+	}
+	if bound := sp.Bound(); len(bound) != 2 || bound[0] != "" || bound[1] != "num" {
+		t.Errorf("Expected %v but got %v", []string{"", "num"}, bound)
+	}
+	sp.Write("other", Nil)
+	if !sp.DeclaredAt(2) {
+		t.Errorf("Expected a name written by the host to take the next slot")
+	}
+}
@@ -4,11 +4,30 @@
 // Package stdlib implements functions to standard library.
 package stdlib
 
+import "strings"
+
+func FileName(source string) string {
+	fields := strings.Fields(source)
+	if len(fields) > 1 && fields[0] == "module" {
+		return "<stdlib:" + fields[1] + ">"
+	}
+	return "<stdlib>"
+}
+
+func Source(file string) ([]byte, bool) {
+	for _, module := range Modules {
+		if FileName(module) == file {
+			return []byte(module), true
+		}
+	}
+	return nil, false
+}
+
 var Modules = []string{
 
 	`module Enum
 
-  val size = fn (array: Array) -> Integer
+  val size = fn (array: Enumerable) -> Integer
     var count = 0
     repeat v in array
       count += 1
@@ -16,31 +35,36 @@ var Modules = []string{
     count
   end
 
-  val empty? = fn (array: Array) -> Boolean
+  val empty? = fn (array: Enumerable) -> Boolean
     size(array) == 0
   end
 
-  val reverse = fn (array: Array) -> Array
+  val reverse = fn (array: Enumerable) -> Array
+    val items = array is Array ? array : reduce(array, [], (v, acc) -> acc + [v])
     var reversed = []
-    repeat i in size(array)-1..0
-      reversed[] = array[i]
+    repeat i in 0..<size(items)
+      reversed[] = items[size(items) - 1 - i]
     end
     reversed
   end
 
-  val first = fn (array: Array)
-    array[0]
+  val first = fn (array: Enumerable)
+    repeat v in array
+      return v
+    end
+    nil
   end
 
-  val last = fn array: Array
-    array[size(array) - 1]
+  val last = fn (array: Enumerable)
+    val items = array is Array ? array : reduce(array, [], (v, acc) -> acc + [v])
+    items[size(items) - 1]
   end
 
   val insert = fn (array: Array, element) -> Array
     array[] = element
   end
 
-  val delete = fn (array: Array, index) -> Array
+  val delete = fn (array: Enumerable, index) -> Array
     var purged = []
     repeat i, v in array
       if i != index
@@ -50,13 +74,31 @@ var Modules = []string{
     purged
   end
 
-  val map = fn (array: Array, fun: Function) -> Array
+  val map = fn (array: Enumerable, fun: Function)
+    if array is Sequence
+      val mapped = fn
+        repeat v in array
+          yield fun(v)
+        end
+      end
+      return mapped()
+    end
     repeat v in array
       fun(v)
     end
   end
 
-  val filter = fn (array: Array, fun: Function) -> Array
+  val filter = fn (array: Enumerable, fun: Function)
+    if array is Sequence
+      val filtered = fn
+        repeat v in array
+          if fun(v)
+            yield v
+          end
+        end
+      end
+      return filtered()
+    end
     var filtered = []
     repeat v in array
       if fun(v)
@@ -66,7 +108,23 @@ var Modules = []string{
     filtered
   end
 
-  val reduce = fn (array: Array, start, fun: Function)
+  val take = fn (array: Enumerable, count: Integer)
+    val taken = fn
+      if count > 0
+        var left = count
+        repeat v in array
+          yield v
+          left -= 1
+          if left == 0
+            break
+          end
+        end
+      end
+    end
+    array is Sequence ? taken() : Array(taken())
+  end
+
+  val reduce = fn (array: Enumerable, start, fun: Function)
     var acc = start
     repeat v in array
       acc = fun(v, acc)
@@ -74,7 +132,7 @@ var Modules = []string{
     return acc
   end
 
-  val find = fn (array: Array, fun: Function)
+  val find = fn (array: Enumerable, fun: Function)
     repeat v in array
       if fun(v)
         return v
@@ -83,7 +141,7 @@ var Modules = []string{
     nil
   end
 
-  val contains? = fn (array: Array, search) -> Boolean
+  val contains? = fn (array: Enumerable, search) -> Boolean
     repeat v in array
       if v == search
         return true
@@ -92,7 +150,7 @@ var Modules = []string{
     false
   end
 
-  val unique = fn (array: Array) -> Array
+  val unique = fn (array: Enumerable) -> Array
     var filtered = []
     var hash = [=>]
     repeat i, v in array
@@ -104,11 +162,11 @@ var Modules = []string{
     filtered
   end
 
-  val random = fn (array: Array)
-    var rnd = runtime_rand(0, size(array) - 1)
-    array[rnd]
+  val random = fn (array: Enumerable)
+    val items = array is Array ? array : reduce(array, [], (v, acc) -> acc + [v])
+    var rnd = runtime_rand(0, size(items) - 1)
+    items[rnd]
   end
-
 end`,
 
 	`module Math
@@ -190,6 +248,22 @@ end`,
     Float(x)
   end
 
+  val parseInteger = fn x
+    try
+      Integer(x)
+    rescue err
+      Error(err[:message], :invalid_integer, x)
+    end
+  end
+
+  val parseFloat = fn x
+    try
+      Float(x)
+    rescue err
+      Error(err[:message], :invalid_float, x)
+    end
+  end
+
   val toArray = fn x
     Array(x)
   end
@@ -207,12 +281,7 @@ end`,
   end
 
   val contains? = fn (dict: Dictionary, key) -> Boolean
-    repeat k, v in dict
-      if k == key
-        return true
-      end
-    end
-    false
+    key in dict
   end
 
   val empty? = fn (dict: Dictionary) -> Boolean
@@ -239,7 +308,7 @@ end`,
     end
     var purged = [=>]
     repeat k, v in dict
-      if k != key
+      if typeof(k) != typeof(key) || k != key
         purged[k] = v
       end
     end
@@ -6,9 +6,13 @@ package runtime
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/luiscm/oro/ast"
+	"github.com/luiscm/oro/rerror"
 	"github.com/luiscm/oro/token"
+	"math"
+	"strconv"
 	"strings"
 )
 
@@ -22,7 +26,15 @@ const (
 	TTSymbol      = "Symbol"
 	TTPlaceHolder = "PlaceHolder"
 	TTFunction    = "Function"
+	TTError       = "Error"
 	TTModule      = "Module"
+	TTStruct      = "Struct"
+	TTEnum        = "Enum"
+	TTSequence    = "Sequence"
+	TTRange       = "Range"
+	TTTask        = "Task"
+	TTChannel     = "Channel"
+	TTEnumerable  = "Enumerable"
 	TTBreak       = "Break"
 	TTContinue    = "Continue"
 	TTReturn      = "Return"
@@ -30,6 +42,10 @@ const (
 )
 
 var (
+	// ErrReported is returned for a failure that is already reported, like
+	// the one of a generator, so it's not reported again.
+	ErrReported = errors.New("Failure already reported")
+
 	Nil = &TNil{}
 	Yes = &TBoolean{Value: true}
 	No  = &TBoolean{Value: false}
@@ -88,46 +104,6 @@ func (t *TFloat) Check() string {
 	return fmt.Sprintf("%f", t.Value)
 }
 
-type TArray struct {
-	Elements []Data
-}
-
-func (t *TArray) Type() string {
-	return TTArray
-}
-
-func (t *TArray) Check() string {
-	var out bytes.Buffer
-	var elements []string
-	for _, e := range t.Elements {
-		elements = append(elements, e.Check())
-	}
-	out.WriteString(token.LeftBracket)
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString(token.RightBracket)
-	return out.String()
-}
-
-type TDictionary struct {
-	Pairs map[Data]Data
-}
-
-func (t *TDictionary) Type() string {
-	return TTDictionary
-}
-
-func (t *TDictionary) Check() string {
-	var out bytes.Buffer
-	var pairs []string
-	for key, value := range t.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s => %s", key.Check(), value.Check()))
-	}
-	out.WriteString(token.LeftBracket)
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString(token.RightBracket)
-	return out.String()
-}
-
 type TSymbol struct {
 	Value string
 }
@@ -164,10 +140,12 @@ func (t *TNil) Check() string {
 }
 
 type TFunction struct {
+	Name       string
 	Parameters []*ast.FunctionParameter
 	Body       *ast.BlockStatement
 	ReturnType *ast.Identifier
 	Variadic   bool
+	Generator  bool
 	Scope      *Scope
 }
 
@@ -197,6 +175,316 @@ func (t *TFunction) Check() string {
 	return out.String()
 }
 
+type TNativeFunction struct {
+	Name string
+	Fn   TNativeFn
+}
+
+func (t *TNativeFunction) Type() string {
+	return TTFunction
+}
+
+func (t *TNativeFunction) Check() string {
+	var out bytes.Buffer
+	out.WriteString(token.Function)
+	out.WriteString(token.Space)
+	out.WriteString(t.Name)
+	out.WriteString(token.LeftParenthesis)
+	out.WriteString(token.Ellipsis)
+	out.WriteString(token.RightParenthesis)
+	return out.String()
+}
+
+const rangeEpsilon = 1e-9
+
+type TRange struct {
+	Start      int64
+	End        int64
+	Step       int64
+	StartFloat float64
+	EndFloat   float64
+	StepFloat  float64
+	Float      bool
+	Exclusive  bool
+}
+
+func NewRange(start, end Data, exclusive bool) (*TRange, error) {
+	from, fromOk := start.(*TInteger)
+	to, toOk := end.(*TInteger)
+	if fromOk && toOk {
+		step := int64(1)
+		if to.Value < from.Value {
+			step = -1
+		}
+		return &TRange{Start: from.Value, End: to.Value, Step: step, Exclusive: exclusive}, nil
+	}
+	fromFloat, ok := rangeFloat(start)
+	toFloat, toFloatOk := rangeFloat(end)
+	if !ok || !toFloatOk {
+		return nil, rerror.ErrorFmt("Range expects Integer or Float bounds but got '%s' and '%s'", start.Type(), end.Type())
+	}
+	step := 1.0
+	if toFloat < fromFloat {
+		step = -1
+	}
+	return &TRange{StartFloat: fromFloat, EndFloat: toFloat, StepFloat: step, Float: true, Exclusive: exclusive}, nil
+}
+
+func rangeFloat(data Data) (float64, bool) {
+	switch value := data.(type) {
+	case *TInteger:
+		return float64(value.Value), true
+	case *TFloat:
+		return value.Value, true
+	}
+	return 0, false
+}
+
+func (t *TRange) WithStep(step Data) (*TRange, error) {
+	value, ok := rangeFloat(step)
+	if !ok {
+		return nil, rerror.ErrorFmt("Range step expects an Integer or a Float but got '%s'", step.Type())
+	}
+	if value <= 0 {
+		return nil, rerror.ErrorFmt("Range step must be positive but got '%s'", step.Check())
+	}
+	stepped := *t
+	if integer, ok := step.(*TInteger); ok && !t.Float {
+		stepped.Step = integer.Value
+		if t.Step < 0 {
+			stepped.Step = -integer.Value
+		}
+		return &stepped, nil
+	}
+	if !t.Float {
+		stepped = TRange{StartFloat: float64(t.Start), EndFloat: float64(t.End), StepFloat: float64(t.Step), Float: true, Exclusive: t.Exclusive}
+	}
+	stepped.StepFloat = math.Copysign(value, stepped.StepFloat)
+	return &stepped, nil
+}
+
+func (t *TRange) Type() string {
+	return TTRange
+}
+
+func (t *TRange) Check() string {
+	var out bytes.Buffer
+	start, end, step := t.bounds()
+	out.WriteString(start.Check())
+	if t.Exclusive {
+		out.WriteString(token.RangeExclusive)
+	} else {
+		out.WriteString(token.Range)
+	}
+	out.WriteString(end.Check())
+	if step != nil {
+		out.WriteString(token.Space)
+		out.WriteString(token.Step)
+		out.WriteString(token.Space)
+		out.WriteString(step.Check())
+	}
+	return out.String()
+}
+
+func (t *TRange) bounds() (Data, Data, Data) {
+	if t.Float {
+		var step Data
+		if math.Abs(t.StepFloat) != 1 {
+			step = &TFloat{Value: math.Abs(t.StepFloat)}
+		}
+		return &TFloat{Value: t.StartFloat}, &TFloat{Value: t.EndFloat}, step
+	}
+	var step Data
+	if t.Step != 1 && t.Step != -1 {
+		step = &TInteger{Value: t.absStep()}
+	}
+	return &TInteger{Value: t.Start}, &TInteger{Value: t.End}, step
+}
+
+func (t *TRange) Len() int64 {
+	if !t.Float {
+		span, step := uint64(t.End-t.Start), uint64(t.absStep())
+		if t.Step < 0 {
+			span = uint64(t.Start - t.End)
+		}
+		if t.Exclusive {
+			return int64((span + step - 1) / step)
+		}
+		return int64(span/step + 1)
+	}
+	span, step := math.Abs(t.EndFloat-t.StartFloat), math.Abs(t.StepFloat)
+	if t.Exclusive {
+		return int64(math.Ceil(span/step - rangeEpsilon))
+	}
+	return int64(math.Floor(span/step+rangeEpsilon)) + 1
+}
+
+func (t *TRange) At(index int64) Data {
+	if !t.Float {
+		return &TInteger{Value: t.Start + index*t.Step}
+	}
+	return &TFloat{Value: t.StartFloat + float64(index)*t.StepFloat}
+}
+
+func (t *TRange) Contains(value Data) bool {
+	if !t.Float {
+		var number int64
+		switch value := value.(type) {
+		case *TInteger:
+			number = value.Value
+		case *TFloat:
+			if value.Value != math.Trunc(value.Value) || math.Abs(value.Value) >= 1<<63 {
+				return false
+			}
+			number = int64(value.Value)
+		default:
+			return false
+		}
+		offset := number - t.Start
+		index := offset / t.Step
+		return offset%t.Step == 0 && index >= 0 && index < t.Len()
+	}
+	number, ok := rangeFloat(value)
+	if !ok {
+		return false
+	}
+	steps := (number - t.StartFloat) / t.StepFloat
+	index := math.Round(steps)
+	return math.Abs(steps-index) < rangeEpsilon && index >= 0 && int64(index) < t.Len()
+}
+
+func (t *TRange) Elements() []Data {
+	elements := make([]Data, t.Len())
+	for idx := range elements {
+		elements[idx] = t.At(int64(idx))
+	}
+	return elements
+}
+
+func (t *TRange) absStep() int64 {
+	if t.Step < 0 {
+		return -t.Step
+	}
+	return t.Step
+}
+
+type TTask struct {
+	Name     string
+	Finished bool
+	Result   Data
+	Err      *TError
+	Waiters  []*Waiter
+}
+
+func (t *TTask) Type() string {
+	return TTTask
+}
+
+func (t *TTask) Check() string {
+	return TTTask + token.LeftParenthesis + t.Name + token.RightParenthesis
+}
+
+type TChannel struct {
+	Capacity  int
+	Buffer    []Data
+	Closed    bool
+	Senders   []ChannelWait
+	Receivers []ChannelWait
+}
+
+func (t *TChannel) Type() string {
+	return TTChannel
+}
+
+func (t *TChannel) Check() string {
+	return fmt.Sprintf("%s(%d)", TTChannel, t.Capacity)
+}
+
+type Waiter struct {
+	Wake  chan struct{}
+	Woken bool
+	Case  int
+	Value Data
+	Ok    bool
+}
+
+type ChannelWait struct {
+	Waiter *Waiter
+	Case   int
+	Value  Data
+}
+
+type Iterator interface {
+	Next() (Data, bool)
+	Stop()
+	Err() error
+}
+
+type TSequence struct {
+	Name    string
+	Iterate func() Iterator
+}
+
+func (t *TSequence) Type() string {
+	return TTSequence
+}
+
+func (t *TSequence) Check() string {
+	var out bytes.Buffer
+	out.WriteString(TTSequence)
+	out.WriteString(token.LeftParenthesis)
+	out.WriteString(t.Name)
+	out.WriteString(token.RightParenthesis)
+	return out.String()
+}
+
+func (t *TSequence) Collect() (*TArray, error) {
+	iterator := t.Iterate()
+	defer iterator.Stop()
+	elements := []Data{}
+	for {
+		value, ok := iterator.Next()
+		if !ok {
+			break
+		}
+		elements = append(elements, value)
+	}
+	if err := iterator.Err(); err != nil {
+		return nil, err
+	}
+	return NewArray(elements), nil
+}
+
+type TError struct {
+	Kind    string
+	Message string
+	Tag     *TSymbol
+	Payload Data
+	Stack   []rerror.Frame
+}
+
+func (t *TError) Type() string {
+	return TTError
+}
+
+func (t *TError) Check() string {
+	var out bytes.Buffer
+	out.WriteString(TTError)
+	out.WriteString(token.LeftParenthesis)
+	if t.Tag != nil {
+		out.WriteString(t.Tag.Check())
+		out.WriteString(token.Comma)
+		out.WriteString(token.Space)
+	}
+	out.WriteString(strconv.Quote(t.Message))
+	out.WriteString(token.RightParenthesis)
+	return out.String()
+}
+
+func (t *TError) Error() string {
+	return t.Message
+}
+
 type TModule struct {
 	Name *ast.Identifier
 	Body *ast.BlockStatement
@@ -221,6 +509,164 @@ func (t *TModule) Check() string {
 	return out.String()
 }
 
+type TStructType struct {
+	Name   string
+	Fields []string
+	Types  []string
+}
+
+func (t *TStructType) Type() string {
+	return TTStruct
+}
+
+func (t *TStructType) Check() string {
+	var out bytes.Buffer
+	var fields []string
+	for idx, field := range t.Fields {
+		if t.Types[idx] == "" {
+			fields = append(fields, field)
+		} else {
+			fields = append(fields, field+token.Colon+token.Space+t.Types[idx])
+		}
+	}
+	out.WriteString(token.Struct)
+	out.WriteString(token.Space)
+	out.WriteString(t.Name)
+	out.WriteString(token.LeftParenthesis)
+	out.WriteString(strings.Join(fields, token.Comma+token.Space))
+	out.WriteString(token.RightParenthesis)
+	return out.String()
+}
+
+func (t *TStructType) Field(name string) int {
+	for idx, field := range t.Fields {
+		if field == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+type TStruct struct {
+	Definition *TStructType
+	Values     []Data
+}
+
+func (t *TStruct) Type() string {
+	return t.Definition.Name
+}
+
+func (t *TStruct) Check() string {
+	var out bytes.Buffer
+	var fields []string
+	for idx, field := range t.Definition.Fields {
+		fields = append(fields, field+token.Colon+token.Space+t.Values[idx].Check())
+	}
+	out.WriteString(t.Definition.Name)
+	out.WriteString(token.LeftParenthesis)
+	out.WriteString(strings.Join(fields, token.Comma+token.Space))
+	out.WriteString(token.RightParenthesis)
+	return out.String()
+}
+
+type TEnumType struct {
+	Name     string
+	Variants []*TVariantType
+}
+
+func (t *TEnumType) Type() string {
+	return TTEnum
+}
+
+func (t *TEnumType) Check() string {
+	var out bytes.Buffer
+	var variants []string
+	for _, variant := range t.Variants {
+		variants = append(variants, variant.signature())
+	}
+	out.WriteString(token.Enum)
+	out.WriteString(token.Space)
+	out.WriteString(t.Name)
+	out.WriteString(token.LeftParenthesis)
+	out.WriteString(strings.Join(variants, token.Comma+token.Space))
+	out.WriteString(token.RightParenthesis)
+	return out.String()
+}
+
+func (t *TEnumType) Variant(name string) *TVariantType {
+	for _, variant := range t.Variants {
+		if variant.Name == name {
+			return variant
+		}
+	}
+	return nil
+}
+
+type TVariantType struct {
+	Enum   *TEnumType
+	Name   string
+	Fields []string
+	Types  []string
+}
+
+func (t *TVariantType) Type() string {
+	return TTFunction
+}
+
+func (t *TVariantType) Check() string {
+	return t.Enum.Name + token.Dot + t.signature()
+}
+
+func (t *TVariantType) Field(name string) int {
+	for idx, field := range t.Fields {
+		if field == name {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (t *TVariantType) signature() string {
+	if len(t.Fields) == 0 {
+		return t.Name
+	}
+	var fields []string
+	for idx, field := range t.Fields {
+		if t.Types[idx] == "" {
+			fields = append(fields, field)
+		} else {
+			fields = append(fields, field+token.Colon+token.Space+t.Types[idx])
+		}
+	}
+	return t.Name + token.LeftParenthesis + strings.Join(fields, token.Comma+token.Space) + token.RightParenthesis
+}
+
+type TVariant struct {
+	Variant *TVariantType
+	Values  []Data
+}
+
+func (t *TVariant) Type() string {
+	return t.Variant.Enum.Name
+}
+
+func (t *TVariant) Check() string {
+	var out bytes.Buffer
+	out.WriteString(t.Variant.Enum.Name)
+	out.WriteString(token.Dot)
+	out.WriteString(t.Variant.Name)
+	if len(t.Values) > 0 {
+		var fields []string
+		for idx, field := range t.Variant.Fields {
+			fields = append(fields, field+token.Colon+token.Space+t.Values[idx].Check())
+		}
+		out.WriteString(token.LeftParenthesis)
+		out.WriteString(strings.Join(fields, token.Comma+token.Space))
+		out.WriteString(token.RightParenthesis)
+	}
+	return out.String()
+}
+
 type TBreak struct{}
 
 func (t *TBreak) Type() string {
@@ -13,8 +13,9 @@ type Token struct {
 }
 
 type Position struct {
-	Row int
-	Col int
+	File string
+	Row  int
+	Col  int
 }
 
 const (
@@ -66,6 +67,7 @@ const (
 	Colon            = ":"
 	SemiColon        = ";"
 	Range            = ".."
+	RangeExclusive   = "..<"
 	Ellipsis         = "..."
 	Dot              = "."
 	Comma            = ","
@@ -81,6 +83,7 @@ const (
 	Else     = "else"
 	Repeat   = "repeat"
 	In       = "in"
+	Step     = "step"
 	Is       = "is"
 	As       = "as"
 	Nil      = "nil"
@@ -91,7 +94,16 @@ const (
 	Break    = "break"
 	Continue = "continue"
 	Module   = "module"
+	Struct   = "struct"
+	Enum     = "enum"
+	Yield    = "yield"
+	Spawn    = "spawn"
+	Await    = "await"
+	Select   = "select"
 	Use      = "use"
+	Try      = "try"
+	Rescue   = "rescue"
+	Ensure   = "ensure"
 	True     = "true"
 	False    = "false"
 	// Miscellaneous
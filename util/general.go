@@ -15,6 +15,7 @@ const (
 	OroName                          = "Oro Programming Language"
 	OroVersion                       = "1.0.0"
 	OroReplSignal                    = "oro> "
+	OroReplFile                      = "<repl>"
 	OroAuthorName                    = "LuisCM"
 	OroAuthorEmail                   = "tcljava@gmail.com"
 	OroCopyrightDescription          = "Copyright "
@@ -27,6 +28,16 @@ const (
 	OroCliCommandActionRunExistFile  = "The file extension '%s' should be '" + OroFileExtension + "'."
 	OroCliCommandActionRunSourceFile = "Run expects a source file as argument."
 	OroCliCommandActionRunReadFile   = "Couldn't read '%s'."
+	OroCliFlagErrorFormat            = "error-format"
+	OroCliFlagUsageErrorFormat       = "Format of the reported errors: '" + OroErrorFormatText + "' or '" + OroErrorFormatJSON + "'."
+	OroCliFlagInvalidErrorFormat     = "Unknown error format '%s'."
+	OroErrorFormatText               = "text"
+	OroErrorFormatJSON               = "json"
+	OroCliFlagEngine                 = "engine"
+	OroCliFlagUsageEngine            = "Engine that runs the programs: '" + OroEngineTree + "' or '" + OroEngineVM + "'."
+	OroCliFlagInvalidEngine          = "Unknown engine '%s'."
+	OroEngineTree                    = "tree"
+	OroEngineVM                      = "vm"
 	OroCliCommandNameRepl            = "repl"
 	OroCliCommandUsageRepl           = "Start the interactive Read-Eval-Print Loop."
 )
@@ -43,6 +54,10 @@ func ReplSignal() string {
 	return OroReplSignal
 }
 
+func ReplFile() string {
+	return OroReplFile
+}
+
 func Name() string {
 	return OroName
 }
@@ -110,3 +125,39 @@ func CliCommandNameRepl() string {
 func CliCommandUsageRepl() string {
 	return OroCliCommandUsageRepl
 }
+
+func CliFlagErrorFormat() string {
+	return OroCliFlagErrorFormat
+}
+
+func CliFlagUsageErrorFormat() string {
+	return OroCliFlagUsageErrorFormat
+}
+
+func CliFlagInvalidErrorFormat() string {
+	return OroCliFlagInvalidErrorFormat
+}
+
+func ErrorFormatText() string {
+	return OroErrorFormatText
+}
+
+func ErrorFormatJSON() string {
+	return OroErrorFormatJSON
+}
+
+func CliFlagEngine() string {
+	return OroCliFlagEngine
+}
+
+func CliFlagUsageEngine() string {
+	return OroCliFlagUsageEngine
+}
+
+func CliFlagInvalidEngine() string {
+	return OroCliFlagInvalidEngine
+}
+
+func EngineTree() string {
+	return OroEngineTree
+}